@@ -71,11 +71,48 @@ func main() {
 		HearthhubDb:     model.Connect(),
 		ModNexusService: service.MakeModNexusService(),
 	}
+	w.CatalogService = service.MakeCatalogService(w.HearthhubDb, w.ModNexusService, service.MakeThunderstoreService())
+	w.OperationService = service.MakeOperationService(w.HearthhubDb, w.KubeService, w.RabbitMQService)
+	w.ImageService = service.MakeImageService()
+	w.RolloutService = service.MakeRolloutService(w.HearthhubDb, w.KubeService, w.S3Service, w.OperationService)
+	w.RateLimitBackend = service.MakeRateLimitBackend(w.HearthhubDb)
+
+	err = service.Migrate(w.HearthhubDb)
+	if err != nil {
+		log.Fatalf("failed to run api database migrations: %v", err)
+	}
+
 	router, wsManager := src.NewRouter(context.Background(), &w)
 
+	// Background controllers run on a single replica at a time, the replica holding the controller lease
+	elector := service.MakeLeaderElector(w.KubeService.GetClient())
+
+	// Keeps the mod catalog in sync with Nexus Mods and Thunderstore
+	elector.Add("catalog", func(ctx context.Context) { w.CatalogService.Run(ctx, 6*time.Hour) })
+
+	// Moves operations through their lifecycle as the jobs backing them finish
+	elector.Add("operations", func(ctx context.Context) { w.OperationService.Run(ctx, 5*time.Second) })
+
+	// Upgrades tenant servers a few at a time while an admin rollout is running
+	elector.Add("rollouts", func(ctx context.Context) { w.RolloutService.Run(ctx, 15*time.Second) })
+
+	// Deletes audit entries once they are older than the retention period
+	elector.Add("audit-retention", func(ctx context.Context) { service.RunAuditRetention(ctx, w.HearthhubDb, 24*time.Hour) })
+
+	// Deletes stored responses for idempotency keys once they can no longer be replayed
+	elector.Add("idempotency-pruning", func(ctx context.Context) { service.RunIdempotencyPruning(ctx, w.HearthhubDb, time.Hour) })
+
+	// Rebuilds storage usage from S3 to correct counters which drifted as objects were overwritten
+	elector.Add("storage-recalculation", func(ctx context.Context) { service.RunStorageRecalculation(ctx, w.HearthhubDb, w.S3Service, time.Hour) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go elector.Run(ctx)
+
 	// Registers a new go routine listening to the stripe-webhooks channel. New messages are enqueued when the /api/v1/stripe/webhook
 	// endpoint is called and this function consumes the messages with a 5-second delay in between each message resolving eventual consistency
-	// issues with both cognito and stripe when many events are sent at checkout.
+	// issues with both cognito and stripe when many events are sent at checkout. Every replica consumes from the same durable queue so
+	// each webhook is handled once by whichever replica receives it.
 	err = rabbitMqService.RegisterConsumer(stripe_handlers.ConsumeMessageWithDelay, 3*time.Second, w.HearthhubDb)
 	if err != nil {
 		logrus.Errorf("failed to register stripe webhook message consumer: %v", err)
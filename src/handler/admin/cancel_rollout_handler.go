@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type CancelRolloutHandler struct{}
+
+// HandleRequest Handles the request for stopping a running rollout. Servers which are already upgrading finish their upgrade.
+func (h *CancelRolloutHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	rollout, ok := rolloutFromParam(c, w.RolloutService)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	if err := w.RolloutService.Cancel(rollout, fmt.Sprintf("cancelled by %s", user.DiscordID)); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	service.SetAudit(c, service.AuditRecord{Action: "admin.rollout.cancel", TargetType: "rollout", TargetID: rollout.ID})
+	c.JSON(http.StatusOK, rollout)
+}
@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type CreateRolloutRequest struct {
+	// ValheimVersion and BackupManagerVersion default to the versions new servers are created with. Only servers on the game
+	// branch of the Valheim version are upgraded
+	ValheimVersion       string   `json:"valheim_version"`
+	BackupManagerVersion string   `json:"backup_manager_version"`
+	Concurrency          *int     `json:"concurrency,omitempty"`
+	FailureThreshold     *float64 `json:"failure_threshold,omitempty"`
+}
+
+// Validate Checks that the concurrency and failure threshold of a rollout are within bounds.
+func (r *CreateRolloutRequest) Validate() error {
+	if r.Concurrency != nil && (*r.Concurrency < 1 || *r.Concurrency > service.MaxRolloutConcurrency) {
+		return fmt.Errorf("concurrency must be between 1 and %d", service.MaxRolloutConcurrency)
+	}
+	if r.FailureThreshold != nil && (*r.FailureThreshold < 0 || *r.FailureThreshold > 1) {
+		return errors.New("failure_threshold must be between 0 and 1")
+	}
+	return nil
+}
+
+type CreateRolloutHandler struct{}
+
+// HandleRequest Handles the request for upgrading every tenant server to a set of image versions. Servers are upgraded by
+// the rollout orchestrator in the background and the returned rollout reports its progress.
+func (h *CreateRolloutHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	var req CreateRolloutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+	}
+
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	defaults := service.DefaultServerImage(0)
+	rollout := &service.Rollout{
+		ValheimVersion:       req.ValheimVersion,
+		BackupManagerVersion: req.BackupManagerVersion,
+		Concurrency:          service.DefaultRolloutConcurrency,
+		FailureThreshold:     service.DefaultRolloutFailureThreshold,
+		CreatedBy:            user.DiscordID,
+	}
+	if rollout.ValheimVersion == "" {
+		rollout.ValheimVersion = defaults.ValheimVersion
+	}
+	if rollout.BackupManagerVersion == "" {
+		rollout.BackupManagerVersion = defaults.BackupManagerVersion
+	}
+	if req.Concurrency != nil {
+		rollout.Concurrency = *req.Concurrency
+	}
+	if req.FailureThreshold != nil {
+		rollout.FailureThreshold = *req.FailureThreshold
+	}
+
+	versions := w.ImageService.Versions(c.Request.Context(), service.ImageBranch(rollout.ValheimVersion))
+	if !contains(versions.Valheim, rollout.ValheimVersion) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("valheim version %s is not available", rollout.ValheimVersion)})
+		return
+	}
+	if !contains(versions.BackupManager, rollout.BackupManagerVersion) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("backup manager version %s is not available", rollout.BackupManagerVersion)})
+		return
+	}
+
+	if err := w.RolloutService.Create(rollout); err != nil {
+		if errors.Is(err, service.ErrRolloutRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Errorf("failed to create rollout: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create rollout"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "admin.rollout.create",
+		TargetType: "rollout",
+		TargetID:   rollout.ID,
+		After:      rollout,
+	})
+	c.JSON(http.StatusAccepted, rollout)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
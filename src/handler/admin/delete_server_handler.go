@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strings"
+)
+
+type DeleteServerHandler struct{}
+
+// HandleRequest Handles the request for deleting a tenant server. The deployment and pvc are deleted before the server record
+// so the tenant cannot be left with resources the api no longer knows about.
+func (h *DeleteServerHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	server, ok := serverFromParam(c, w.HearthhubDb)
+	if !ok {
+		return
+	}
+
+	pvc := server.PVCName
+	if pvc == "" {
+		pvc = fmt.Sprintf("valheim-pvc-%s", server.User.DiscordID)
+	}
+
+	actions := []service.ResourceAction{
+		service.DeploymentAction{Deployment: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:      service.ServerDeploymentName(server, server.User.DiscordID),
+			Namespace: service.Namespace,
+		}}},
+		service.PVCAction{PVC: &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Name:      pvc,
+			Namespace: service.Namespace,
+		}}},
+	}
+
+	names, err := service.RollbackResources(w.KubeService.GetClient(), actions...)
+	if err != nil {
+		log.Errorf("failed to delete resources for server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to delete deployment/pvc: %v", err)})
+		return
+	}
+
+	if err = w.HearthhubDb.Delete(&model.Server{}, server.ID).Error; err != nil {
+		log.Errorf("error deleting server %d from db: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error deleting server from db: %v", err)})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "admin.server.delete",
+		TargetType: "server",
+		TargetID:   server.ID,
+		OwnerID:    server.UserID,
+		Before:     service.RedactServer(*server),
+		Details:    map[string]string{"resources": strings.Join(names, ",")},
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "deleted resources successfully",
+		"resources": names,
+	})
+}
@@ -0,0 +1,18 @@
+package admin
+
+import (
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type GetRolloutHandler struct{}
+
+// HandleRequest Handles the request for the progress of a rollout including the status of each server.
+func (h *GetRolloutHandler) HandleRequest(c *gin.Context, rolloutService *service.RolloutService) {
+	rollout, ok := rolloutFromParam(c, rolloutService)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rollout)
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// recentOperations is the number of a user's latest operations included in their details.
+const recentOperations = 20
+
+// UserDetails adds the effective limits and latest operations of a tenant to their summary.
+type UserDetails struct {
+	UserSummary
+	Limits     *model.SubscriptionLimits `json:"limits,omitempty"`
+	Operations []service.Operation       `json:"operations"`
+}
+
+type GetUserHandler struct{}
+
+// HandleRequest Handles the request for a single tenant's subscription, limits with overrides applied, servers, storage usage,
+// and latest operations.
+func (h *GetUserHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	user, ok := userFromParam(c, w.HearthhubDb)
+	if !ok {
+		return
+	}
+
+	summaries, err := summarizeUsers(w, []model.User{*user})
+	if err != nil {
+		log.Errorf("failed to summarize user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		return
+	}
+
+	details := UserDetails{UserSummary: summaries[0]}
+	if details.Limits, err = service.UserLimits(w.HearthhubDb, w.StripeService, user); err != nil {
+		log.Errorf("failed to get limits for user %d: %v", user.ID, err)
+	}
+
+	err = w.HearthhubDb.Where("user_id = ? AND parent_id IS NULL", user.ID).Order("id DESC").Limit(recentOperations).Find(&details.Operations).Error
+	if err != nil {
+		log.Errorf("failed to list operations for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, details)
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type GrantAdminRequest struct {
+	DiscordID string `json:"discord_id" binding:"required"`
+}
+
+type GrantAdminHandler struct{}
+
+// HandleRequest Handles the request for granting the admin role to an existing user.
+func (h *GrantAdminHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	var req GrantAdminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	var count int64
+	if err := db.Model(&model.User{}).Where("discord_id = ?", req.DiscordID).Count(&count).Error; err != nil || count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	admin, err := service.GrantAdmin(db, req.DiscordID, user.DiscordID)
+	if err != nil {
+		log.Errorf("failed to grant admin to %s: %v", req.DiscordID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to grant admin"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "admin.role.grant", TargetType: "user", TargetID: req.DiscordID, After: admin})
+	c.JSON(http.StatusOK, admin)
+}
@@ -0,0 +1,22 @@
+package admin
+
+import (
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type ListAdminsHandler struct{}
+
+// HandleRequest Handles the request for listing the users granted the admin role.
+func (h *ListAdminsHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	admins, err := service.ListAdmins(db)
+	if err != nil {
+		log.Errorf("failed to list admins: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list admins"})
+		return
+	}
+	c.JSON(http.StatusOK, admins)
+}
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type ListAuditResponse struct {
+	Entries []service.AuditEntry `json:"entries"`
+	Page    int                  `json:"page"`
+	Limit   int                  `json:"limit"`
+	Total   int64                `json:"total"`
+}
+
+type ListAuditHandler struct{}
+
+// HandleRequest Handles the request for listing the audit entries of every tenant newest first. Entries can be filtered by the
+// discord id of the user who took the action with the actor query parameter, the action, the target, and the request id.
+func (h *ListAuditHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	page, limit, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	entries, total, err := service.ListAuditEntries(db, service.AuditFilter{
+		ActorDiscordID: c.Query("actor"),
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetID:       c.Query("target_id"),
+		RequestID:      c.Query("request_id"),
+	}, page, limit)
+	if err != nil {
+		log.Errorf("failed to list audit entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListAuditResponse{
+		Entries: entries,
+		Page:    page,
+		Limit:   limit,
+		Total:   total,
+	})
+}
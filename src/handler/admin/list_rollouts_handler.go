@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+type ListRolloutsHandler struct{}
+
+// HandleRequest Handles the request for listing every rollout and its progress, newest first.
+func (h *ListRolloutsHandler) HandleRequest(c *gin.Context, rolloutService *service.RolloutService) {
+	rollouts, err := rolloutService.List()
+	if err != nil {
+		log.Errorf("failed to list rollouts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list rollouts"})
+		return
+	}
+	c.JSON(http.StatusOK, rollouts)
+}
+
+// rolloutFromParam Loads the rollout identified by the :rolloutId route parameter, writing an error response when it cannot
+// be found.
+func rolloutFromParam(c *gin.Context, rolloutService *service.RolloutService) (*service.Rollout, bool) {
+	id, err := strconv.ParseUint(c.Param("rolloutId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rollout id"})
+		return nil, false
+	}
+
+	rollout, err := rolloutService.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rollout not found"})
+		return nil, false
+	}
+	return rollout, true
+}
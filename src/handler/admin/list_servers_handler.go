@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strconv"
+)
+
+// ServerSummary is an operator's view of a tenant server and the state of its deployment.
+type ServerSummary struct {
+	model.Server
+	OwnerDiscordID string `json:"owner_discord_id"`
+	Replicas       int32  `json:"replicas"`
+	ReadyReplicas  int32  `json:"ready_replicas"`
+	Deployed       bool   `json:"deployed"`
+}
+
+type ListServersResponse struct {
+	Servers []ServerSummary `json:"servers"`
+	Page    int             `json:"page"`
+	Limit   int             `json:"limit"`
+	Total   int64           `json:"total"`
+}
+
+type ListServersHandler struct{}
+
+// HandleRequest Handles the request for listing every tenant server along with the number of replicas its deployment is
+// running.
+func (h *ListServersHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	page, limit, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	var total int64
+	if err := w.HearthhubDb.Model(&model.Server{}).Count(&total).Error; err != nil {
+		log.Errorf("failed to count servers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list servers"})
+		return
+	}
+
+	var servers []model.Server
+	err := w.HearthhubDb.Preload("User").Preload("WorldDetails").Preload("WorldDetails.Modifiers").
+		Order("id ASC").Offset((page - 1) * limit).Limit(limit).Find(&servers).Error
+	if err != nil {
+		log.Errorf("failed to list servers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list servers"})
+		return
+	}
+
+	deployments, err := w.KubeService.GetClient().AppsV1().Deployments(service.Namespace).List(c.Request.Context(), metav1.ListOptions{})
+	if err != nil {
+		log.Errorf("failed to list deployments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list server deployments"})
+		return
+	}
+
+	summaries := make([]ServerSummary, 0, len(servers))
+	for _, server := range servers {
+		summary := ServerSummary{Server: service.RedactServer(server), OwnerDiscordID: server.User.DiscordID}
+		name := service.ServerDeploymentName(&server, server.User.DiscordID)
+		for _, deployment := range deployments.Items {
+			if deployment.Name == name {
+				summary.Deployed = true
+				summary.ReadyReplicas = deployment.Status.ReadyReplicas
+				if deployment.Spec.Replicas != nil {
+					summary.Replicas = *deployment.Spec.Replicas
+				}
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	c.JSON(http.StatusOK, ListServersResponse{
+		Servers: summaries,
+		Page:    page,
+		Limit:   limit,
+		Total:   total,
+	})
+}
+
+// serverFromParam Loads the server identified by the :serverId route parameter along with its owner, writing an error response
+// when it cannot be found.
+func serverFromParam(c *gin.Context, db *gorm.DB) (*model.Server, bool) {
+	id, err := strconv.ParseUint(c.Param("serverId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid server id"})
+		return nil, false
+	}
+
+	var server model.Server
+	if err = db.Preload("User").Preload("WorldDetails").Preload("WorldDetails.Modifiers").First(&server, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return nil, false
+	}
+	return &server, true
+}
@@ -0,0 +1,183 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+// UserSummary is an operator's view of a tenant: their subscription, servers, and the resources they use.
+type UserSummary struct {
+	ID                 uint                    `json:"id"`
+	DiscordID          string                  `json:"discordId"`
+	DiscordUsername    string                  `json:"discordUsername"`
+	Email              string                  `json:"email"`
+	CustomerId         string                  `json:"customerId"`
+	SubscriptionId     string                  `json:"subscriptionId"`
+	SubscriptionStatus string                  `json:"subscriptionStatus"`
+	Admin              bool                    `json:"admin"`
+	Servers            []model.Server          `json:"servers"`
+	Storage            *service.StorageUsage   `json:"storage,omitempty"`
+	LimitsOverride     *service.LimitsOverride `json:"limitsOverride,omitempty"`
+	CreatedAt          time.Time               `json:"created_at"`
+}
+
+type ListUsersResponse struct {
+	Users []UserSummary `json:"users"`
+	Page  int           `json:"page"`
+	Limit int           `json:"limit"`
+	Total int64         `json:"total"`
+}
+
+type ListUsersHandler struct{}
+
+// HandleRequest Handles the request for listing every tenant with their subscription status, servers, and storage usage. Users
+// can be searched by discord id, username, or email with the q query parameter.
+func (h *ListUsersHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	page, limit, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	query := w.HearthhubDb.Model(&model.User{})
+	if q := c.Query("q"); q != "" {
+		like := "%" + q + "%"
+		query = query.Where("discord_id = ? OR discord_username LIKE ? OR email LIKE ?", q, like, like)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Errorf("failed to count users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users"})
+		return
+	}
+
+	var users []model.User
+	err := query.Preload("Servers").Preload("Servers.WorldDetails").Preload("Servers.WorldDetails.Modifiers").
+		Order("id ASC").Offset((page - 1) * limit).Limit(limit).Find(&users).Error
+	if err != nil {
+		log.Errorf("failed to list users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users"})
+		return
+	}
+
+	summaries, err := summarizeUsers(w, users)
+	if err != nil {
+		log.Errorf("failed to summarize users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListUsersResponse{
+		Users: summaries,
+		Page:  page,
+		Limit: limit,
+		Total: total,
+	})
+}
+
+// summarizeUsers Builds the operator view of each user. Storage usage is read as tracked rather than rebuilt from S3 and a
+// subscription status which cannot be read from Stripe is reported as unknown.
+func summarizeUsers(w *service.Wrapper, users []model.User) ([]UserSummary, error) {
+	ids := make([]uint, 0, len(users))
+	discordIds := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+		discordIds = append(discordIds, user.DiscordID)
+	}
+
+	admins, err := service.AdminDiscordIDs(w.HearthhubDb, discordIds)
+	if err != nil {
+		return nil, err
+	}
+	statuses := w.StripeService.SubscriptionStatuses(users)
+
+	usages := map[uint]*service.StorageUsage{}
+	overrides := map[uint]*service.LimitsOverride{}
+	if len(ids) > 0 {
+		var storage []service.StorageUsage
+		if err := w.HearthhubDb.Where("user_id IN ?", ids).Find(&storage).Error; err != nil {
+			return nil, fmt.Errorf("failed to list storage usage: %v", err)
+		}
+		for i := range storage {
+			usages[storage[i].UserID] = &storage[i]
+		}
+
+		var limits []service.LimitsOverride
+		if err := w.HearthhubDb.Where("user_id IN ?", ids).Find(&limits).Error; err != nil {
+			return nil, fmt.Errorf("failed to list limits overrides: %v", err)
+		}
+		for i := range limits {
+			overrides[limits[i].UserID] = &limits[i]
+		}
+	}
+
+	summaries := make([]UserSummary, 0, len(users))
+	for _, user := range users {
+		servers := make([]model.Server, 0, len(user.Servers))
+		for _, server := range user.Servers {
+			servers = append(servers, service.RedactServer(server))
+		}
+
+		summaries = append(summaries, UserSummary{
+			ID:                 user.ID,
+			DiscordID:          user.DiscordID,
+			DiscordUsername:    user.DiscordUsername,
+			Email:              user.Email,
+			CustomerId:         user.CustomerId,
+			SubscriptionId:     user.SubscriptionId,
+			SubscriptionStatus: statuses[user.ID],
+			Admin:              admins[user.DiscordID],
+			Servers:            servers,
+			Storage:            usages[user.ID],
+			LimitsOverride:     overrides[user.ID],
+			CreatedAt:          user.CreatedAt,
+		})
+	}
+	return summaries, nil
+}
+
+// pageParams Parses the page and limit query parameters, writing an error response when either is invalid.
+func pageParams(c *gin.Context) (int, int, bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page: must be a positive integer"})
+		return 0, 0, false
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit: must be between 1 and %d", maxPageSize)})
+		return 0, 0, false
+	}
+	return page, limit, true
+}
+
+// userFromParam Loads the user identified by the :userId route parameter, writing an error response when they cannot be
+// found.
+func userFromParam(c *gin.Context, db *gorm.DB) (*model.User, bool) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return nil, false
+	}
+
+	var user model.User
+	err = db.Preload("Servers").Preload("Servers.WorldDetails").Preload("Servers.WorldDetails.Modifiers").First(&user, id).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return &user, true
+}
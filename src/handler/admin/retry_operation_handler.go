@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+type RetryOperationHandler struct{}
+
+// HandleRequest Handles the request for re-running the job of any tenant's failed operation. The retry is tracked as a new
+// operation which is returned.
+func (h *RetryOperationHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	id, err := strconv.ParseUint(c.Param("operationId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid operation id"})
+		return
+	}
+
+	op, err := w.OperationService.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+		return
+	}
+
+	retried, err := w.OperationService.Retry(c.Request.Context(), op)
+	if err != nil {
+		log.Errorf("failed to retry operation %d: %v", op.ID, err)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "admin.operation.retry",
+		TargetType: "operation",
+		TargetID:   op.ID,
+		OwnerID:    op.UserID,
+		Details: map[string]string{
+			"retry_id":     strconv.Itoa(int(retried.ID)),
+			"retry_job":    retried.JobName,
+			"failed_job":   op.JobName,
+			"failed_cause": op.Message,
+		},
+	})
+	c.JSON(http.StatusAccepted, retried)
+}
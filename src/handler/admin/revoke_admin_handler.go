@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"errors"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type RevokeAdminHandler struct{}
+
+// HandleRequest Handles the request for removing the admin role from a user. Admins cannot revoke their own role so the api
+// is never left without an admin by mistake.
+func (h *RevokeAdminHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	discordId := c.Param("discordId")
+	user := c.MustGet("user").(*model.User)
+	if discordId == user.DiscordID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "admins cannot revoke their own role"})
+		return
+	}
+
+	err := service.RevokeAdmin(db, discordId)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "admin not found"})
+		return
+	case errors.Is(err, service.ErrBootstrapAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Errorf("failed to revoke admin from %s: %v", discordId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke admin"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "admin.role.revoke", TargetType: "user", TargetID: discordId})
+	c.JSON(http.StatusOK, gin.H{"message": "admin role revoked"})
+}
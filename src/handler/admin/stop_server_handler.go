@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+type StopServerHandler struct{}
+
+// HandleRequest Handles the request for force-stopping a tenant server by scaling its deployment to 0 replicas. Players are
+// disconnected without waiting for them to leave.
+func (h *StopServerHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	server, ok := serverFromParam(c, w.HearthhubDb)
+	if !ok {
+		return
+	}
+
+	deployment := service.ServerDeploymentName(server, server.User.DiscordID)
+	previous, err := service.ScaleDeployment(c.Request.Context(), w.KubeService.GetClient(), deployment, 0)
+	if err != nil {
+		log.Errorf("failed to stop server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to stop server: %v", err)})
+		return
+	}
+
+	before := service.RedactServer(*server)
+	if err = w.HearthhubDb.Model(&model.Server{}).Where("id = ?", server.ID).Update("state", model.TERMINATED).Error; err != nil {
+		log.Errorf("could not update state of server %d: %v", server.ID, err)
+	}
+	server.State = model.TERMINATED
+
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "admin.server.stop",
+		TargetType: "server",
+		TargetID:   server.ID,
+		OwnerID:    server.UserID,
+		Before:     before,
+		After:      service.RedactServer(*server),
+		Details:    map[string]string{"previous_replicas": strconv.Itoa(int(previous))},
+	})
+	c.JSON(http.StatusOK, service.RedactServer(*server))
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type UpdateLimitsRequest struct {
+	CpuLimit            *int   `json:"cpuLimit,omitempty"`
+	MemoryLimit         *int   `json:"memoryLimit,omitempty"`
+	MaxBackups          *int   `json:"maxBackups,omitempty"`
+	MaxWorlds           *int   `json:"maxWorlds,omitempty"`
+	ExistingWorldUpload *bool  `json:"existingWorldUpload,omitempty"`
+	StorageQuotaBytes   *int64 `json:"storageQuotaBytes,omitempty"`
+	Reason              string `json:"reason"`
+}
+
+type UpdateLimitsHandler struct{}
+
+// HandleRequest Handles the request for replacing a tenant's limits override. Limits omitted from the request fall back to
+// the tenant's plan and a request without any limits removes the override.
+func (h *UpdateLimitsHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	var req UpdateLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	target, ok := userFromParam(c, w.HearthhubDb)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	override := &service.LimitsOverride{
+		UserID:              target.ID,
+		CpuLimit:            req.CpuLimit,
+		MemoryLimit:         req.MemoryLimit,
+		MaxBackups:          req.MaxBackups,
+		MaxWorlds:           req.MaxWorlds,
+		ExistingWorldUpload: req.ExistingWorldUpload,
+		StorageQuotaBytes:   req.StorageQuotaBytes,
+		Reason:              req.Reason,
+		UpdatedBy:           user.DiscordID,
+	}
+	if err := override.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := service.GetLimitsOverride(w.HearthhubDb, target.ID)
+	if err != nil {
+		log.Errorf("failed to get limits override for user %d: %v", target.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update limits"})
+		return
+	}
+
+	if err = service.SaveLimitsOverride(w.HearthhubDb, override); err != nil {
+		log.Errorf("failed to save limits override for user %d: %v", target.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update limits"})
+		return
+	}
+
+	record := service.AuditRecord{
+		Action:     "admin.limits.update",
+		TargetType: "user",
+		TargetID:   target.ID,
+		OwnerID:    target.ID,
+		After:      override,
+		Details:    map[string]string{"reason": req.Reason},
+	}
+	if before != nil {
+		record.Before = before
+	}
+	service.SetAudit(c, record)
+
+	limits, err := service.UserLimits(w.HearthhubDb, w.StripeService, target)
+	if err != nil {
+		log.Errorf("failed to get limits for user %d: %v", target.ID, err)
+		c.JSON(http.StatusOK, gin.H{"override": override})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"override": override, "limits": limits})
+}
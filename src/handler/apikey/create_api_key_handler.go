@@ -0,0 +1,63 @@
+package apikey
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	// ExpiresInDays defaults to 90 days and can be at most 365 days
+	ExpiresInDays *int `json:"expires_in_days,omitempty"`
+}
+
+type CreateAPIKeyHandler struct{}
+
+// HandleRequest Handles the request for creating a personal api key. The key is only returned in this response and is sent as
+// "Authorization: Bearer hh_..." by automation.
+func (h *CreateAPIKeyHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 64 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 1 and 64 characters"})
+		return
+	}
+
+	if err := service.ValidateScopes(req.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ttl := service.DefaultAPIKeyTTL
+	if req.ExpiresInDays != nil {
+		ttl = time.Duration(*req.ExpiresInDays) * 24 * time.Hour
+		if ttl <= 0 || ttl > service.MaxAPIKeyTTL {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expires_in_days must be between 1 and %d", int(service.MaxAPIKeyTTL.Hours()/24))})
+			return
+		}
+	}
+	user := c.MustGet("user").(*model.User)
+
+	key, token, err := service.CreateAPIKey(db, user, name, req.Scopes, ttl)
+	if err != nil {
+		log.Errorf("failed to create api key for user %s: %v", user.DiscordID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "apikey.create", TargetType: "api_key", TargetID: key.ID, After: key})
+	c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": token})
+}
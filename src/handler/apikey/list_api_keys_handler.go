@@ -0,0 +1,26 @@
+package apikey
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type ListAPIKeysHandler struct{}
+
+// HandleRequest Handles the request for listing the user's api keys along with when each was last used. The keys themselves are
+// never returned, only their prefix.
+func (h *ListAPIKeysHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	user := c.MustGet("user").(*model.User)
+
+	keys, err := service.ListAPIKeys(db, user.ID)
+	if err != nil {
+		log.Errorf("failed to list api keys for user %s: %v", user.DiscordID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list api keys"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
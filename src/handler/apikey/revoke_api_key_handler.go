@@ -0,0 +1,39 @@
+package apikey
+
+import (
+	"errors"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type RevokeAPIKeyHandler struct{}
+
+// HandleRequest Handles the request for revoking one of the user's api keys. Revoked keys stay listed so their usage can still
+// be reviewed.
+func (h *RevokeAPIKeyHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	id, err := strconv.ParseUint(c.Param("keyId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key id"})
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	key, err := service.RevokeAPIKey(db, user.ID, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+			return
+		}
+		log.Errorf("failed to revoke api key %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke api key"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "apikey.revoke", TargetType: "api_key", TargetID: key.ID, After: key})
+	c.JSON(http.StatusOK, key)
+}
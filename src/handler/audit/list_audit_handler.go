@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+type ListAuditResponse struct {
+	Entries []service.AuditEntry `json:"entries"`
+	Page    int                  `json:"page"`
+	Limit   int                  `json:"limit"`
+	Total   int64                `json:"total"`
+}
+
+type ListAuditHandler struct{}
+
+// HandleRequest Handles the request for listing the audit trail of the authenticated user newest first. The trail contains the
+// actions the user took and the actions others, such as operators, took on the user's resources. Entries can be filtered by
+// action, target, and request id.
+func (h *ListAuditHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page: must be a positive integer"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit: must be between 1 and %d", maxPageSize)})
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	entries, total, err := service.ListAuditEntries(db, service.AuditFilter{
+		UserID:     user.ID,
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+	}, page, limit)
+	if err != nil {
+		log.Errorf("failed to list audit entries for user %s: %v", user.DiscordID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListAuditResponse{
+		Entries: entries,
+		Page:    page,
+		Limit:   limit,
+		Total:   total,
+	})
+}
@@ -0,0 +1,35 @@
+package catalog
+
+import (
+	"errors"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type GetModHandler struct{}
+
+// HandleRequest Handles the request for the details of a single catalog mod including its available versions.
+func (g *GetModHandler) HandleRequest(c *gin.Context, catalogService *service.CatalogService) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mod id"})
+		return
+	}
+
+	mod, err := catalogService.Get(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "mod not found"})
+			return
+		}
+		log.Errorf("failed to get catalog mod %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get mod"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mod)
+}
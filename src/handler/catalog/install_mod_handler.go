@@ -0,0 +1,60 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type InstallModHandler struct{}
+
+type InstallModRequest struct {
+	Version string `json:"version"`
+}
+
+type InstallModResponse struct {
+	Key          string   `json:"key"`
+	Version      string   `json:"version"`
+	Dependencies []string `json:"dependencies"`
+}
+
+// HandleRequest Handles the request for installing a mod from the catalog. The mod package is downloaded from its source and stored
+// under mods/general/ so it can be installed on a server through the file install route. When no version is given the latest
+// version is installed.
+func (i *InstallModHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mod id"})
+		return
+	}
+
+	var req InstallModRequest
+	if c.Request.ContentLength > 0 {
+		if err = c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("could not parse request body: %v", err)})
+			return
+		}
+	}
+
+	key, version, err := w.CatalogService.Install(c.Request.Context(), w.S3Service, uint(id), req.Version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "mod not found"})
+			return
+		}
+		log.Errorf("failed to install catalog mod %d: %v", id, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("failed to install mod: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, InstallModResponse{
+		Key:          key,
+		Version:      version.Version,
+		Dependencies: version.Dependencies,
+	})
+}
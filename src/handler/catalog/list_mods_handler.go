@@ -0,0 +1,60 @@
+package catalog
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 100
+)
+
+type ListModsHandler struct{}
+
+type ListModsResponse struct {
+	Mods  []service.CatalogMod `json:"mods"`
+	Page  int                  `json:"page"`
+	Limit int                  `json:"limit"`
+	Total int64                `json:"total"`
+}
+
+// HandleRequest Handles the request for searching the mod catalog. Mods can be searched by name, author, or summary with the
+// q query parameter and filtered by source (nexus, thunderstore). Results are ordered by their total downloads.
+func (l *ListModsHandler) HandleRequest(c *gin.Context, catalogService *service.CatalogService) {
+	source := c.Query("source")
+	if source != "" && source != service.CatalogSourceNexus && source != service.CatalogSourceThunderstore {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid source: %s, must be one of: nexus, thunderstore", source)})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page: must be a positive integer"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit: must be between 1 and %d", maxPageSize)})
+		return
+	}
+
+	mods, total, err := catalogService.Search(c.Query("q"), source, page, limit)
+	if err != nil {
+		log.Errorf("failed to search mod catalog: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search mod catalog"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListModsResponse{
+		Mods:  mods,
+		Page:  page,
+		Limit: limit,
+		Total: total,
+	})
+}
@@ -11,6 +11,12 @@ import (
 
 type AuthHandler struct{}
 
+// AuthResponse is the authenticated user along with their current storage usage.
+type AuthResponse struct {
+	*model.User
+	Storage *service.StorageUsage `json:"storage"`
+}
+
 // HandleRequest Authenticates that a refresh token is valid for a given user id. This returns the entire
 // user object with a refreshed access token.
 func (h *AuthHandler) HandleRequest(c *gin.Context, ctx context.Context, wrapper *service.Wrapper) {
@@ -42,7 +48,7 @@ func (h *AuthHandler) HandleRequest(c *gin.Context, ctx context.Context, wrapper
 		return
 	}
 
-	limits, err := wrapper.StripeService.GetSubscriptionLimits(user.SubscriptionId)
+	limits, err := service.UserLimits(wrapper.HearthhubDb, wrapper.StripeService, user)
 	if err != nil {
 		log.Errorf("failed to get sub limits for sub id: %s, error: %v", user.SubscriptionId, err)
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -53,5 +59,12 @@ func (h *AuthHandler) HandleRequest(c *gin.Context, ctx context.Context, wrapper
 
 	user.SubscriptionLimits = *limits
 	user.SubscriptionStatus = status
-	c.JSON(http.StatusOK, user)
+
+	storage, err := service.LoadStorageUsage(wrapper.HearthhubDb, wrapper.S3Service, wrapper.StripeService, user)
+	if err != nil {
+		// Storage usage is informational on this route so failures should not block authentication
+		log.Errorf("failed to load storage usage for user: %s, error: %v", user.DiscordID, err)
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{User: service.RedactUser(user), Storage: storage})
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/cbartram/hearthhub-common/model"
 	common "github.com/cbartram/hearthhub-common/service"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"github.com/stripe/stripe-go/v81"
@@ -94,7 +95,7 @@ func (h *CreateUserRequestHandler) HandleRequest(c *gin.Context, ctx context.Con
 			return
 		}
 
-		c.JSON(http.StatusOK, newUser)
+		c.JSON(http.StatusOK, service.RedactUser(&newUser))
 	} else {
 		log.Infof("user already exists, refreshing session")
 		creds, err := cognitoService.RefreshSession(ctx, reqBody.DiscordID)
@@ -113,6 +114,6 @@ func (h *CreateUserRequestHandler) HandleRequest(c *gin.Context, ctx context.Con
 			TokenExpiration: creds.TokenExpiration,
 		}
 
-		c.JSON(http.StatusOK, user)
+		c.JSON(http.StatusOK, service.RedactUser(&user))
 	}
 }
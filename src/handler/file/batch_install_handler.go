@@ -0,0 +1,331 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBatchSize is the most files which can be installed or removed in a single batch.
+const maxBatchSize = 50
+
+type BatchInstallRequest struct {
+	Items []FilePayload `json:"items"`
+	Force bool          `json:"force"`
+}
+
+// BatchStep is a single file operation in a batch after dependencies have been resolved.
+type BatchStep struct {
+	Payload    FilePayload
+	Manifest   *service.PackageManifest
+	Dependency bool
+}
+
+type BatchInstallHandler struct{}
+
+// HandleRequest Handles the request for installing or removing many files at once i.e. a modpack. Every file is applied in
+// order by a single job while the server is stopped so the PVC is only claimed once and the server is only restarted once.
+// Each file is reported as an item of the returned batch operation.
+func (h *BatchInstallHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	var req BatchInstallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	if len(req.Items) == 0 || len(req.Items) > maxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("items must contain between 1 and %d files", maxBatchSize)})
+		return
+	}
+
+	for i, item := range req.Items {
+		if err := item.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid item %d: %v", i, err)})
+			return
+		}
+	}
+
+	tmp, exists := c.Get("user")
+	if !exists {
+		log.Errorf("user not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	user := tmp.(*model.User)
+
+	for i, item := range req.Items {
+		if !service.CanInstallKey(user.DiscordID, *item.Prefix) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("item %d is not one of your files or a shared mod", i)})
+			return
+		}
+	}
+
+	if len(user.Servers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no server to install files on"})
+		return
+	}
+	server := &user.Servers[0]
+
+	steps, conflicts, err := PlanBatch(c.Request.Context(), w, user, server, req.Items)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("failed to resolve dependencies: %v", err)})
+		return
+	}
+
+	if len(conflicts) > 0 && !req.Force {
+		c.JSON(http.StatusConflict, gin.H{"error": "batch conflicts with installed mods", "conflicts": conflicts})
+		return
+	}
+
+	RunBatch(c, w, user, server, steps, conflicts)
+}
+
+// PlanBatch Expands the files in a batch into the ordered steps needed to apply them. Plugins have their dependencies resolved
+// against the mods on the server and the plugins earlier in the batch. Removing a mod which is still depended on by a mod
+// that is not also being removed is reported as a conflict. Files must be shared mods or belong to the user since their packages
+// are read to resolve dependencies.
+func PlanBatch(ctx context.Context, w *service.Wrapper, user *model.User, server *model.Server, items []FilePayload) ([]BatchStep, []string, error) {
+	for _, item := range items {
+		if !service.CanInstallKey(user.DiscordID, *item.Prefix) {
+			return nil, nil, fmt.Errorf("%s is not one of your files or a shared mod", *item.Prefix)
+		}
+	}
+
+	installed, err := service.ListInstalledFiles(w.HearthhubDb, server.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deleting := map[string]bool{}
+	for _, item := range items {
+		if item.Operation == "delete" {
+			deleting[*item.Prefix] = true
+		}
+	}
+
+	var remaining []service.InstalledFile
+	for _, f := range installed {
+		if !deleting[f.Prefix] {
+			remaining = append(remaining, f)
+		}
+	}
+
+	source := &service.S3PackageSource{S3Service: w.S3Service, CatalogService: w.CatalogService, MaxSize: MaxUploadSize}
+	planned := map[string]bool{}
+	var steps []BatchStep
+	var conflicts []string
+
+	for _, item := range items {
+		switch {
+		case item.Operation == "delete":
+			for _, f := range installed {
+				if f.Prefix != *item.Prefix {
+					continue
+				}
+				if dependents := service.FindDependents(remaining, f.Name); len(dependents) > 0 {
+					conflicts = append(conflicts, fmt.Sprintf("%s is required by: %s", f.Name, strings.Join(dependents, ", ")))
+				}
+			}
+			steps = append(steps, BatchStep{Payload: item})
+		case strings.HasPrefix(item.Destination, service.PluginsDestination):
+			plan, err := service.ResolveInstall(ctx, source, remaining, *item.Prefix)
+			if err != nil {
+				return nil, nil, err
+			}
+			conflicts = append(conflicts, plan.Conflicts...)
+
+			for _, step := range plan.Steps {
+				if planned[step.Prefix] {
+					continue
+				}
+				planned[step.Prefix] = true
+
+				payload := item
+				prefix := step.Prefix
+				payload.Prefix = &prefix
+				if step.Dependency {
+					payload.Destination = service.PluginsDestination
+					payload.IsArchive = strings.HasSuffix(strings.ToLower(prefix), ".zip")
+				}
+
+				steps = append(steps, BatchStep{Payload: payload, Manifest: step.Manifest, Dependency: step.Dependency})
+
+				// Later items in the batch resolve against the plugins planned so far
+				remaining = append(remaining, service.InstalledFile{
+					Prefix:       prefix,
+					Name:         step.Manifest.Name,
+					Version:      step.Manifest.Version,
+					Dependencies: step.Manifest.Dependencies,
+					DLLs:         step.Manifest.DLLs,
+				})
+			}
+		default:
+			steps = append(steps, BatchStep{Payload: item})
+		}
+	}
+
+	return steps, conflicts, nil
+}
+
+// RunBatch Starts a batch for the steps and responds with the batch operation. The operation controller starts the server
+// again once the job finishes.
+func RunBatch(c *gin.Context, w *service.Wrapper, user *model.User, server *model.Server, steps []BatchStep, warnings []string) {
+	batch, err := StartBatch(c.Request.Context(), w, user, service.Actor(c), server, steps, false, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      fmt.Sprintf("batch job created: %s", batch.JobName),
+		"operation_id": batch.ID,
+		"items":        batch.Items,
+		"warnings":     warnings,
+	})
+}
+
+// StartBatch Stops the server, creates the batch job, and records a batch operation with an item for each step. The server is
+// restored to its previous number of replicas once the job finishes, or started when start is set and the server was stopped.
+// The actor is the user who started the batch, which differs from the user for members of an organization the server is shared with.
+// Metadata is recorded on the batch operation along with the replicas to restore.
+func StartBatch(ctx context.Context, w *service.Wrapper, user, actor *model.User, server *model.Server, steps []BatchStep, start bool, metadata map[string]string) (*service.Operation, error) {
+	clientset := w.KubeService.GetClient()
+
+	deployment := server.DeploymentName
+	if deployment == "" {
+		deployment = fmt.Sprintf("valheim-%s", user.DiscordID)
+	}
+
+	previous, err := service.ScaleDeployment(ctx, clientset, deployment, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not stop server for batch: %v", err)
+	}
+
+	restore := previous
+	if start && restore == 0 {
+		restore = 1
+	}
+
+	payloads := make([]FilePayload, 0, len(steps))
+	for _, step := range steps {
+		payloads = append(payloads, step.Payload)
+	}
+
+	name, err := CreateBatchFileJob(clientset, payloads, user)
+	if err != nil {
+		if _, scaleErr := service.ScaleDeployment(ctx, clientset, deployment, previous); scaleErr != nil {
+			log.Errorf("failed to restart server after batch job creation failed: %v", scaleErr)
+		}
+		return nil, fmt.Errorf("could not create batch job: %v", err)
+	}
+
+	items := make([]service.Operation, 0, len(steps))
+	for i := range steps {
+		recordFile(ctx, w, user, server, &steps[i].Payload, steps[i].Manifest, *name)
+		item := service.Operation{
+			UserID:    user.ID,
+			DiscordID: user.DiscordID,
+			ServerID:  server.ID,
+			Type:      operationType(&steps[i].Payload),
+			Target:    *steps[i].Payload.Prefix,
+			JobName:   *name,
+		}
+		item.SetActor(actor)
+		items = append(items, item)
+	}
+
+	batch := &service.Operation{
+		UserID:    user.ID,
+		DiscordID: user.DiscordID,
+		ServerID:  server.ID,
+		Type:      service.OperationTypeBatch,
+		Target:    fmt.Sprintf("%d files", len(steps)),
+		JobName:   *name,
+		Metadata: map[string]string{
+			"deployment":       deployment,
+			"restore_replicas": strconv.Itoa(int(restore)),
+		},
+	}
+	for k, v := range metadata {
+		batch.Metadata[k] = v
+	}
+	batch.SetActor(actor)
+	if err = w.OperationService.CreateBatch(batch, items); err != nil {
+		log.Errorf("failed to create batch operation for job %s: %v", *name, err)
+		return nil, fmt.Errorf("batch job %s created but the operation could not be recorded", *name)
+	}
+
+	return batch, nil
+}
+
+// operationType Returns the operation type for a file payload.
+func operationType(payload *FilePayload) string {
+	switch payload.Operation {
+	case "delete":
+		return service.OperationTypeDelete
+	case "copy":
+		return service.OperationTypeCopy
+	default:
+		return service.OperationTypeInstall
+	}
+}
+
+// recordFile Records the file a job installs on the server. Files being removed are pointed at the removing job so the
+// record is deleted once the job succeeds.
+func recordFile(ctx context.Context, w *service.Wrapper, user *model.User, server *model.Server, payload *FilePayload, manifest *service.PackageManifest, jobName string) {
+	if !service.CanInstallKey(user.DiscordID, *payload.Prefix) {
+		log.Warnf("not recording %s on server %d, it is not a file of user %s or a shared mod", *payload.Prefix, server.ID, user.DiscordID)
+		return
+	}
+
+	if payload.Operation == "delete" {
+		err := w.HearthhubDb.Model(&service.InstalledFile{}).
+			Where("server_id = ? AND prefix = ?", server.ID, *payload.Prefix).
+			Update("job_name", jobName).Error
+		if err != nil {
+			log.Errorf("failed to update installed file %s: %v", *payload.Prefix, err)
+		}
+		return
+	}
+
+	// Only mods and configs are tracked, world files are managed by the server and its backups
+	if !strings.HasPrefix(payload.Destination, service.PluginsDestination) && !strings.HasPrefix(payload.Destination, service.ConfigDestination) {
+		return
+	}
+
+	if manifest == nil {
+		base := path.Base(*payload.Prefix)
+		manifest = &service.PackageManifest{Name: strings.TrimSuffix(base, path.Ext(base))}
+	}
+
+	// The S3 ETag is the MD5 of the file for single part uploads which is compared against the PVC during reconciles
+	var checksum string
+	if obj, err := w.S3Service.StatObject(ctx, *payload.Prefix); err == nil {
+		checksum = obj.ETag
+	}
+
+	err := service.SaveInstalledFile(w.HearthhubDb, &service.InstalledFile{
+		ServerID:     server.ID,
+		Prefix:       *payload.Prefix,
+		Destination:  payload.Destination,
+		Name:         manifest.Name,
+		Version:      manifest.Version,
+		Dependencies: manifest.Dependencies,
+		DLLs:         manifest.DLLs,
+		Checksum:     checksum,
+		JobName:      jobName,
+		Status:       service.InstallStatusPending,
+		InstalledAt:  time.Now(),
+	})
+	if err != nil {
+		log.Errorf("failed to record installed file %s: %v", *payload.Prefix, err)
+	}
+}
@@ -0,0 +1,171 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"path/filepath"
+)
+
+type CompleteUploadHandler struct{}
+
+type CompleteUploadRequest struct {
+	Files []FileMetadata `json:"files"`
+}
+
+// UploadResult Describes the outcome of validating a single uploaded file.
+type UploadResult struct {
+	Name        string `json:"name"`
+	Prefix      string `json:"prefix"`
+	Size        int64  `json:"size"`
+	Valid       bool   `json:"valid"`
+	Quarantined bool   `json:"quarantined"`
+	Error       string `json:"error,omitempty"`
+}
+
+// HandleRequest Called by the client after a presigned PUT finishes. Each uploaded object is verified to exist in S3, to match the
+// size the client declared, and to have valid contents for its extension. Objects which fail validation are moved to the quarantine
+// prefix so that they can never be installed onto a server and the user is notified over their websocket connection.
+func (h *CompleteUploadHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	bodyRaw, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		log.Errorf("could not read body from request: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("could not read body from request: %v", err)})
+		return
+	}
+
+	var reqBody CompleteUploadRequest
+	if err := json.Unmarshal(bodyRaw, &reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	if len(reqBody.Files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one file is required"})
+		return
+	}
+
+	tmp, exists := c.Get("user")
+	if !exists {
+		log.Errorf("user not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found in context"})
+		return
+	}
+
+	user := tmp.(*model.User)
+	usage, err := service.LoadStorageUsage(w.HearthhubDb, w.S3Service, w.StripeService, user)
+	if err != nil {
+		log.Errorf("failed to get user storage usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user storage usage"})
+		return
+	}
+
+	results := make([]UploadResult, 0, len(reqBody.Files))
+	for _, file := range reqBody.Files {
+		// Users may only complete uploads for objects under their own prefixes
+		if !service.OwnsStorageKey(user.DiscordID, file.Prefix) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("prefix: %s does not belong to user", file.Prefix)})
+			return
+		}
+
+		results = append(results, CompleteUpload(c.Request.Context(), w, user, file, usage))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": results})
+}
+
+// CompleteUpload Verifies a single uploaded object and quarantines it when the object is invalid or storing it would exceed
+// the user's storage quota. The object's size is added to usage, which is updated in place so the next file in the same
+// request is checked against it.
+func CompleteUpload(ctx context.Context, w *service.Wrapper, user *model.User, file FileMetadata, usage *service.StorageUsage) UploadResult {
+	s3Service := w.S3Service
+	result := UploadResult{
+		Name:   file.Name,
+		Prefix: file.Prefix,
+	}
+
+	size, err := s3Service.HeadObject(ctx, file.Prefix)
+	if err != nil {
+		log.Errorf("uploaded object: %s not found: %v", file.Prefix, err)
+		result.Error = "uploaded object not found"
+		return result
+	}
+	result.Size = size
+
+	validationErr := validateUploadMetadata(file, size)
+	if validationErr == nil {
+		data, err := s3Service.GetObject(ctx, file.Prefix, MaxUploadSize)
+		if err != nil {
+			log.Errorf("failed to download uploaded object: %s: %v", file.Prefix, err)
+			result.Error = "failed to download uploaded object"
+			return result
+		}
+		validationErr = service.ValidateFileContents(filepath.Ext(file.Prefix), data)
+	}
+
+	if validationErr == nil && service.StorageCategoryForKey(file.Prefix) != "" {
+		// Re-uploads of an existing key are counted twice until usage is next rebuilt from S3 by the storage recalculation
+		// controller.
+		if err = service.AddStorageUsage(w.HearthhubDb, user.ID, file.Prefix, size); err != nil {
+			log.Errorf("failed to update storage usage for user: %s: %v", user.DiscordID, err)
+		}
+		usage.Add(file.Prefix, size)
+
+		if usage.TotalBytes() > usage.QuotaBytes {
+			validationErr = fmt.Errorf("storage quota exceeded: %d/%d bytes used", usage.TotalBytes(), usage.QuotaBytes)
+			if err = service.AddStorageUsage(w.HearthhubDb, user.ID, file.Prefix, -size); err != nil {
+				log.Errorf("failed to update storage usage for user: %s: %v", user.DiscordID, err)
+			}
+			usage.Add(file.Prefix, -size)
+		}
+	}
+
+	if validationErr == nil {
+		result.Valid = true
+		return result
+	}
+
+	log.Infof("uploaded object: %s failed validation: %v", file.Prefix, validationErr)
+	result.Error = validationErr.Error()
+
+	err = s3Service.MoveObject(ctx, file.Prefix, QuarantinePrefix+file.Prefix)
+	if err != nil {
+		log.Errorf("failed to quarantine object: %s: %v", file.Prefix, err)
+		return result
+	}
+	result.Quarantined = true
+
+	if w.RabbitMQService != nil {
+		err = w.RabbitMQService.PublishUserEvent(user.DiscordID, "FileQuarantined", result)
+		if err != nil {
+			log.Errorf("failed to notify user: %s of quarantined file: %v", user.DiscordID, err)
+		}
+	}
+
+	return result
+}
+
+// validateUploadMetadata Checks the size and extension of an uploaded object before its contents are downloaded.
+func validateUploadMetadata(file FileMetadata, size int64) error {
+	if file.Size > 0 && int64(file.Size) != size {
+		return fmt.Errorf("uploaded size %d does not match declared size %d", size, file.Size)
+	}
+
+	if size > MaxUploadSize {
+		return errors.New("file size is too large. Maximum size is 30MB")
+	}
+
+	ext := filepath.Ext(file.Prefix)
+	if _, ok := ValidExtensions[ext]; !ok {
+		return fmt.Errorf("invalid file extension: %s", ext)
+	}
+
+	return nil
+}
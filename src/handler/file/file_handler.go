@@ -1,15 +1,34 @@
 package file
 
 import (
+	"context"
 	"fmt"
 	"github.com/cbartram/hearthhub-common/model"
 	"github.com/cbartram/hearthhub-mod-api/src/service"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 )
 
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+const (
+	sortName = "name"
+	sortAsc  = "asc"
+	sortDesc = "desc"
+)
+
+// listQueryParams are the query parameters which opt a request into the paginated response. Requests without any of
+// them get the original response with every file grouped by category.
+var listQueryParams = []string{"category", "ext", "sort", "limit", "cursor"}
+
 type FileHandler struct{}
 
 type Response struct {
@@ -18,8 +37,23 @@ type Response struct {
 	Configs []service.SimpleS3Object `json:"configs"`
 }
 
-// HandleRequest Handles the request for listing files under a given prefix. Since this route is deployed
-// to a lambda function and backed by the Cognito Authorizer only authorized users can invoke this.
+type PageResponse struct {
+	Files      []service.SimpleS3Object `json:"files"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// ListOptions are the filters, sort order, and page position parsed from the query string of a file listing request.
+type ListOptions struct {
+	Categories []string
+	Extensions map[string]bool
+	Sort       string
+	Limit      int
+	Cursor     *service.Cursor
+}
+
+// HandleRequest Handles the request for listing the user's files. Without query parameters every file is returned grouped
+// by category. When any of category, ext, sort, limit, or cursor is given a single page of files is returned instead. Pass
+// the returned next_cursor as the cursor query parameter to get the next page.
 func (f *FileHandler) HandleRequest(c *gin.Context, s3Client *service.S3Service) {
 	tmp, exists := c.Get("user")
 	if !exists {
@@ -30,7 +64,26 @@ func (f *FileHandler) HandleRequest(c *gin.Context, s3Client *service.S3Service)
 
 	user := tmp.(*model.User)
 
-	res, err := ListAllObjects(s3Client, user.DiscordID)
+	if !IsPageRequest(c) {
+		res, err := ListAllObjects(s3Client, user.DiscordID)
+		if err != nil {
+			log.Errorf("failed to list s3 objects: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("failed to list s3 objects: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	opts, err := ParseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := ListObjects(c.Request.Context(), s3Client, user.DiscordID, opts)
 	if err != nil {
 		log.Errorf("failed to list s3 objects: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -41,6 +94,153 @@ func (f *FileHandler) HandleRequest(c *gin.Context, s3Client *service.S3Service)
 	c.JSON(http.StatusOK, res)
 }
 
+// IsPageRequest Returns true when the request sends any of the pagination or filter query parameters.
+func IsPageRequest(c *gin.Context) bool {
+	for _, param := range listQueryParams {
+		if _, ok := c.GetQuery(param); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseListOptions Parses and validates the category, ext, sort, limit, and cursor query parameters.
+func ParseListOptions(c *gin.Context) (*ListOptions, error) {
+	opts := &ListOptions{
+		Categories: []string{service.StorageCategoryMods, service.StorageCategoryConfigs, service.StorageCategoryBackups},
+		Extensions: map[string]bool{},
+		Sort:       sortName,
+		Limit:      defaultPageSize,
+	}
+
+	if category := c.Query("category"); category != "" {
+		opts.Categories = nil
+		for _, cat := range strings.Split(category, ",") {
+			if _, ok := categoryPrefixes(cat, ""); !ok {
+				return nil, fmt.Errorf("invalid category: %s, must be one of: mods, configs, backups", cat)
+			}
+			opts.Categories = append(opts.Categories, cat)
+		}
+	}
+
+	if ext := c.Query("ext"); ext != "" {
+		for _, e := range strings.Split(ext, ",") {
+			if !strings.HasPrefix(e, ".") {
+				e = "." + e
+			}
+			if _, ok := ValidExtensions[e]; !ok {
+				return nil, fmt.Errorf("invalid extension: %s", e)
+			}
+			opts.Extensions[e] = true
+		}
+	}
+
+	switch sort := c.DefaultQuery("sort", sortName); sort {
+	case sortName, sortAsc, sortDesc:
+		opts.Sort = sort
+	default:
+		return nil, fmt.Errorf("invalid sort: must be one of: name, asc, desc")
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxPageSize {
+			return nil, fmt.Errorf("invalid limit: must be between 1 and %d", maxPageSize)
+		}
+		opts.Limit = l
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		decoded, err := service.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		opts.Cursor = decoded
+	}
+
+	return opts, nil
+}
+
+// categoryPrefixes Returns the S3 prefixes which hold files for a category. Mods include both the shared mods everyone can
+// install and the mods a user has uploaded.
+func categoryPrefixes(category, discordId string) ([]string, bool) {
+	switch category {
+	case service.StorageCategoryMods:
+		return []string{"mods/general/", fmt.Sprintf("mods/%s/", discordId)}, true
+	case service.StorageCategoryConfigs:
+		return []string{fmt.Sprintf("config/%s/", discordId)}, true
+	case service.StorageCategoryBackups:
+		return []string{fmt.Sprintf("valheim-backups-auto/%s/", discordId)}, true
+	default:
+		return nil, false
+	}
+}
+
+// ListObjects Lists only the prefixes for the requested categories, filters by extension, and returns a single page. Pages
+// sorted by name are read from S3 in key order starting after the cursor. Sorting by last modified time (asc or desc)
+// requires reading the requested categories in full since S3 only lists objects in key order.
+func ListObjects(ctx context.Context, s3Client *service.S3Service, discordId string, opts *ListOptions) (*PageResponse, error) {
+	keep := func(obj service.SimpleS3Object) bool {
+		return len(opts.Extensions) == 0 || opts.Extensions[filepath.Ext(obj.Key)]
+	}
+
+	categories := map[string]string{}
+	var prefixes []string
+	for _, category := range opts.Categories {
+		p, _ := categoryPrefixes(category, discordId)
+		for _, prefix := range p {
+			categories[prefix] = category
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	var page []service.SimpleS3Object
+	var next *service.Cursor
+	if opts.Sort == sortName {
+		var err error
+		page, next, err = service.PageObjectsByKey(prefixes, opts.Cursor, opts.Limit, func(prefix, startAfter string, limit int) ([]service.SimpleS3Object, error) {
+			listed, err := s3Client.ListObjectsAfter(ctx, prefix, startAfter, limit, keep)
+			for i := range listed {
+				listed[i].Category = categories[prefix]
+			}
+			return listed, err
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var objects []service.SimpleS3Object
+		for _, prefix := range prefixes {
+			listed, err := s3Client.ListObjects(prefix)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, obj := range listed {
+				if !keep(obj) {
+					continue
+				}
+				obj.Category = categories[prefix]
+				objects = append(objects, obj)
+			}
+		}
+		page, next = service.PageObjects(objects, opts.Sort == sortDesc, opts.Cursor, opts.Limit)
+	}
+
+	response := &PageResponse{
+		Files: make([]service.SimpleS3Object, 0, len(page)),
+	}
+	response.Files = append(response.Files, page...)
+
+	if next != nil {
+		response.NextCursor = next.Encode()
+	}
+
+	return response, nil
+}
+
+// ListAllObjects Lists every file the user can see grouped by category. This is the response for requests without
+// pagination or filter query parameters.
 func ListAllObjects(s3Client *service.S3Service, discordId string) (*Response, error) {
 	var wg sync.WaitGroup
 	modsChan := make(chan []service.SimpleS3Object, 2)
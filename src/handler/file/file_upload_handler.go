@@ -7,6 +7,7 @@ import (
 	"github.com/cbartram/hearthhub-mod-api/src/service"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 	"io"
 	"net/http"
 	"path/filepath"
@@ -20,6 +21,12 @@ var ValidExtensions = map[string]bool{
 	".cfg": true,
 }
 
+// MaxUploadSize is the largest file (30MB) users are allowed to upload.
+const MaxUploadSize = 30 << 20
+
+// QuarantinePrefix is where uploaded objects which fail validation are moved so they can never be installed.
+const QuarantinePrefix = "quarantine/"
+
 type UploadFileHandler struct{}
 type FileMetadata struct {
 	Name   string `json:"name"`
@@ -28,7 +35,7 @@ type FileMetadata struct {
 }
 
 // HandleRequest Generates a signed url which can be used to upload a file directly to S3.
-func (u *UploadFileHandler) HandleRequest(c *gin.Context, s3Client *service.S3Service, stripeService *service.StripeService) {
+func (u *UploadFileHandler) HandleRequest(c *gin.Context, s3Client *service.S3Service, stripeService *service.StripeService, db *gorm.DB) {
 	bodyRaw, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		log.Errorf("could not read body from request: %s", err)
@@ -50,18 +57,43 @@ func (u *UploadFileHandler) HandleRequest(c *gin.Context, s3Client *service.S3Se
 	}
 
 	user := tmp.(*model.User)
-	limits, err := stripeService.GetSubscriptionLimits(user.SubscriptionId)
+	limits, err := service.UserLimits(db, stripeService, user)
 	if err != nil {
 		log.Errorf("failed to get user subscription limits: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user subscription limits"})
 		return
 	}
 
+	// Reject the whole request up front if the declared file sizes would push the user over their storage quota. Sizes are
+	// verified again once the upload completes.
+	var declaredBytes int64
+	for _, file := range reqBody["files"] {
+		if service.StorageCategoryForKey(file.Prefix) != "" {
+			declaredBytes += int64(file.Size)
+		}
+	}
+
+	if declaredBytes > 0 {
+		usage, err := service.LoadStorageUsage(db, s3Client, stripeService, user)
+		if err != nil {
+			log.Errorf("failed to get user storage usage: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user storage usage"})
+			return
+		}
+
+		if usage.TotalBytes()+declaredBytes > usage.QuotaBytes {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("storage quota exceeded: %d/%d bytes used", usage.TotalBytes(), usage.QuotaBytes),
+			})
+			return
+		}
+	}
+
 	var urls = make(map[string]string)
 	for _, file := range reqBody["files"] {
-		// This is equivalent to multiplying 10 by 2^20 (2 to the power of 20)
-		// Since 2^20 = 1,048,576 (approximately 1 million), this gives us 10 megabytes in bytes
-		if file.Size > 30<<20 {
+		// This is equivalent to multiplying 30 by 2^20 (2 to the power of 20)
+		// Since 2^20 = 1,048,576 (approximately 1 million), this gives us 30 megabytes in bytes
+		if file.Size > MaxUploadSize {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": fmt.Sprintf("%s file size is too large. Maximum size is 30MB", file.Name),
 			})
@@ -24,12 +24,16 @@ import (
 	"strings"
 )
 
+// restartFlagVersion is the first plugin-manager release with the -restart flag which lets batch items skip restarting the server.
+const restartFlagVersion = "0.0.38"
+
 type FilePayload struct {
 	Prefix      *string `json:"prefix"`
 	Destination string  `json:"destination"`
 	IsArchive   bool    `json:"is_archive"`
 	Operation   string  `json:"operation"`
 	S3Delete    bool    `json:"s3Delete"`
+	Force       bool    `json:"force"`
 }
 
 // Validate Validates that the payload provide is not malformed or missing information.
@@ -73,7 +77,12 @@ func (f *FilePayload) Validate() error {
 
 type InstallFileHandler struct{}
 
-func (h *InstallFileHandler) HandleRequest(c *gin.Context, kubeService service.KubernetesService, s3Service *service.S3Service) {
+// HandleRequest Handles the request for installing or removing a file on the user's server. Plugins have their dependencies
+// resolved against the mods already installed on the server and missing dependencies are installed first. Version conflicts,
+// duplicate DLLs, and removing a mod other mods depend on are refused unless force is set in which case they are returned as warnings.
+func (h *InstallFileHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	s3Service := w.S3Service
+	db := w.HearthhubDb
 	bodyRaw, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		log.Errorf("could not read body from request: %s", err)
@@ -96,9 +105,24 @@ func (h *InstallFileHandler) HandleRequest(c *gin.Context, kubeService service.K
 	if !exists {
 		log.Errorf("user not found in context")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
 	}
 	user := tmp.(*model.User)
 
+	if !service.CanInstallKey(user.DiscordID, *reqBody.Prefix) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "prefix is not one of your files or a shared mod"})
+		return
+	}
+
+	// Objects deleted from S3 are recorded even when the file job cannot be created afterward
+	audit := map[string]string{"destination": reqBody.Destination}
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "file." + reqBody.Operation,
+		TargetType: "file",
+		TargetID:   *reqBody.Prefix,
+		Details:    audit,
+	})
+
 	if reqBody.S3Delete {
 		log.Infof("removing files with prefix: %s from S3", *reqBody.Prefix)
 		if strings.HasSuffix(*reqBody.Prefix, ".db") || strings.HasSuffix(*reqBody.Prefix, ".fwl") {
@@ -127,6 +151,10 @@ func (h *InstallFileHandler) HandleRequest(c *gin.Context, kubeService service.K
 						log.Errorf("failed to delete object %s: %v", obj.Key, err)
 						continue
 					}
+					audit["s3_deleted"] = strings.TrimPrefix(audit["s3_deleted"]+","+obj.Key, ",")
+					if err = service.AddStorageUsage(db, user.ID, obj.Key, -obj.Size); err != nil {
+						log.Errorf("failed to update storage usage after deleting %s: %v", obj.Key, err)
+					}
 				} else if strings.HasPrefix(filename, fmt.Sprintf("%s_backup_auto-", reqBodyFileName)) && (strings.HasSuffix(filename, ".db") || strings.HasSuffix(filename, ".fwl")) {
 					log.Infof("deleting object: %s", obj.Key)
 					err := s3Service.DeleteObject(context.Background(), obj.Key)
@@ -134,6 +162,10 @@ func (h *InstallFileHandler) HandleRequest(c *gin.Context, kubeService service.K
 						log.Errorf("failed to delete object %s: %v", obj.Key, err)
 						continue
 					}
+					audit["s3_deleted"] = strings.TrimPrefix(audit["s3_deleted"]+","+obj.Key, ",")
+					if err = service.AddStorageUsage(db, user.ID, obj.Key, -obj.Size); err != nil {
+						log.Errorf("failed to update storage usage after deleting %s: %v", obj.Key, err)
+					}
 				}
 			}
 
@@ -142,21 +174,123 @@ func (h *InstallFileHandler) HandleRequest(c *gin.Context, kubeService service.K
 		}
 	}
 
-	name, err := CreateFileJob(kubeService.GetClient(), &reqBody, user)
+	if strings.HasPrefix(reqBody.Destination, service.PluginsDestination) && len(user.Servers) > 0 {
+		h.installPlugin(c, w, &reqBody, user, &user.Servers[0])
+		return
+	}
+
+	var server *model.Server
+	if len(user.Servers) > 0 {
+		server = &user.Servers[0]
+	}
+
+	op, err := StartFileJob(c.Request.Context(), w, user, service.Actor(c), server, &reqBody, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("could not create file management job: %v", err)})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": fmt.Sprintf("file %s job created: %s", reqBody.Operation, *name)})
+	audit["job"] = op.JobName
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      fmt.Sprintf("file %s job created: %s", reqBody.Operation, op.JobName),
+		"operation_id": op.ID,
+	})
+}
+
+// installPlugin Installs or removes a plugin while keeping the server's dependency graph intact. A plugin with missing
+// dependencies is installed as a batch so the dependencies are installed first in the same job.
+func (h *InstallFileHandler) installPlugin(c *gin.Context, w *service.Wrapper, payload *FilePayload, user *model.User, server *model.Server) {
+	steps, conflicts, err := PlanBatch(c.Request.Context(), w, user, server, []FilePayload{*payload})
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("failed to resolve dependencies: %v", err)})
+		return
+	}
+
+	if len(conflicts) > 0 && !payload.Force {
+		c.JSON(http.StatusConflict, gin.H{"error": "mod conflicts with installed mods", "conflicts": conflicts})
+		return
+	}
+
+	if len(steps) > 1 {
+		RunBatch(c, w, user, server, steps, conflicts)
+		return
+	}
+
+	step := steps[0]
+	op, err := StartFileJob(c.Request.Context(), w, user, service.Actor(c), server, &step.Payload, step.Manifest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("could not create file management job: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      fmt.Sprintf("file %s job created: %s", payload.Operation, op.JobName),
+		"operation_id": op.ID,
+		"warnings":     conflicts,
+	})
+}
+
+// StartFileJob Creates a job which applies a single file to the user's server, records the file as installed on the server,
+// and tracks the job as an operation. The server may be nil for users who have not created a server yet. The actor is the user
+// who started the job, which differs from the user for members of an organization the server is shared with.
+func StartFileJob(ctx context.Context, w *service.Wrapper, user, actor *model.User, server *model.Server, payload *FilePayload, manifest *service.PackageManifest) (*service.Operation, error) {
+	name, err := CreateFileJob(w.KubeService.GetClient(), payload, user)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &service.Operation{
+		UserID:    user.ID,
+		DiscordID: user.DiscordID,
+		Type:      operationType(payload),
+		Target:    *payload.Prefix,
+		JobName:   *name,
+	}
+	op.SetActor(actor)
+	if server != nil {
+		op.ServerID = server.ID
+		recordFile(ctx, w, user, server, payload, manifest, *name)
+	}
+
+	if err = w.OperationService.Create(op); err != nil {
+		log.Errorf("failed to create operation for job %s: %v", *name, err)
+	}
+	return op, nil
 }
 
 // CreateFileJob Creates a new kubernetes job which attaches the valheim src PVC, downloads mods from S3,
 // and installs mods onto the PVC before restarting the Valheim src.
 func CreateFileJob(clientset kubernetes.Interface, payload *FilePayload, user *model.User) (*string, error) {
+	return createJob(clientset, user, "mod-install", nil, fileContainer("main", payload, user, false))
+}
+
+// CreateBatchFileJob Creates a single job which applies every payload in order. Each payload runs in its own init container so
+// a failure stops the remaining payloads and the exit status of each one can be reported. The last payload runs as the main container.
+// Items do not restart the server themselves when the plugin-manager supports it, the operation controller starts it once after
+// the whole batch has finished.
+func CreateBatchFileJob(clientset kubernetes.Interface, payloads []FilePayload, user *model.User) (*string, error) {
+	if len(payloads) == 0 {
+		return nil, errors.New("batch must contain at least one file")
+	}
+
+	var initContainers []corev1.Container
+	for i := range payloads[:len(payloads)-1] {
+		initContainers = append(initContainers, fileContainer(service.BatchContainerName(i), &payloads[i], user, true))
+	}
+
+	last := len(payloads) - 1
+	return createJob(clientset, user, "mod-batch", initContainers, fileContainer(service.BatchContainerName(last), &payloads[last], user, true))
+}
+
+// supportsRestartFlag Returns true when a plugin-manager image version accepts the -restart flag.
+func supportsRestartFlag(version string) bool {
+	return version != "" && service.CompareVersions(version, restartFlagVersion) >= 0
+}
+
+func createJob(clientset kubernetes.Interface, user *model.User, namePrefix string, initContainers []corev1.Container, main corev1.Container) (*string, error) {
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: fmt.Sprintf("mod-install-%s-", user.DiscordID),
+			GenerateName: fmt.Sprintf("%s-%s-", namePrefix, user.DiscordID),
 			Labels: map[string]string{
 				"tenant-discord-id": user.DiscordID,
 			},
@@ -166,78 +300,10 @@ func CreateFileJob(clientset kubernetes.Interface, payload *FilePayload, user *m
 			BackoffLimit: ptr.To(int32(0)), // Ensures jobs are not retried (generally if a job fails it's a misconfiguration)
 			Template: corev1.PodTemplateSpec{
 				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  "main",
-							Image: fmt.Sprintf("%s:%s", os.Getenv("FILE_MANAGER_IMAGE_NAME"), os.Getenv("FILE_MANAGER_IMAGE_VERSION")),
-							Args: []string{
-								"./plugin-manager",
-								"-discord_id",
-								user.DiscordID,
-								"-refresh_token",
-								user.Credentials.RefreshToken,
-								"-prefix",
-								*payload.Prefix,
-								"-destination",
-								payload.Destination,
-								"-op",
-								payload.Operation,
-								"-archive",
-								strconv.FormatBool(payload.IsArchive),
-							},
-							ImagePullPolicy: corev1.PullIfNotPresent,
-							EnvFrom: []corev1.EnvFromSource{
-								{
-									ConfigMapRef: &corev1.ConfigMapEnvSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: "server-config",
-										},
-									},
-								},
-								{
-									SecretRef: &corev1.SecretEnvSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: "mysql-secrets",
-										},
-									},
-								},
-								{
-									SecretRef: &corev1.SecretEnvSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: "aws-creds",
-										},
-									},
-								},
-								{
-									SecretRef: &corev1.SecretEnvSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: "rabbitmq-secrets",
-										},
-									},
-								},
-								{
-									SecretRef: &corev1.SecretEnvSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: "cognito-secrets",
-										},
-									},
-								},
-							},
-							VolumeMounts: util.MakeVolumeMounts(),
-							Resources: corev1.ResourceRequirements{
-								Requests: corev1.ResourceList{
-									corev1.ResourceMemory: resource.MustParse("128Mi"),
-									corev1.ResourceCPU:    resource.MustParse("100m"),
-								},
-								Limits: corev1.ResourceList{
-									corev1.ResourceMemory: resource.MustParse("750Mi"),
-									corev1.ResourceCPU:    resource.MustParse("250m"),
-								},
-							},
-						},
-					},
-					RestartPolicy: corev1.RestartPolicyNever,
-					Volumes:       util.MakeVolumes(fmt.Sprintf("valheim-pvc-%s", user.DiscordID)),
+					InitContainers: initContainers,
+					Containers:     []corev1.Container{main},
+					RestartPolicy:  corev1.RestartPolicyNever,
+					Volumes:        util.MakeVolumes(fmt.Sprintf("valheim-pvc-%s", user.DiscordID)),
 				},
 			},
 		},
@@ -252,3 +318,82 @@ func CreateFileJob(clientset kubernetes.Interface, payload *FilePayload, user *m
 	log.Infof("job successfully created: %s", createdJob.Name)
 	return &createdJob.Name, nil
 }
+
+// fileContainer Creates the plugin-manager container which applies a single file operation to the PVC. The plugin-manager
+// restarts the server after applying the file, batch items skip the restart on releases which support the -restart flag.
+func fileContainer(name string, payload *FilePayload, user *model.User, batch bool) corev1.Container {
+	args := []string{"./plugin-manager"}
+	if batch && supportsRestartFlag(os.Getenv("FILE_MANAGER_IMAGE_VERSION")) {
+		// Written as a single argument before the other flags so it is parsed as a boolean flag
+		args = append(args, "-restart=false")
+	}
+
+	return corev1.Container{
+		Name:  name,
+		Image: fmt.Sprintf("%s:%s", os.Getenv("FILE_MANAGER_IMAGE_NAME"), os.Getenv("FILE_MANAGER_IMAGE_VERSION")),
+		Args: append(args,
+			"-discord_id",
+			user.DiscordID,
+			"-refresh_token",
+			user.Credentials.RefreshToken,
+			"-prefix",
+			*payload.Prefix,
+			"-destination",
+			payload.Destination,
+			"-op",
+			payload.Operation,
+			"-archive",
+			strconv.FormatBool(payload.IsArchive),
+		),
+		ImagePullPolicy:          corev1.PullIfNotPresent,
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		EnvFrom: []corev1.EnvFromSource{
+			{
+				ConfigMapRef: &corev1.ConfigMapEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: "server-config",
+					},
+				},
+			},
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: "mysql-secrets",
+					},
+				},
+			},
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: "aws-creds",
+					},
+				},
+			},
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: "rabbitmq-secrets",
+					},
+				},
+			},
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: "cognito-secrets",
+					},
+				},
+			},
+		},
+		VolumeMounts: util.MakeVolumeMounts(),
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("750Mi"),
+				corev1.ResourceCPU:    resource.MustParse("250m"),
+			},
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package operation
+
+import (
+	"errors"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type GetOperationHandler struct{}
+
+// HandleRequest Handles the request for the status of an operation. Clients can poll this route until the operation is
+// SUCCEEDED or FAILED or listen for OperationUpdated events on the websocket instead. Members of an organization a server is
+// shared with can view the operations on that server.
+func (g *GetOperationHandler) HandleRequest(c *gin.Context, operationService *service.OperationService) {
+	tmp, exists := c.Get("user")
+	if !exists {
+		log.Errorf("user not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found in context"})
+		return
+	}
+	user := tmp.(*model.User)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid operation id"})
+		return
+	}
+
+	op, err := operationService.Get(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+			return
+		}
+		log.Errorf("failed to get operation %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get operation"})
+		return
+	}
+
+	// Operations the user cannot view are reported as missing so ids cannot be probed
+	allowed, err := operationService.CanView(op, user.ID)
+	if err != nil {
+		log.Errorf("failed to check access to operation %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get operation"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, op)
+}
@@ -0,0 +1,33 @@
+package org
+
+import (
+	"errors"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type AcceptInviteHandler struct{}
+
+// HandleRequest Handles the request for joining an organization with an invite token. Users who are already members keep
+// their current role.
+func (h *AcceptInviteHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	user := c.MustGet("user").(*model.User)
+
+	member, err := service.AcceptInvite(db, c.Param("token"), user)
+	if err != nil {
+		if errors.Is(err, service.ErrInviteInvalid) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Errorf("failed to accept invite for user %s: %v", user.DiscordID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to accept invite"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "org.invite.accept", TargetType: "organization", TargetID: member.OrganizationID, After: member})
+	c.JSON(http.StatusOK, member)
+}
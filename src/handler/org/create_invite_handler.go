@@ -0,0 +1,55 @@
+package org
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type CreateInviteRequest struct {
+	Role string `json:"role" binding:"required"`
+	// DiscordID limits the invite to a single user, without it the invite is a link anyone can accept until it expires
+	DiscordID string `json:"discord_id"`
+}
+
+type CreateInviteHandler struct{}
+
+// HandleRequest Handles the request for inviting users to an organization. The invite token is only returned in this response.
+// Invites cannot grant the owner role, members are promoted to owner once they have joined.
+func (h *CreateInviteHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	if err := service.ValidateRole(req.Role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Role == service.RoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invites cannot grant the owner role"})
+		return
+	}
+
+	member, ok := memberFromParam(c, db, service.RoleAdmin)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	invite, token, err := service.CreateInvite(db, member.OrganizationID, req.Role, req.DiscordID, user.ID)
+	if err != nil {
+		log.Errorf("failed to create invite for organization %d: %v", member.OrganizationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "org.invite.create", TargetType: "organization", TargetID: member.OrganizationID, After: invite})
+	c.JSON(http.StatusCreated, gin.H{"invite": invite, "token": token})
+}
@@ -0,0 +1,44 @@
+package org
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type CreateOrganizationHandler struct{}
+
+// HandleRequest Handles the request for creating an organization. The user creating it becomes its owner.
+func (h *CreateOrganizationHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 64 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 1 and 64 characters"})
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	org, err := service.CreateOrganization(db, name, user)
+	if err != nil {
+		log.Errorf("failed to create organization for user %s: %v", user.DiscordID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create organization"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "org.create", TargetType: "organization", TargetID: org.ID, After: org})
+	c.JSON(http.StatusCreated, org)
+}
@@ -0,0 +1,35 @@
+package org
+
+import (
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type DeleteOrganizationHandler struct{}
+
+// HandleRequest Handles the request for deleting an organization. Only owners can delete an organization and the servers shared
+// with it stay with their owners.
+func (h *DeleteOrganizationHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	member, ok := memberFromParam(c, db, service.RoleOwner)
+	if !ok {
+		return
+	}
+
+	org, err := service.GetOrganization(db, member.OrganizationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+		return
+	}
+
+	if err = service.DeleteOrganization(db, org.ID); err != nil {
+		log.Errorf("failed to delete organization %d: %v", org.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete organization"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "org.delete", TargetType: "organization", TargetID: org.ID, Before: org})
+	c.JSON(http.StatusOK, gin.H{"message": "organization deleted"})
+}
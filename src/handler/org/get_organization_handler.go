@@ -0,0 +1,67 @@
+package org
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type GetOrganizationHandler struct{}
+
+// HandleRequest Handles the request for getting an organization with its members and shared servers. Pending invites are only
+// included for members who can manage them.
+func (h *GetOrganizationHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	member, ok := memberFromParam(c, db, service.RoleViewer)
+	if !ok {
+		return
+	}
+
+	org, err := service.GetOrganization(db, member.OrganizationID)
+	if err != nil {
+		log.Errorf("failed to get organization %d: %v", member.OrganizationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get organization"})
+		return
+	}
+
+	if service.RoleRank(member.Role) > service.RoleRank(service.RoleAdmin) {
+		org.Invites = nil
+	}
+	c.JSON(http.StatusOK, gin.H{"organization": org, "role": member.Role})
+}
+
+// memberFromParam Returns the authenticated user's membership in the organization from the :orgId route parameter. Users who
+// are not members get a 404 so organization ids are not leaked and members whose role ranks below the given role get a 403.
+func memberFromParam(c *gin.Context, db *gorm.DB, role string) (*service.OrganizationMember, bool) {
+	id, err := strconv.ParseUint(c.Param("orgId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid organization id"})
+		return nil, false
+	}
+	user := c.MustGet("user").(*model.User)
+
+	member, err := service.GetMember(db, uint(id), user.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+		return nil, false
+	}
+
+	if service.RoleRank(member.Role) > service.RoleRank(role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "the " + member.Role + " role cannot perform this action"})
+		return nil, false
+	}
+	return member, true
+}
+
+// uintParam Parses a numeric route parameter, responding with a 400 when it is invalid.
+func uintParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,25 @@
+package org
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type ListOrganizationsHandler struct{}
+
+// HandleRequest Handles the request for listing the organizations the user is a member of along with their role in each.
+func (h *ListOrganizationsHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	user := c.MustGet("user").(*model.User)
+
+	orgs, err := service.ListOrganizations(db, user.ID)
+	if err != nil {
+		log.Errorf("failed to list organizations for user %s: %v", user.DiscordID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list organizations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
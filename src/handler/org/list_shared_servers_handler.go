@@ -0,0 +1,27 @@
+package org
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type ListSharedServersHandler struct{}
+
+// HandleRequest Handles the request for listing the servers other users have shared with the user through their organizations
+// along with the user's role on each. Shared servers are managed through /servers/:id or by sending their id in the
+// X-Server-ID header to the /server and /file routes.
+func (h *ListSharedServersHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	user := c.MustGet("user").(*model.User)
+
+	servers, err := service.ListSharedServers(db, user.ID)
+	if err != nil {
+		log.Errorf("failed to list shared servers for user %s: %v", user.DiscordID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list shared servers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"servers": servers})
+}
@@ -0,0 +1,57 @@
+package org
+
+import (
+	"errors"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type RemoveMemberHandler struct{}
+
+// HandleRequest Handles the request for removing a member from an organization. Any member can leave an organization while
+// admins can remove members below owner and owners can remove anyone, as long as an owner remains.
+func (h *RemoveMemberHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	userId, ok := uintParam(c, "userId")
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	role := service.RoleAdmin
+	if userId == user.ID {
+		role = service.RoleViewer
+	}
+
+	caller, ok := memberFromParam(c, db, role)
+	if !ok {
+		return
+	}
+
+	member, err := service.GetMember(db, caller.OrganizationID, userId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+
+	if member.UserID != caller.UserID && member.Role == service.RoleOwner && caller.Role != service.RoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only owners can remove an owner"})
+		return
+	}
+
+	if err = service.RemoveMember(db, member); err != nil {
+		if errors.Is(err, service.ErrLastOwner) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Errorf("failed to remove user %d from organization %d: %v", userId, caller.OrganizationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove member"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "org.member.remove", TargetType: "organization", TargetID: caller.OrganizationID, Before: member})
+	c.JSON(http.StatusOK, gin.H{"message": "member removed"})
+}
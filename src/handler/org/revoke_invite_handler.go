@@ -0,0 +1,44 @@
+package org
+
+import (
+	"errors"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type RevokeInviteHandler struct{}
+
+// HandleRequest Handles the request for revoking a pending organization invite.
+func (h *RevokeInviteHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	member, ok := memberFromParam(c, db, service.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	inviteId, ok := uintParam(c, "inviteId")
+	if !ok {
+		return
+	}
+
+	if err := service.RevokeInvite(db, member.OrganizationID, inviteId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invite not found"})
+			return
+		}
+		log.Errorf("failed to revoke invite %d: %v", inviteId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke invite"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "org.invite.revoke",
+		TargetType: "organization",
+		TargetID:   member.OrganizationID,
+		Details:    map[string]string{"invite_id": strconv.Itoa(int(inviteId))},
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "invite revoked"})
+}
@@ -0,0 +1,55 @@
+package org
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type ShareServerRequest struct {
+	ServerID uint `json:"server_id" binding:"required"`
+}
+
+type ShareServerHandler struct{}
+
+// HandleRequest Handles the request for sharing one of the user's servers with an organization. Members get access to the server
+// based on their role in the organization.
+func (h *ShareServerHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	var req ShareServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	member, ok := memberFromParam(c, db, service.RoleAdmin)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	var server *model.Server
+	for i := range user.Servers {
+		if user.Servers[i].ID == req.ServerID {
+			server = &user.Servers[i]
+		}
+	}
+
+	if server == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+
+	share, err := service.ShareServer(db, member.OrganizationID, server.ID, user.ID)
+	if err != nil {
+		log.Errorf("failed to share server %d with organization %d: %v", server.ID, member.OrganizationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to share server"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "org.server.share", TargetType: "server", TargetID: server.ID, After: share})
+	c.JSON(http.StatusOK, share)
+}
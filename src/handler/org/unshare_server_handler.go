@@ -0,0 +1,59 @@
+package org
+
+import (
+	"errors"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type UnshareServerHandler struct{}
+
+// HandleRequest Handles the request for no longer sharing a server with an organization. The server's owner can always unshare
+// it while other members need to be an admin of the organization.
+func (h *UnshareServerHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	serverId, ok := uintParam(c, "serverId")
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	var server model.Server
+	if err := db.First(&server, serverId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+
+	role := service.RoleAdmin
+	if server.UserID == user.ID {
+		role = service.RoleViewer
+	}
+
+	member, ok := memberFromParam(c, db, role)
+	if !ok {
+		return
+	}
+
+	if err := service.UnshareServer(db, member.OrganizationID, serverId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "server is not shared with this organization"})
+			return
+		}
+		log.Errorf("failed to unshare server %d from organization %d: %v", serverId, member.OrganizationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unshare server"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "org.server.unshare",
+		TargetType: "server",
+		TargetID:   serverId,
+		OwnerID:    server.UserID,
+		Details:    map[string]string{"organization_id": strconv.Itoa(int(member.OrganizationID))},
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "server unshared"})
+}
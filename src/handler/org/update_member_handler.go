@@ -0,0 +1,67 @@
+package org
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type UpdateMemberHandler struct{}
+
+// HandleRequest Handles the request for changing a member's role. Admins can change the roles of members below owner while only
+// owners can promote members to owner or change another owner's role.
+func (h *UpdateMemberHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	var req UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	if err := service.ValidateRole(req.Role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	caller, ok := memberFromParam(c, db, service.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	userId, ok := uintParam(c, "userId")
+	if !ok {
+		return
+	}
+
+	member, err := service.GetMember(db, caller.OrganizationID, userId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+
+	if caller.Role != service.RoleOwner && (member.Role == service.RoleOwner || req.Role == service.RoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only owners can change the owner role"})
+		return
+	}
+
+	before := *member
+	if err = service.UpdateMemberRole(db, member, req.Role); err != nil {
+		if errors.Is(err, service.ErrLastOwner) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Errorf("failed to update role of user %d in organization %d: %v", userId, caller.OrganizationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update member"})
+		return
+	}
+
+	service.SetAudit(c, service.AuditRecord{Action: "org.member.update", TargetType: "organization", TargetID: caller.OrganizationID, Before: before, After: member})
+	c.JSON(http.StatusOK, member)
+}
@@ -0,0 +1,208 @@
+package profile
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/file"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/server"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+type ApplyProfileRequest struct {
+	Force bool `json:"force"`
+}
+
+type ApplyProfileHandler struct{}
+
+// HandleRequest Handles the request for applying a profile to a server. The profile is compared with the files installed on the
+// server and a single batch job installs the missing mods, removes the mods not in the profile, and writes the profile's configs.
+// The world modifiers of the server are replaced with the profile's modifiers. Members of an organization the server is shared
+// with apply their own profiles.
+func (a *ApplyProfileHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	var req ApplyProfileRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+	}
+
+	user, ok := userFromContext(c)
+	if !ok {
+		return
+	}
+
+	tmp, exists := c.Get("server")
+	if !exists {
+		log.Errorf("server not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server not found in context"})
+		return
+	}
+	srv := tmp.(*model.Server)
+
+	// Profiles belong to the user applying them, which is a member rather than the owner on a shared server
+	actor := service.Actor(c)
+	profile, ok := profileFromParam(c, w.HearthhubDb, actor, "profileId")
+	if !ok {
+		return
+	}
+	if actor.ID != user.ID {
+		// Jobs run as the server's owner so files only the member can read are located in the catalog instead
+		profile.ScopeToUser(user.DiscordID)
+	}
+
+	if err := validateModifiers(profile.Modifiers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("profile has invalid world modifiers: %v", err)})
+		return
+	}
+
+	installed, err := service.ListInstalledFiles(w.HearthhubDb, srv.ID)
+	if err != nil {
+		log.Errorf("failed to list installed files for server %d: %v", srv.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list installed files"})
+		return
+	}
+
+	diff := service.DiffProfile(profile, installed)
+	items, err := diffItems(c, w, diff)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	var steps []file.BatchStep
+	var conflicts []string
+	if len(items) > 0 {
+		steps, conflicts, err = file.PlanBatch(c.Request.Context(), w, user, srv, items)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("failed to resolve dependencies: %v", err)})
+			return
+		}
+
+		if len(conflicts) > 0 && !req.Force {
+			c.JSON(http.StatusConflict, gin.H{"error": "profile conflicts with installed mods", "conflicts": conflicts, "diff": diff})
+			return
+		}
+	}
+
+	if err = applyModifiers(w, user, actor, srv, profile); err != nil {
+		log.Errorf("failed to apply profile modifiers to server %d: %v", srv.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to apply world modifiers: %v", err)})
+		return
+	}
+
+	if len(steps) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "server already matches profile", "diff": diff})
+		return
+	}
+
+	file.RunBatch(c, w, user, srv, steps, conflicts)
+}
+
+// diffItems Converts a profile diff into the file payloads of a batch. Mods without an S3 prefix are located in the mod
+// catalog by their Thunderstore name.
+func diffItems(c *gin.Context, w *service.Wrapper, diff *service.ProfileDiff) ([]file.FilePayload, error) {
+	var items []file.FilePayload
+	for _, f := range diff.Remove {
+		prefix := f.Prefix
+		items = append(items, file.FilePayload{
+			Prefix:      &prefix,
+			Destination: f.Destination,
+			IsArchive:   strings.HasSuffix(strings.ToLower(prefix), ".zip"),
+			Operation:   "delete",
+		})
+	}
+
+	source := &service.S3PackageSource{S3Service: w.S3Service, CatalogService: w.CatalogService, MaxSize: file.MaxUploadSize}
+	for _, m := range diff.Install {
+		prefix := m.Prefix
+		if prefix == "" {
+			if m.FullName == "" {
+				return nil, fmt.Errorf("mod %s has no file or Thunderstore name to install from", m.Name)
+			}
+
+			var err error
+			prefix, err = locateMod(c, w, source, m)
+			if err != nil {
+				return nil, fmt.Errorf("failed to locate mod %s: %v", m.FullName, err)
+			}
+		}
+
+		items = append(items, file.FilePayload{
+			Prefix:      &prefix,
+			Destination: service.PluginsDestination,
+			IsArchive:   strings.HasSuffix(strings.ToLower(prefix), ".zip"),
+			Operation:   "write",
+		})
+	}
+
+	for _, cfg := range diff.Configs {
+		prefix := cfg.Prefix
+		items = append(items, file.FilePayload{
+			Prefix:      &prefix,
+			Destination: cfg.Destination,
+			Operation:   "write",
+		})
+	}
+
+	return items, nil
+}
+
+// locateMod Returns the S3 key of a profile mod, downloading the pinned version from the mod catalog when it is known.
+func locateMod(c *gin.Context, w *service.Wrapper, source *service.S3PackageSource, m service.ProfileMod) (string, error) {
+	if m.Version != "" && w.CatalogService != nil {
+		if found, err := w.CatalogService.FindByFullName(m.FullName); err == nil {
+			key, _, err := w.CatalogService.Install(c.Request.Context(), w.S3Service, found.ID, m.Version)
+			return key, err
+		}
+	}
+	return source.Locate(c.Request.Context(), m.FullName)
+}
+
+// applyModifiers Replaces the world modifiers of a server with the modifiers from a profile and updates the server's deployment
+// args so they take effect the next time the server starts. The author is recorded on the revision and differs from the user
+// when a member applies a profile to a server shared with them.
+func applyModifiers(w *service.Wrapper, user, author *model.User, srv *model.Server, profile *service.Profile) error {
+	if srv.WorldDetails.ID == 0 {
+		return nil
+	}
+
+	world := srv.WorldDetails
+	world.Modifiers = make([]model.Modifier, 0, len(profile.Modifiers))
+	for _, m := range profile.Modifiers {
+		world.Modifiers = append(world.Modifiers, model.Modifier{Key: m.Key, Value: m.Value})
+	}
+
+	if len(service.DiffWorldDetails(&srv.WorldDetails, &world)) == 0 {
+		return nil
+	}
+
+	if err := service.SaveWorldDetails(w.HearthhubDb, srv, &world); err != nil {
+		return err
+	}
+
+	if _, err := service.RecordConfigRevision(w.HearthhubDb, srv, author, fmt.Sprintf("applied profile %s", profile.Name)); err != nil {
+		log.Errorf("could not record config revision: %v", err)
+	}
+
+	deployment := srv.DeploymentName
+	if deployment == "" {
+		deployment = fmt.Sprintf("valheim-%s", user.DiscordID)
+	}
+	return server.UpdateServerArgs(w.KubeService, deployment, srv)
+}
+
+// validateModifiers Checks the world modifiers of a profile, including any preset and world keys, against the values Valheim accepts.
+func validateModifiers(modifiers []service.ProfileModifier) error {
+	stored := make([]model.Modifier, 0, len(modifiers))
+	for _, m := range modifiers {
+		stored = append(stored, model.Modifier{Key: m.Key, Value: m.Value})
+	}
+
+	preset, worldModifiers, setKeys := service.SplitWorldModifiers(stored)
+	return service.ValidateWorldModifiers(preset, worldModifiers, setKeys)
+}
@@ -0,0 +1,107 @@
+package profile
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+type CreateProfileRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+
+	// ServerID captures the mods, configs, and world modifiers of the server into the profile
+	ServerID *uint `json:"server_id"`
+
+	Mods      []service.ProfileMod      `json:"mods"`
+	Configs   []service.ProfileConfig   `json:"configs"`
+	Modifiers []service.ProfileModifier `json:"modifiers"`
+}
+
+type CreateProfileHandler struct{}
+
+// HandleRequest Handles the request for creating a profile. When a server id is given the profile is captured from what is
+// installed on the server, otherwise the mods, configs, and modifiers in the request are used.
+func (h *CreateProfileHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	user, ok := userFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req CreateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	profile := &service.Profile{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Mods:        req.Mods,
+		Configs:     req.Configs,
+		Modifiers:   req.Modifiers,
+	}
+	profile.ScopeToUser(user.DiscordID)
+
+	if req.ServerID != nil {
+		found := false
+		for i := range user.Servers {
+			if user.Servers[i].ID != *req.ServerID {
+				continue
+			}
+			found = true
+
+			installed, err := service.ListInstalledFiles(db, user.Servers[i].ID)
+			if err != nil {
+				log.Errorf("failed to list installed files for server %d: %v", user.Servers[i].ID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list installed files"})
+				return
+			}
+			profile = service.CaptureProfile(profile.Name, profile.Description, installed, &user.Servers[i].WorldDetails)
+		}
+
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+			return
+		}
+	}
+
+	if err := validateModifiers(profile.Modifiers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid world modifiers: %v", err)})
+		return
+	}
+
+	saveProfile(c, db, user.ID, profile)
+}
+
+// saveProfile Saves a new profile for a user responding with a conflict when the name is already used.
+func saveProfile(c *gin.Context, db *gorm.DB, userId uint, profile *service.Profile) {
+	if profile.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "profile name is required"})
+		return
+	}
+
+	var count int64
+	if err := db.Model(&service.Profile{}).Where("user_id = ? AND name = ?", userId, profile.Name).Count(&count).Error; err != nil {
+		log.Errorf("failed to check for an existing profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create profile"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("a profile named %s already exists", profile.Name)})
+		return
+	}
+
+	profile.UserID = userId
+	if err := db.Create(profile).Error; err != nil {
+		log.Errorf("failed to create profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create profile"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, profile)
+}
@@ -0,0 +1,32 @@
+package profile
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type DeleteProfileHandler struct{}
+
+// HandleRequest Handles the request for deleting a profile. Config files stored for the profile are left in S3 since they
+// count towards the user's storage like any other config.
+func (d *DeleteProfileHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	user, ok := userFromContext(c)
+	if !ok {
+		return
+	}
+
+	profile, ok := profileFromParam(c, db, user, "id")
+	if !ok {
+		return
+	}
+
+	if err := db.Delete(profile).Error; err != nil {
+		log.Errorf("failed to delete profile %d: %v", profile.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "profile deleted"})
+}
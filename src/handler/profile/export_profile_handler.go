@@ -0,0 +1,63 @@
+package profile
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/file"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"path"
+	"strings"
+)
+
+type ExportProfileHandler struct{}
+
+// HandleRequest Handles the request for exporting a profile. The json format contains only the profile definition while the
+// zip and r2z formats also bundle the profile's config files so the profile can be imported elsewhere.
+func (e *ExportProfileHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	user, ok := userFromContext(c)
+	if !ok {
+		return
+	}
+
+	profile, ok := profileFromParam(c, w.HearthhubDb, user, "id")
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", service.ProfileFormatJSON)
+	switch format {
+	case service.ProfileFormatJSON:
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", profile.Name+".json"))
+		c.JSON(http.StatusOK, profile.Export())
+		return
+	case service.ProfileFormatZip, service.ProfileFormatR2Z:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of: json, zip, r2z"})
+		return
+	}
+
+	var files []service.ProfileFile
+	for _, cfg := range profile.Configs {
+		data, err := w.S3Service.GetObject(c.Request.Context(), cfg.Prefix, file.MaxUploadSize)
+		if err != nil {
+			log.Errorf("failed to read config %s for profile %d: %v", cfg.Prefix, profile.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to read config file: %s", path.Base(cfg.Prefix))})
+			return
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(cfg.Destination, service.ConfigDestination), "/")
+		files = append(files, service.ProfileFile{Path: path.Join(rel, path.Base(cfg.Prefix)), Data: data})
+	}
+
+	archive, err := service.WriteProfileArchive(profile, format, files)
+	if err != nil {
+		log.Errorf("failed to write profile archive: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export profile"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", profile.Name+"."+format))
+	c.Data(http.StatusOK, "application/zip", archive)
+}
@@ -0,0 +1,24 @@
+package profile
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type GetProfileHandler struct{}
+
+// HandleRequest Handles the request for a single profile.
+func (g *GetProfileHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	user, ok := userFromContext(c)
+	if !ok {
+		return
+	}
+
+	profile, ok := profileFromParam(c, db, user, "id")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
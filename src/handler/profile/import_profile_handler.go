@@ -0,0 +1,110 @@
+package profile
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/file"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+type ImportProfileHandler struct{}
+
+// HandleRequest Handles the request for importing a profile from a hearthhub json or zip export or an r2modman .r2z export.
+// Config files bundled in the archive are uploaded to the user's config files in S3.
+func (i *ImportProfileHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	user, ok := userFromContext(c)
+	if !ok {
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a profile file is required"})
+		return
+	}
+
+	if header.Size > file.MaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("profile exceeds the maximum size of %d bytes", file.MaxUploadSize)})
+		return
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read profile file"})
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, file.MaxUploadSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read profile file"})
+		return
+	}
+
+	imported, err := service.ParseProfile(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile := imported.Profile
+	if name := strings.TrimSpace(c.PostForm("name")); name != "" {
+		profile.Name = name
+	}
+	if profile.Name == "" {
+		profile.Name = strings.TrimSuffix(header.Filename, path.Ext(header.Filename))
+	}
+
+	// Configs bundled in an archive replace the configs listed in its manifest
+	if len(imported.Files) > 0 {
+		profile.Configs = nil
+	}
+	profile.ScopeToUser(user.DiscordID)
+
+	// Bundled configs count towards the storage quota like any other upload
+	if len(imported.Files) > 0 {
+		var total int64
+		for _, pf := range imported.Files {
+			total += int64(len(pf.Data))
+		}
+
+		usage, err := service.LoadStorageUsage(w.HearthhubDb, w.S3Service, w.StripeService, user)
+		if err != nil {
+			log.Errorf("failed to get user storage usage: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user storage usage"})
+			return
+		}
+
+		if usage.TotalBytes()+total > usage.QuotaBytes {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("storage quota exceeded: %d/%d bytes used", usage.TotalBytes(), usage.QuotaBytes),
+			})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	for _, pf := range imported.Files {
+		key := fmt.Sprintf("config/%s/profiles/%s/%s", user.DiscordID, strings.ReplaceAll(profile.Name, "/", "-"), pf.Path)
+		if err = w.S3Service.PutObject(ctx, key, pf.Data, "application/octet-stream"); err != nil {
+			log.Errorf("failed to upload profile config %s: %v", key, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to upload config file: %s", pf.Path)})
+			return
+		}
+		if err = service.AddStorageUsage(w.HearthhubDb, user.ID, key, int64(len(pf.Data))); err != nil {
+			log.Errorf("failed to update storage usage for %s: %v", key, err)
+		}
+
+		profile.Configs = append(profile.Configs, service.ProfileConfig{
+			Prefix:      key,
+			Destination: path.Join(service.ConfigDestination, path.Dir(pf.Path)),
+		})
+	}
+
+	saveProfile(c, w.HearthhubDb, user.ID, profile)
+}
@@ -0,0 +1,57 @@
+package profile
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type ListProfilesHandler struct{}
+
+// HandleRequest Handles the request for listing the user's profiles.
+func (l *ListProfilesHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	user, ok := userFromContext(c)
+	if !ok {
+		return
+	}
+
+	profiles, err := service.ListProfiles(db, user.ID)
+	if err != nil {
+		log.Errorf("failed to list profiles for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list profiles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profiles)
+}
+
+func userFromContext(c *gin.Context) (*model.User, bool) {
+	tmp, exists := c.Get("user")
+	if !exists {
+		log.Errorf("user not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found in context"})
+		return nil, false
+	}
+	return tmp.(*model.User), true
+}
+
+// profileFromParam Loads the user's profile identified by the named route parameter, writing an error response when it
+// cannot be found.
+func profileFromParam(c *gin.Context, db *gorm.DB, user *model.User, param string) (*service.Profile, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid profile id"})
+		return nil, false
+	}
+
+	profile, err := service.GetProfile(db, user.ID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "profile not found"})
+		return nil, false
+	}
+	return profile, true
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/file"
 	"github.com/cbartram/hearthhub-mod-api/src/service"
 	"github.com/cbartram/hearthhub-mod-api/src/util"
 	"github.com/gin-gonic/gin"
@@ -30,7 +31,11 @@ type CreateServerRequest struct {
 	Port                  *string          `json:"port"`
 	EnableCrossplay       *bool            `json:"enable_crossplay,omitempty"`
 	Public                *bool            `json:"public,omitempty"`
+	Preset                *string          `json:"preset,omitempty"`
 	Modifiers             []model.Modifier `json:"modifiers,omitempty"`
+	SetKeys               []string         `json:"setkeys,omitempty"`
+	Seed                  *string          `json:"seed,omitempty"`
+	Branch                *string          `json:"branch,omitempty"`
 	SaveIntervalSeconds   *int             `json:"save_interval_seconds,omitempty"`
 	BackupCount           *int             `json:"backup_count,omitempty"`
 	InitialBackupSeconds  *int             `json:"initial_backup_seconds,omitempty"`
@@ -91,9 +96,6 @@ func MakeWorldWithDefaults(options *CreateServerRequest) *model.WorldDetails {
 	if options.Public != nil {
 		worldDetails.Public = *options.Public
 	}
-	if len(options.Modifiers) > 0 {
-		worldDetails.Modifiers = options.Modifiers
-	}
 	if options.SaveIntervalSeconds != nil {
 		worldDetails.SaveIntervalSeconds = *options.SaveIntervalSeconds
 	}
@@ -107,38 +109,51 @@ func MakeWorldWithDefaults(options *CreateServerRequest) *model.WorldDetails {
 		worldDetails.BackupIntervalSeconds = *options.BackupIntervalSeconds
 	}
 
+	// Presets expand into the modifiers and world keys they imply, explicitly provided modifiers take precedence
+	var preset string
+	if options.Preset != nil {
+		preset = *options.Preset
+	}
+	worldDetails.Modifiers = service.ExpandWorldModifiers(preset, options.Modifiers, options.SetKeys)
+
 	return worldDetails
 }
 
 func (c *CreateServerRequest) Validate() error {
-	if c.Name == nil || c.World == nil || c.Password == nil {
+	if c.Password == nil {
 		return errors.New("missing required fields name, world, or password")
 	}
+	if err := c.ValidatePatch(); err != nil {
+		return err
+	}
+	return service.ValidateServerPassword(*c.Password, *c.World)
+}
 
-	var validModifiers = map[string][]string{
-		"combat":       {model.VERY_EASY, model.EASY, model.HARD, model.VERY_HARD},
-		"deathpenalty": {model.CASUAL, model.VERY_EASY, model.EASY, model.HARD, model.HARDCORE}, // TODO unsure if this is camel or all lowercase
-		"resources":    {model.MUCH_LESS, model.LESS, model.MORE, model.MUCHMORE, model.MOST},
-		"raids":        {model.NONE, model.MUCH_LESS, model.LESS, model.MORE, model.MUCHMORE},
-		"portals":      {model.CASUAL, model.HARD, model.VERY_HARD},
+// ValidatePatch Validates a request to update an existing server. The password is optional since it is kept when omitted and
+// changed through its own route.
+func (c *CreateServerRequest) ValidatePatch() error {
+	if c.Name == nil || c.World == nil {
+		return errors.New("missing required fields name or world")
 	}
 
-	for _, modifier := range c.Modifiers {
-		validValues, exists := validModifiers[modifier.Key]
-		if !exists {
-			return fmt.Errorf("invalid modifier key: \"%s\"", modifier.Key)
-		}
+	var preset string
+	if c.Preset != nil {
+		preset = *c.Preset
+	}
 
-		for _, validValue := range validValues {
-			if modifier.Value == validValue {
-				return nil // Valid value found
-			}
+	if c.Branch != nil {
+		if err := service.ValidateBranch(*c.Branch); err != nil {
+			return err
 		}
+	}
 
-		return fmt.Errorf("invalid value for modifier \"%s\": \"%s\" valid values are: \"%v\"", modifier.Key, modifier.Value, validModifiers[modifier.Key])
+	if c.Seed != nil {
+		if err := service.ValidateSeed(*c.Seed); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return service.ValidateWorldModifiers(preset, c.Modifiers, c.SetKeys)
 }
 
 type CreateServerHandler struct{}
@@ -180,7 +195,7 @@ func (h *CreateServerHandler) HandleRequest(c *gin.Context, ctx context.Context,
 		return
 	}
 
-	limits, err := w.StripeService.GetSubscriptionLimits(user.SubscriptionId)
+	limits, err := service.UserLimits(w.HearthhubDb, w.StripeService, user)
 	if err != nil {
 		log.Errorf("failed to get user subscription limits: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get subscription limit: %v", err)})
@@ -195,7 +210,38 @@ func (h *CreateServerHandler) HandleRequest(c *gin.Context, ctx context.Context,
 	}
 
 	world := MakeWorldWithDefaults(&reqBody)
-	server, err := CreateDedicatedServerDeployment(world, w.KubeService, user)
+
+	// A world which already has a .fwl i.e. one restored from a backup keeps its own seed, otherwise the world is provisioned
+	// from the requested or a generated seed before the server starts for the first time.
+	worldKey := fmt.Sprintf("valheim-backups-auto/%s/%s.fwl", user.DiscordID, world.World)
+	seed, err := resolveWorldSeed(c.Request.Context(), w.S3Service, worldKey, reqBody.Seed)
+	if errors.Is(err, errWorldExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Errorf("could not resolve world seed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not resolve world seed: " + err.Error()})
+		return
+	}
+
+	// Servers on another game branch than the configured image are created with the newest image of their branch
+	pinned := service.DefaultServerImage(0)
+	if reqBody.Branch != nil && *reqBody.Branch != pinned.Branch {
+		versions := w.ImageService.Versions(c.Request.Context(), *reqBody.Branch)
+		if versions.DefaultValheim == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("no images are available for the %s branch", *reqBody.Branch)})
+			return
+		}
+		pinned.ValheimVersion = versions.DefaultValheim
+		pinned.Branch = *reqBody.Branch
+	}
+
+	replicas := int32(1)
+	if seed.Prefix == "" {
+		replicas = 0
+	}
+
+	server, err := CreateDedicatedServerDeployment(world, w.KubeService, user, pinned, replicas)
 	if err != nil {
 		log.Errorf("could not create dedicated server deployment: %s", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create dedicated server deployment: " + err.Error()})
@@ -209,12 +255,10 @@ func (h *CreateServerHandler) HandleRequest(c *gin.Context, ctx context.Context,
 		return
 	}
 
-	//worldDetailsTx := w.HearthhubDb.Create(world)
-	//if worldDetailsTx.Error != nil {
-	//	log.Errorf("could not save world details: %s", worldDetailsTx.Error)
-	//	c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save world details: " + worldDetailsTx.Error.Error()})
-	//	return
-	//}
+	// World details and their modifiers are created along with the server, the first revision records them as created
+	if _, err = service.RecordConfigRevision(w.HearthhubDb, server, user, "server created"); err != nil {
+		log.Errorf("could not record initial config revision: %v", err)
+	}
 
 	user.Servers = []model.Server{*server}
 	tx := w.HearthhubDb.Save(user)
@@ -224,12 +268,139 @@ func (h *CreateServerHandler) HandleRequest(c *gin.Context, ctx context.Context,
 		return
 	}
 
-	c.JSON(http.StatusOK, user.Servers[0])
+	seed.ServerID = server.ID
+	seed.World = world.World
+	if seed.Prefix == "" {
+		if err = provisionWorld(c.Request.Context(), w, user, &user.Servers[0], seed, worldKey); err != nil {
+			log.Errorf("could not provision world %s: %v", world.World, err)
+			rollbackServer(w, user, server)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not provision world, the server was not created: " + err.Error()})
+			return
+		}
+	}
+
+	if err = w.HearthhubDb.Create(seed).Error; err != nil {
+		log.Errorf("could not save world seed: %v", err)
+	}
+
+	// The server stays on the image versions it was created with until it is upgraded
+	pinned.ServerID = server.ID
+	if err = service.SaveServerImage(w.HearthhubDb, pinned); err != nil {
+		log.Errorf("could not save server image versions: %v", err)
+	}
+
+	// Rm the instance id from the response it's not useful for users and makes
+	// testing harder since it generates a pseudo-random alphanumeric string with
+	// each invocation
+	response := ServerDetails{Server: service.RedactServer(user.Servers[0]), Seed: seed, Images: pinned}
+	response.WorldDetails.InstanceID = ""
+
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "server.create",
+		TargetType: "server",
+		TargetID:   server.ID,
+		After:      response,
+	})
+	c.JSON(http.StatusOK, response)
 }
 
-// CreateDedicatedServerDeployment Creates the valheim dedicated src deployment and pvc given the src configuration.
-func CreateDedicatedServerDeployment(world *model.WorldDetails, kubeService service.KubernetesService, user *model.User) (*model.Server, error) {
-	serverArgs := world.ToStringArgs()
+// errWorldExists is returned when a seed is requested for a world which already has a .fwl.
+var errWorldExists = errors.New("world already exists and was generated from its own seed: remove the seed or choose another world name")
+
+// resolveWorldSeed Returns the seed a new world is created from. When a .fwl already exists for the world its seed is read
+// from it and the prefix of the seed is set so the world is not provisioned again. Requesting a seed for an existing world
+// is an error since the world could not be generated from it.
+func resolveWorldSeed(ctx context.Context, s3Service *service.S3Service, key string, requested *string) (*service.WorldSeed, error) {
+	if _, err := s3Service.StatObject(ctx, key); err == nil {
+		if requested != nil {
+			return nil, errWorldExists
+		}
+
+		seed := &service.WorldSeed{Prefix: key}
+		data, err := s3Service.GetObject(ctx, key, file.MaxUploadSize)
+		if err != nil {
+			log.Errorf("could not read existing world metadata %s: %v", key, err)
+			return seed, nil
+		}
+
+		meta, err := service.ReadWorldMetadata(data)
+		if err != nil {
+			log.Errorf("could not parse existing world metadata %s: %v", key, err)
+			return seed, nil
+		}
+		seed.Seed = meta.SeedName
+		seed.SeedHash = meta.Seed
+		return seed, nil
+	}
+
+	if requested != nil {
+		return &service.WorldSeed{Seed: *requested, SeedHash: service.SeedHash(*requested)}, nil
+	}
+
+	generated, err := service.GenerateSeed()
+	if err != nil {
+		return nil, err
+	}
+	return &service.WorldSeed{Seed: generated, SeedHash: service.SeedHash(generated), Generated: true}, nil
+}
+
+// provisionWorld Uploads the .fwl for a new world and starts a job writing it to the server before the server starts for the
+// first time. Valheim generates the rest of the world from the seed in the .fwl when it loads the world.
+func provisionWorld(ctx context.Context, w *service.Wrapper, user *model.User, server *model.Server, seed *service.WorldSeed, key string) error {
+	_, _, setKeys := service.SplitWorldModifiers(server.WorldDetails.Modifiers)
+	data := service.WriteWorldMetadata(service.NewWorldMetadata(server.WorldDetails.World, seed.Seed, setKeys))
+
+	if err := w.S3Service.PutObject(ctx, key, data, "application/octet-stream"); err != nil {
+		return err
+	}
+	if err := service.AddStorageUsage(w.HearthhubDb, user.ID, key, int64(len(data))); err != nil {
+		log.Errorf("failed to update storage usage for %s: %v", key, err)
+	}
+
+	steps := []file.BatchStep{{
+		Payload: file.FilePayload{
+			Prefix:      &key,
+			Destination: service.WorldsDestination,
+			Operation:   "write",
+		},
+	}}
+
+	op, err := file.StartBatch(ctx, w, user, user, server, steps, true, nil)
+	if err != nil {
+		if delErr := w.S3Service.DeleteObject(ctx, key); delErr != nil {
+			log.Errorf("failed to delete world metadata %s: %v", key, delErr)
+		} else if usageErr := service.AddStorageUsage(w.HearthhubDb, user.ID, key, -int64(len(data))); usageErr != nil {
+			log.Errorf("failed to update storage usage for %s: %v", key, usageErr)
+		}
+		return err
+	}
+
+	seed.Prefix = key
+	seed.OperationID = &op.ID
+	return nil
+}
+
+// rollbackServer Deletes the Kubernetes resources and database record of a server which could not be fully created so the user
+// can create it again.
+func rollbackServer(w *service.Wrapper, user *model.User, server *model.Server) {
+	names, err := service.RollbackResources(w.KubeService.GetClient(), serverResourceActions(user.DiscordID)...)
+	if err != nil {
+		log.Errorf("failed to roll back resources for server %d: %v", server.ID, err)
+	}
+	log.Infof("rolled back resource(s) for server %d: %v", server.ID, names)
+
+	if err = w.HearthhubDb.Delete(server).Error; err != nil {
+		log.Errorf("failed to delete server %d: %v", server.ID, err)
+	}
+	user.Servers = nil
+}
+
+// CreateDedicatedServerDeployment Creates the valheim dedicated src deployment and pvc given the src configuration and the
+// image versions the server is pinned to. The deployment is created with 0 replicas when the world still has to be
+// provisioned before the server starts.
+func CreateDedicatedServerDeployment(world *model.WorldDetails, kubeService service.KubernetesService, user *model.User, image *service.ServerImage, replicas int32) (*model.Server, error) {
+	serverArgs := service.ServerArgs(world)
+	images := image.Images()
 	serverPort, _ := strconv.Atoi(world.Port)
 
 	// Deployments & PVC are always tied to the discord ID. When a src is terminated and re-created it
@@ -237,7 +408,7 @@ func CreateDedicatedServerDeployment(world *model.WorldDetails, kubeService serv
 	pvcName := fmt.Sprintf("valheim-pvc-%s", user.DiscordID)
 	deploymentName := fmt.Sprintf("valheim-%s", user.DiscordID)
 
-	log.Infof("server requests/limits: cpu=%d mem=%d, server args: %v", world.CPURequests, world.MemoryRequests, serverArgs)
+	log.Infof("server requests/limits: cpu=%d mem=%d, server args: %v", world.CPURequests, world.MemoryRequests, service.RedactServerArgs(serverArgs))
 	labels := map[string]string{
 		"app":               "valheim",
 		"created-by":        deploymentName,
@@ -252,7 +423,7 @@ func CreateDedicatedServerDeployment(world *model.WorldDetails, kubeService serv
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: util.Int32Ptr(1),
+			Replicas: util.Int32Ptr(replicas),
 			// Important: this ensures old pods are deleted before new ones are created. It results in src downtime
 			// but ensures that we don't get stuck with 2 servers trying to start without enough resources while 1 gets
 			// caught in a pending scheduling loop.
@@ -271,7 +442,7 @@ func CreateDedicatedServerDeployment(world *model.WorldDetails, kubeService serv
 					Containers: []corev1.Container{
 						{
 							Name:    "valheim",
-							Image:   fmt.Sprintf("%s:%s", os.Getenv("VALHEIM_IMAGE_NAME"), os.Getenv("VALHEIM_IMAGE_VERSION")),
+							Image:   images[service.ValheimContainerName],
 							Command: []string{"sh", "-c"},
 							Args:    []string{serverArgs},
 							Ports: []corev1.ContainerPort{
@@ -305,7 +476,7 @@ func CreateDedicatedServerDeployment(world *model.WorldDetails, kubeService serv
 						},
 						{
 							Name:    "backup-manager",
-							Image:   fmt.Sprintf("%s:%s", os.Getenv("BACKUP_MANAGER_IMAGE_NAME"), os.Getenv("BACKUP_MANAGER_IMAGE_VERSION")),
+							Image:   images[service.BackupManagerContainerName],
 							Command: []string{"sh", "-c"},
 							Args:    []string{fmt.Sprintf("/app/main -mode backup -max-backups %d -token %s", user.SubscriptionLimits.MaxBackups, user.Credentials.RefreshToken)},
 
@@ -413,10 +584,10 @@ func CreateDedicatedServerDeployment(world *model.WorldDetails, kubeService serv
 		time.Sleep(5 * time.Second)
 	}
 
-	kubeService.AddAction(&service.PVCAction{PVC: MakePvc(pvcName, deploymentName, user.DiscordID)})
-	kubeService.AddAction(&service.DeploymentAction{Deployment: deployment})
-
-	names, err := kubeService.ApplyResources()
+	names, err := service.ApplyResources(kubeService.GetClient(),
+		&service.PVCAction{PVC: MakePvc(pvcName, deploymentName, user.DiscordID)},
+		&service.DeploymentAction{Deployment: deployment},
+	)
 	if err != nil {
 		log.Errorf("failed to apply kubernetes resource: %v", err)
 		return nil, err
@@ -434,10 +605,6 @@ func CreateDedicatedServerDeployment(world *model.WorldDetails, kubeService serv
 	cpuLimit, _ := strconv.Atoi(os.Getenv("CPU_LIMIT"))
 	memLimit, _ := strconv.Atoi(os.Getenv("MEMORY_LIMIT"))
 
-	// Rm the instance id from the response it's not useful for users and makes
-	// testing harder since it generates a pseudo-random alphanumeric string with
-	// each invocation
-	world.InstanceID = ""
 	return &model.Server{
 		Name:           world.Name,
 		UserID:         user.ID,
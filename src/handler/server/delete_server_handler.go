@@ -10,6 +10,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net/http"
+	"strings"
 )
 
 type DeleteServerHandler struct{}
@@ -24,25 +25,9 @@ func (d *DeleteServerHandler) HandleRequest(c *gin.Context, w *service.Wrapper)
 
 	user := tmp.(*model.User)
 
-	// Add simple deployment and pvc actions which have already been applied so we can re-use the same logic
-	// to roll them back i.e. delete them!
-	w.KubeService.AddAction(service.DeploymentAction{Deployment: &appsv1.Deployment{
-		ObjectMeta: v1.ObjectMeta{
-			Name:      fmt.Sprintf("valheim-%s", user.DiscordID),
-			Namespace: "hearthhub",
-		},
-	}})
-
-	w.KubeService.AddAction(service.PVCAction{PVC: &corev1.PersistentVolumeClaim{
-		ObjectMeta: v1.ObjectMeta{
-			Name:      fmt.Sprintf("valheim-pvc-%s", user.DiscordID),
-			Namespace: "hearthhub",
-		},
-	}})
-
 	// Delete deployment and pvc before updating cognito to avoid a scenario where the user could spin up more than 1 src
 	// if their cognito gets updated but src deletion fails.
-	names, err := w.KubeService.Rollback()
+	names, err := service.RollbackResources(w.KubeService.GetClient(), serverResourceActions(user.DiscordID)...)
 	if err != nil {
 		log.Errorf("error deleting deployment/pvc: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to delete deployment/pvc: %v", err)})
@@ -57,8 +42,38 @@ func (d *DeleteServerHandler) HandleRequest(c *gin.Context, w *service.Wrapper)
 		return
 	}
 
+	record := service.AuditRecord{
+		Action:     "server.delete",
+		TargetType: "server",
+		Details:    map[string]string{"resources": strings.Join(names, ",")},
+	}
+	if len(user.Servers) > 0 {
+		record.TargetID = user.Servers[0].ID
+		record.Before = service.RedactServer(user.Servers[0])
+	}
+	service.SetAudit(c, record)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":   fmt.Sprintf("deleted resources successfully"),
 		"resources": names,
 	})
 }
+
+// serverResourceActions Returns deployment and pvc actions for the resources of a user's server which have already been applied
+// so the same logic rolls them back i.e. deletes them!
+func serverResourceActions(discordId string) []service.ResourceAction {
+	return []service.ResourceAction{
+		service.DeploymentAction{Deployment: &appsv1.Deployment{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      fmt.Sprintf("valheim-%s", discordId),
+				Namespace: "hearthhub",
+			},
+		}},
+		service.PVCAction{PVC: &corev1.PersistentVolumeClaim{
+			ObjectMeta: v1.ObjectMeta{
+				Name:      fmt.Sprintf("valheim-pvc-%s", discordId),
+				Namespace: "hearthhub",
+			},
+		}},
+	}
+}
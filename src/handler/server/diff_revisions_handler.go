@@ -0,0 +1,46 @@
+package server
+
+import (
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type DiffRevisionsResponse struct {
+	From    int                    `json:"from"`
+	To      *int                   `json:"to"`
+	Changes []service.ConfigChange `json:"changes"`
+}
+
+type DiffRevisionsHandler struct{}
+
+// HandleRequest Handles the request for the changes between two revisions of a server's world details. The from revision is
+// required and the changes are compared against the current world details when no to revision is given.
+func (d *DiffRevisionsHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+
+	from, ok := revisionFromParam(c, db, server.ID, c.Query("from"))
+	if !ok {
+		return
+	}
+
+	response := DiffRevisionsResponse{From: from.Revision}
+	target := &server.WorldDetails
+	if to := c.Query("to"); to != "" {
+		revision, ok := revisionFromParam(c, db, server.ID, to)
+		if !ok {
+			return
+		}
+		target = &revision.World
+		number, _ := strconv.Atoi(to)
+		response.To = &number
+	}
+
+	response.Changes = service.DiffWorldDetails(&from.World, target)
+	c.JSON(http.StatusOK, response)
+}
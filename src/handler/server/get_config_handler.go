@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/file"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ConfigFile is a BepInEx config file along with where it is stored and installed.
+type ConfigFile struct {
+	Name        string                 `json:"name"`
+	Prefix      string                 `json:"prefix"`
+	Destination string                 `json:"destination"`
+	Config      *service.BepInExConfig `json:"config"`
+
+	data []byte
+}
+
+type GetConfigHandler struct{}
+
+// HandleRequest Handles the request for a BepInEx config file parsed into its sections and typed entries.
+func (g *GetConfigHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	cfg, ok := loadConfigFile(c, w, user, server)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, cfg)
+}
+
+// loadConfigFile Reads and parses the config file named by the file route parameter. Config files installed on the server
+// are read from the prefix they were installed from, otherwise the file is read from the user's uploaded configs.
+func loadConfigFile(c *gin.Context, w *service.Wrapper, user *model.User, server *model.Server) (*ConfigFile, bool) {
+	name := c.Param("file")
+	if name != path.Base(name) || !strings.EqualFold(path.Ext(name), ".cfg") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file must be the name of a .cfg file"})
+		return nil, false
+	}
+
+	cfg := &ConfigFile{
+		Name:        name,
+		Prefix:      fmt.Sprintf("config/%s/%s", user.DiscordID, name),
+		Destination: service.ConfigDestination,
+	}
+
+	installed, err := service.ListInstalledFiles(w.HearthhubDb, server.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list installed files"})
+		return nil, false
+	}
+	owned := fmt.Sprintf("config/%s/", user.DiscordID)
+	for _, f := range installed {
+		if strings.HasPrefix(f.Prefix, owned) && strings.HasPrefix(f.Destination, service.ConfigDestination) && path.Base(f.Prefix) == name {
+			cfg.Prefix, cfg.Destination = f.Prefix, f.Destination
+			break
+		}
+	}
+
+	cfg.data, err = w.S3Service.GetObject(c.Request.Context(), cfg.Prefix, file.MaxUploadSize)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("config file %s not found", name)})
+		return nil, false
+	}
+
+	cfg.Config, err = service.ParseBepInExConfig(cfg.data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("failed to parse config file: %v", err)})
+		return nil, false
+	}
+
+	return cfg, true
+}
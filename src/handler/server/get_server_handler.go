@@ -2,12 +2,20 @@ package server
 
 import (
 	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"net/http"
 )
 
+// ServerDetails is a server along with the seed its world was generated from and the image versions it is pinned to.
+type ServerDetails struct {
+	model.Server
+	Seed   *service.WorldSeed   `json:"seed"`
+	Images *service.ServerImage `json:"images"`
+}
+
 type GetServerHandler struct{}
 
 func (g *GetServerHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
@@ -19,5 +27,18 @@ func (g *GetServerHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
 	}
 
 	user := tmp.(*model.User)
-	c.JSON(http.StatusOK, user.Servers)
+	servers := make([]ServerDetails, 0, len(user.Servers))
+	for _, server := range user.Servers {
+		seed, err := service.GetWorldSeed(db, server.ID)
+		if err != nil {
+			log.Errorf("could not get world seed for server %d: %v", server.ID, err)
+		}
+		images, err := service.GetServerImage(db, server.ID)
+		if err != nil {
+			log.Errorf("could not get image versions for server %d: %v", server.ID, err)
+		}
+		servers = append(servers, ServerDetails{Server: service.RedactServer(server), Seed: seed, Images: images})
+	}
+
+	c.JSON(http.StatusOK, servers)
 }
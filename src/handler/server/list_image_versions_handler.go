@@ -0,0 +1,21 @@
+package server
+
+import (
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type ListImageVersionsHandler struct{}
+
+// HandleRequest Handles the request for the image versions servers on a game branch can be created with or upgraded to. The
+// branch defaults to stable.
+func (l *ListImageVersionsHandler) HandleRequest(c *gin.Context, imageService *service.ImageService) {
+	branch := c.DefaultQuery("branch", service.BranchStable)
+	if err := service.ValidateBranch(branch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, imageService.Versions(c.Request.Context(), branch))
+}
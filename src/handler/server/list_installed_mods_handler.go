@@ -0,0 +1,54 @@
+package server
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type ListInstalledModsHandler struct{}
+
+type ListInstalledModsResponse struct {
+	Files         []service.InstalledFile  `json:"files"`
+	LastReconcile *service.ReconcileReport `json:"last_reconcile"`
+}
+
+// HandleRequest Handles the request for listing the mods and config files installed on a server along with the result of the
+// most recent reconcile.
+func (l *ListInstalledModsHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+
+	files, err := service.ListInstalledFiles(db, server.ID)
+	if err != nil {
+		log.Errorf("failed to list installed files for server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list installed files"})
+		return
+	}
+
+	report, err := service.LatestReconcileReport(db, server.ID)
+	if err != nil {
+		log.Errorf("failed to get reconcile report for server %d: %v", server.ID, err)
+	}
+
+	c.JSON(http.StatusOK, ListInstalledModsResponse{
+		Files:         files,
+		LastReconcile: report,
+	})
+}
+
+// serverFromContext Returns the server set by the server access middleware, writing an error response when it is missing.
+func serverFromContext(c *gin.Context) (*model.Server, bool) {
+	tmp, exists := c.Get("server")
+	if !exists {
+		log.Errorf("server not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server not found in context"})
+		return nil, false
+	}
+	return tmp.(*model.Server), true
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type ListRevisionsHandler struct{}
+
+// HandleRequest Handles the request for listing every revision of a server's world details, newest first.
+func (l *ListRevisionsHandler) HandleRequest(c *gin.Context, db *gorm.DB) {
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+
+	revisions, err := service.ListConfigRevisions(db, server.ID)
+	if err != nil {
+		log.Errorf("failed to list config revisions for server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list config revisions"})
+		return
+	}
+
+	for i := range revisions {
+		revisions[i].World = service.RedactWorld(revisions[i].World)
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// redactRevision Returns a copy of a revision with its world password replaced so it can be returned to clients.
+func redactRevision(revision *service.ConfigRevision) *service.ConfigRevision {
+	if revision == nil {
+		return nil
+	}
+	redacted := *revision
+	redacted.World = service.RedactWorld(revision.World)
+	return &redacted
+}
+
+// revisionFromParam Loads the revision of a server identified by a route or query parameter, writing an error response
+// when it cannot be found.
+func revisionFromParam(c *gin.Context, db *gorm.DB, serverId uint, value string) (*service.ConfigRevision, bool) {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision number"})
+		return nil, false
+	}
+
+	revision, err := service.GetConfigRevision(db, serverId, number)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return nil, false
+	}
+	return revision, true
+}
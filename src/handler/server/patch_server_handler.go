@@ -16,7 +16,8 @@ import (
 type PatchServerHandler struct{}
 
 // HandleRequest Much of this logic overlaps with the /create endpoint. It uses the same request body, validation logic, and method structure.
-// The primary difference is in how it patches the container run args for a deployment rather than creating a new one.
+// The primary difference is in how it patches the container run args for a deployment rather than creating a new one. The
+// password is optional and the server keeps its current password.
 func (p *PatchServerHandler) HandleRequest(c *gin.Context, ctx context.Context, w *service.Wrapper) {
 	bodyRaw, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -31,7 +32,7 @@ func (p *PatchServerHandler) HandleRequest(c *gin.Context, ctx context.Context,
 		return
 	}
 
-	err = reqBody.Validate()
+	err = reqBody.ValidatePatch()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %s", err)})
 		return
@@ -45,12 +46,12 @@ func (p *PatchServerHandler) HandleRequest(c *gin.Context, ctx context.Context,
 	}
 
 	user := tmp.(*model.User)
-	if len(user.Servers) >= 1 {
+	if len(user.Servers) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("server does not exists for user: %s", user.DiscordID)})
 		return
 	}
 
-	limits, err := w.StripeService.GetSubscriptionLimits(user.SubscriptionId)
+	limits, err := service.UserLimits(w.HearthhubDb, w.StripeService, user)
 	if err != nil {
 		log.Errorf("failed to get user subscription limits: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get subscription limit: %v", err)})
@@ -63,19 +64,11 @@ func (p *PatchServerHandler) HandleRequest(c *gin.Context, ctx context.Context,
 		log.Infof("request max backups > users subscription limit: %d, new backup count set to limit: %d", user.SubscriptionLimits.MaxBackups, *reqBody.BackupCount)
 	}
 
-	world := MakeWorldWithDefaults(&reqBody)
-	err = PatchServerDeployment(world, w.KubeService, user)
-	if err != nil {
-		log.Errorf("could not patch dedicated src deployment: %s", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not patch dedicated src deployment: " + err.Error()})
-		return
-	}
-
 	// Note: this assumes world and server name combo is unique TODO ensure this is true before creating new server
 	var existingServer *model.Server
-	for _, server := range user.Servers {
-		if server.WorldDetails.World == *reqBody.World && server.WorldDetails.Name == *reqBody.Name {
-			existingServer = &server
+	for i := range user.Servers {
+		if user.Servers[i].WorldDetails.World == *reqBody.World && user.Servers[i].WorldDetails.Name == *reqBody.Name {
+			existingServer = &user.Servers[i]
 			break
 		}
 	}
@@ -86,16 +79,55 @@ func (p *PatchServerHandler) HandleRequest(c *gin.Context, ctx context.Context,
 		return
 	}
 
+	// The stored password is kept, clients send back the redacted password they were given or omit it
+	if reqBody.Password != nil && *reqBody.Password != service.RedactedPassword && *reqBody.Password != existingServer.WorldDetails.Password {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("use POST /api/v1/servers/%d/password to change the server password", existingServer.ID)})
+		return
+	}
+	reqBody.Password = &existingServer.WorldDetails.Password
+
+	// Changing branch replaces the server image which is done by an upgrade so it can be rolled back
+	if reqBody.Branch != nil {
+		current, err := service.GetServerImage(w.HearthhubDb, existingServer.ID)
+		if err != nil {
+			log.Errorf("could not get image versions for server %d: %v", existingServer.ID, err)
+		}
+		if current == nil || current.Branch != *reqBody.Branch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("use POST /api/v1/servers/%d/upgrade to change the server branch", existingServer.ID)})
+			return
+		}
+	}
+
+	// The instance id identifies the server to Valheim and must not change between patches
+	world := MakeWorldWithDefaults(&reqBody)
+	world.InstanceID = existingServer.WorldDetails.InstanceID
+	before := service.RedactServer(*existingServer)
+	err = PatchServerDeployment(world, w.KubeService, user)
+	if err != nil {
+		log.Errorf("could not patch dedicated src deployment: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not patch dedicated src deployment: " + err.Error()})
+		return
+	}
+
 	// Update our database with the newly patched server args
-	existingServer.WorldDetails = *world
-	tx := w.HearthhubDb.Save(existingServer)
-	if tx.Error != nil {
-		log.Errorf("could not save updated server details: %v", tx.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save updated server details: " + tx.Error.Error()})
+	if err = service.SaveWorldDetails(w.HearthhubDb, existingServer, world); err != nil {
+		log.Errorf("could not save updated server details: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save updated server details: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, existingServer)
+	if _, err = service.RecordConfigRevision(w.HearthhubDb, existingServer, service.Actor(c), "server updated"); err != nil {
+		log.Errorf("could not record config revision: %v", err)
+	}
+
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "server.update",
+		TargetType: "server",
+		TargetID:   existingServer.ID,
+		Before:     before,
+		After:      service.RedactServer(*existingServer),
+	})
+	c.JSON(http.StatusOK, service.RedactServer(*existingServer))
 }
 
 // PatchServerDeployment Updates a src deployment with new container args.
@@ -111,7 +143,7 @@ func PatchServerDeployment(world *model.WorldDetails, kubeService service.Kubern
 
 	for i := range deployment.Spec.Template.Spec.Containers {
 		if deployment.Spec.Template.Spec.Containers[i].Name == "valheim" {
-			deployment.Spec.Template.Spec.Containers[i].Args = []string{world.ToStringArgs()}
+			deployment.Spec.Template.Spec.Containers[i].Args = []string{service.ServerArgs(world)}
 			break
 		}
 	}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type ReconcileModsHandler struct{}
+
+// HandleRequest Handles the request to re-scan a server's PVC and compare it with the files recorded as installed. The scan
+// runs as a job tracked by a reconcile operation so the report is returned immediately as RUNNING and the user is sent a
+// ModsReconciled event when the operation controller completes it.
+func (r *ReconcileModsHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	report, op, err := service.StartReconcile(w.HearthhubDb, w.KubeService.GetClient(), w.OperationService, server, user, service.Actor(c))
+	if err != nil {
+		log.Errorf("failed to start reconcile for server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("could not start reconcile: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"report":       report,
+		"operation_id": op.ID,
+	})
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type RollbackRevisionHandler struct{}
+
+// HandleRequest Handles the request for rolling a server's world details back to an earlier revision. The deployment args are
+// re-rendered from the restored world details and the rollback is recorded as a new revision so it can be undone.
+func (r *RollbackRevisionHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	revision, ok := revisionFromParam(c, w.HearthhubDb, server.ID, c.Param("revision"))
+	if !ok {
+		return
+	}
+
+	changes := service.DiffWorldDetails(&server.WorldDetails, &revision.World)
+	if len(changes) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("server already matches revision %d", revision.Revision), "server": service.RedactServer(*server)})
+		return
+	}
+
+	previous := server.WorldDetails
+	if err := service.SaveWorldDetails(w.HearthhubDb, server, &revision.World); err != nil {
+		log.Errorf("failed to roll back server %d to revision %d: %v", server.ID, revision.Revision, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save world details"})
+		return
+	}
+
+	deployment := server.DeploymentName
+	if deployment == "" {
+		deployment = fmt.Sprintf("valheim-%s", user.DiscordID)
+	}
+
+	if err := UpdateServerArgs(w.KubeService, deployment, server); err != nil {
+		// Keep the database in line with the deployment which is still running the previous args
+		if restoreErr := service.SaveWorldDetails(w.HearthhubDb, server, &previous); restoreErr != nil {
+			log.Errorf("failed to restore world details for server %d: %v", server.ID, restoreErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to update deployment args: %v", err)})
+		return
+	}
+
+	recorded, err := service.RecordConfigRevision(w.HearthhubDb, server, service.Actor(c), fmt.Sprintf("rolled back to revision %d", revision.Revision))
+	if err != nil {
+		log.Errorf("could not record config revision: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"server":   service.RedactServer(*server),
+		"revision": redactRevision(recorded),
+		"changes":  changes,
+	})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/cbartram/hearthhub-mod-api/src/util"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// generatedPasswordLength is the length of passwords generated during rotation. Special characters are left out since most of
+// them cannot be passed through the server's shell command unquoted.
+const generatedPasswordLength = 16
+
+type RotatePasswordRequest struct {
+	Password *string `json:"password,omitempty"`
+	Generate bool    `json:"generate"`
+}
+
+type RotatePasswordHandler struct{}
+
+// HandleRequest Handles the request for changing a server's password. The password is either provided or generated, applied to
+// the deployment, and recorded as a new revision. A generated password is returned once since it is redacted everywhere else.
+func (r *RotatePasswordHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	var req RotatePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.Generate == (req.Password != nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either password or generate must be provided"})
+		return
+	}
+
+	var password string
+	if req.Generate {
+		generated, err := util.MakeCrypto().GeneratePassword(util.PasswordConfig{
+			Length:        generatedPasswordLength,
+			RequireUpper:  true,
+			RequireLower:  true,
+			RequireNumber: true,
+		})
+		if err != nil {
+			log.Errorf("failed to generate password for server %d: %v", server.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate password"})
+			return
+		}
+		password = generated
+	} else {
+		password = *req.Password
+	}
+
+	if err := service.ValidateServerPassword(password, server.WorldDetails.World); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if password == server.WorldDetails.Password {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new password must differ from the current password"})
+		return
+	}
+
+	previous := server.WorldDetails
+	world := server.WorldDetails
+	world.Password = password
+	if err := service.SaveWorldDetails(w.HearthhubDb, server, &world); err != nil {
+		log.Errorf("failed to save password for server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save world details"})
+		return
+	}
+
+	deployment := server.DeploymentName
+	if deployment == "" {
+		deployment = fmt.Sprintf("valheim-%s", user.DiscordID)
+	}
+
+	if err := UpdateServerArgs(w.KubeService, deployment, server); err != nil {
+		// Keep the database in line with the deployment which is still running with the previous password
+		if restoreErr := service.SaveWorldDetails(w.HearthhubDb, server, &previous); restoreErr != nil {
+			log.Errorf("failed to restore world details for server %d: %v", server.ID, restoreErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to update deployment args: %v", err)})
+		return
+	}
+
+	if _, err := service.RecordConfigRevision(w.HearthhubDb, server, service.Actor(c), "password rotated"); err != nil {
+		log.Errorf("could not record config revision: %v", err)
+	}
+
+	response := gin.H{
+		"message": "password updated",
+		"server":  service.RedactServer(*server),
+	}
+	if req.Generate {
+		response["password"] = password
+	}
+	c.JSON(http.StatusOK, response)
+}
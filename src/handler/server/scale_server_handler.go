@@ -98,6 +98,7 @@ func (h *ScaleServerHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
 		return
 	}
 
+	before := service.RedactServer(server)
 	state := model.TERMINATED
 	if *reqBody.Replicas == 1 {
 		state = model.RUNNING
@@ -110,7 +111,14 @@ func (h *ScaleServerHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
 		return
 	}
 
-	c.JSON(http.StatusOK, server)
+	service.SetAudit(c, service.AuditRecord{
+		Action:     "server.scale",
+		TargetType: "server",
+		TargetID:   server.ID,
+		Before:     before,
+		After:      service.RedactServer(server),
+	})
+	c.JSON(http.StatusOK, service.RedactServer(server))
 }
 
 // UpdateServerArgs Update's a deployment's args to reflect what is in Cognito. This avoids complex argument merging logic by simply having the frontend
@@ -124,7 +132,7 @@ func UpdateServerArgs(kubeService service.KubernetesService, deploymentName stri
 
 	for i, container := range deployment.Spec.Template.Spec.Containers {
 		if container.Name == "valheim" {
-			deployment.Spec.Template.Spec.Containers[i].Args = []string{server.WorldDetails.ToStringArgs()}
+			deployment.Spec.Template.Spec.Containers[i].Args = []string{service.ServerArgs(&server.WorldDetails)}
 			break
 		}
 	}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/file"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type UpdateConfigRequest struct {
+	Edits []service.ConfigEdit `json:"edits"`
+}
+
+type UpdateConfigHandler struct{}
+
+// HandleRequest Handles the request for editing the entries of a BepInEx config file. Edits are validated against the type,
+// acceptable values, and range declared for each entry before the file is written back to S3 and installed on the server.
+func (u *UpdateConfigHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	var req UpdateConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	if len(req.Edits) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "edits must contain at least one change"})
+		return
+	}
+
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	cfg, ok := loadConfigFile(c, w, user, server)
+	if !ok {
+		return
+	}
+
+	if errs := cfg.Config.Apply(req.Edits); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid config values", "errors": errs})
+		return
+	}
+
+	ctx := c.Request.Context()
+	data := cfg.Config.Bytes()
+	if err := w.S3Service.PutObject(ctx, cfg.Prefix, data, "text/plain"); err != nil {
+		log.Errorf("failed to write config %s: %v", cfg.Prefix, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save config file"})
+		return
+	}
+
+	if err := service.AddStorageUsage(w.HearthhubDb, user.ID, cfg.Prefix, int64(len(data)-len(cfg.data))); err != nil {
+		log.Errorf("failed to update storage usage for %s: %v", cfg.Prefix, err)
+	}
+
+	payload := &file.FilePayload{Prefix: &cfg.Prefix, Destination: cfg.Destination, Operation: "write"}
+	op, err := file.StartFileJob(ctx, w, user, service.Actor(c), server, payload, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("config saved but could not create install job: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"config":       cfg,
+		"operation_id": op.ID,
+	})
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/file"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type UpgradeModRequest struct {
+	// Version is the version to upgrade to, the latest version in the catalog is used when it is empty
+	Version string `json:"version"`
+	Force   bool   `json:"force"`
+}
+
+type UpgradeModHandler struct{}
+
+// HandleRequest Handles the request for upgrading an installed mod to a newer version from the mod catalog. Each catalog version
+// is stored under its own key so the installed package is left untouched in S3 for other servers and for rolling back. A single
+// batch removes the old plugin files and installs the new version along with any new dependencies, which repoints only this
+// server's installed file at the new key. The world is backed up before the batch starts and the backup keys are returned and
+// recorded on the batch operation.
+func (u *UpgradeModHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	var req UpgradeModRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+	}
+
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+
+	modId, err := strconv.ParseUint(c.Param("modId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mod id"})
+		return
+	}
+
+	installed, err := service.ListInstalledFiles(w.HearthhubDb, server.ID)
+	if err != nil {
+		log.Errorf("failed to list installed files for server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list installed files"})
+		return
+	}
+
+	var current *service.InstalledFile
+	var remaining []service.InstalledFile
+	for i := range installed {
+		if installed[i].ID == uint(modId) {
+			current = &installed[i]
+			continue
+		}
+		remaining = append(remaining, installed[i])
+	}
+
+	if current == nil || !strings.HasPrefix(current.Destination, service.PluginsDestination) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "installed mod not found"})
+		return
+	}
+
+	if current.Status != service.InstallStatusInstalled {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("mod cannot be upgraded while it is %s", strings.ToLower(current.Status))})
+		return
+	}
+
+	if current.CatalogModID == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "mod was not found in the mod catalog"})
+		return
+	}
+
+	mod, err := w.CatalogService.Get(*current.CatalogModID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "catalog mod not found"})
+		return
+	}
+
+	version := req.Version
+	if version == "" {
+		version = mod.LatestVersion
+	}
+
+	if current.Version != "" && service.CompareVersions(version, current.Version) <= 0 && !req.Force {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s %s is already installed", current.Name, current.Version)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	key, selected, err := w.CatalogService.Install(ctx, w.S3Service, mod.ID, version)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("failed to download %s %s: %v", mod.Name, version, err)})
+		return
+	}
+
+	source := &service.S3PackageSource{S3Service: w.S3Service, CatalogService: w.CatalogService, MaxSize: file.MaxUploadSize}
+	plan, err := service.ResolveInstall(ctx, source, remaining, key)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("failed to resolve dependencies: %v", err)})
+		return
+	}
+
+	if len(plan.Conflicts) > 0 && !req.Force {
+		c.JSON(http.StatusConflict, gin.H{"error": "upgrade conflicts with installed mods", "conflicts": plan.Conflicts})
+		return
+	}
+
+	// Reinstalling the same version writes over the installed files so only a different package is removed first
+	var steps []file.BatchStep
+	if key != current.Prefix {
+		steps = append(steps, file.BatchStep{Payload: file.FilePayload{
+			Prefix:      &current.Prefix,
+			Destination: current.Destination,
+			IsArchive:   strings.HasSuffix(strings.ToLower(current.Prefix), ".zip"),
+			Operation:   "delete",
+		}})
+	}
+	for _, step := range plan.Steps {
+		prefix := step.Prefix
+		steps = append(steps, file.BatchStep{
+			Payload: file.FilePayload{
+				Prefix:      &prefix,
+				Destination: service.PluginsDestination,
+				IsArchive:   strings.HasSuffix(strings.ToLower(prefix), ".zip"),
+				Operation:   "write",
+			},
+			Manifest:   step.Manifest,
+			Dependency: step.Dependency,
+		})
+	}
+
+	// The world is backed up before the plugin files are swapped so it can be restored if the new version corrupts it
+	backups, err := service.BackupWorld(ctx, w.HearthhubDb, w.S3Service, user, server.WorldDetails.World)
+	if err != nil {
+		log.Errorf("failed to back up world before upgrading %s on server %d: %v", current.Name, server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to back up world: %v", err)})
+		return
+	}
+
+	log.Infof("upgrading %s from %s to %s on server %d, previous version remains at %s", current.Name, current.Version, selected.Version, server.ID, current.Prefix)
+	batch, err := file.StartBatch(ctx, w, user, service.Actor(c), server, steps, false, map[string]string{"backups": strings.Join(backups, ",")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      fmt.Sprintf("upgrading %s to %s, the world backup is the last save uploaded by the backup manager", current.Name, selected.Version),
+		"operation_id": batch.ID,
+		"items":        batch.Items,
+		"backups":      backups,
+		"warnings":     plan.Conflicts,
+	})
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type UpgradeServerRequest struct {
+	// ValheimVersion and BackupManagerVersion are the versions to upgrade to, the newest available version is used when empty
+	ValheimVersion       string `json:"valheim_version"`
+	BackupManagerVersion string `json:"backup_manager_version"`
+
+	// Branch switches the server to another game branch, the server stays on its current branch when it is empty
+	Branch string `json:"branch"`
+}
+
+type UpgradeServerHandler struct{}
+
+// HandleRequest Handles the request for upgrading the images of a server in place. The world is backed up first, then the
+// deployment's containers are patched to the new versions. The returned upgrade operation succeeds once the server passes
+// its readiness probe and otherwise rolls the server back to the versions it ran before.
+func (u *UpgradeServerHandler) HandleRequest(c *gin.Context, w *service.Wrapper) {
+	var req UpgradeServerRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+	}
+
+	server, ok := serverFromContext(c)
+	if !ok {
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+	ctx := c.Request.Context()
+
+	if active, err := w.OperationService.FindActive(server.ID, service.OperationTypeUpgrade); err != nil {
+		log.Errorf("failed to check for active upgrades on server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check for active upgrades"})
+		return
+	} else if active != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "an upgrade is already in progress", "operation_id": active.ID})
+		return
+	}
+
+	deploymentName := service.ServerDeploymentName(server, user.DiscordID)
+	current, err := service.CurrentServerImage(ctx, w.HearthhubDb, w.KubeService.GetClient(), server, deploymentName)
+	if err != nil {
+		log.Errorf("failed to get image versions for server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get server image versions"})
+		return
+	}
+
+	// Upgrades stay on the server's game branch unless another branch is requested
+	branch := service.ImageBranch(current.ValheimVersion)
+	if req.Branch != "" {
+		if err = service.ValidateBranch(req.Branch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		branch = req.Branch
+	}
+
+	versions := w.ImageService.Versions(ctx, branch)
+	target := &service.ServerImage{ValheimVersion: req.ValheimVersion, BackupManagerVersion: req.BackupManagerVersion}
+	if target.ValheimVersion == "" && len(versions.Valheim) > 0 {
+		target.ValheimVersion = versions.Valheim[0]
+	}
+	if target.BackupManagerVersion == "" && len(versions.BackupManager) > 0 {
+		target.BackupManagerVersion = versions.BackupManager[0]
+	}
+
+	if !containsVersion(versions.Valheim, target.ValheimVersion) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("valheim version %s is not available on the %s branch", target.ValheimVersion, branch)})
+		return
+	}
+	if !containsVersion(versions.BackupManager, target.BackupManagerVersion) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("backup manager version %s is not available", target.BackupManagerVersion)})
+		return
+	}
+
+	if current.ValheimVersion == target.ValheimVersion && current.BackupManagerVersion == target.BackupManagerVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "server is already running these versions"})
+		return
+	}
+
+	op, backups, err := w.OperationService.StartServerUpgrade(ctx, w.S3Service, user, service.Actor(c), server, current, target)
+	if err != nil {
+		log.Errorf("failed to upgrade server %d: %v", server.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "upgrade started, the world backup is the last save uploaded by the backup manager",
+		"operation_id": op.ID,
+		"images":       target,
+		"backups":      backups,
+	})
+}
+
+func containsVersion(versions []string, version string) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
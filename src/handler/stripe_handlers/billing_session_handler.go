@@ -2,6 +2,7 @@ package stripe_handlers
 
 import (
 	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
 	"github.com/cbartram/hearthhub-mod-api/src/util"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -9,43 +10,55 @@ import (
 	portalsession "github.com/stripe/stripe-go/v81/billingportal/session"
 	"github.com/stripe/stripe-go/v81/checkout/session"
 	"net/http"
+	"net/url"
 	"os"
 )
 
 type BillingSessionHandler struct{}
 
+// HandleRequest Handles the request for a billing portal session. The portal is opened for the Stripe customer of the user in
+// context. Billing is limited to a server's owner so requests scoped to a shared server are rejected before they get here.
 func (h *BillingSessionHandler) HandleRequest(c *gin.Context) {
-	var customerId string
-
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
-	sessionId, ok := c.GetQuery("sessionId")
-	custId, okCust := c.GetQuery("customerId")
-
-	if !ok && !okCust {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "you must provide a \"sessionId\" or \"customerId\" in the query parameters.",
-		})
+	tmp, exists := c.Get("user")
+	if !exists {
+		log.Errorf("user not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found in context"})
 		return
 	}
+	user := tmp.(*model.User)
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	customerId := user.CustomerId
+	sessionId := c.Query("sessionId")
 
-	if okCust {
-		customerId = custId
-	} else {
-		s, err := session.Get(sessionId, nil)
+	// Users who just checked out may not have their customer id saved yet. The checkout session is only trusted when it
+	// was created for this user.
+	if customerId == "" && sessionId != "" {
+		s, err := session.Get(sessionId, &stripe.CheckoutSessionParams{})
 		if err != nil {
-			log.Errorf("failed to find stripe_handlers session: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": fmt.Sprintf("failed to find stripe_handlers checkout session for billing with id: %s", sessionId),
-			})
+			log.Errorf("failed to get checkout session with id: %s, error: %v", sessionId, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to get checkout session"})
 			return
 		}
 
-		customerId = s.Customer.ID
+		if s.ClientReferenceID != user.DiscordID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "checkout session does not belong to user"})
+			return
+		}
+
+		if s.Customer != nil {
+			customerId = s.Customer.ID
+		}
+	}
+
+	if customerId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user does not have a stripe customer"})
+		return
 	}
 
 	params := &stripe.BillingPortalSessionParams{
 		Customer:  stripe.String(customerId),
-		ReturnURL: stripe.String(util.GetHostname() + "/pricing?success=true&session_id=" + sessionId + "&customerId=" + customerId),
+		ReturnURL: stripe.String(util.GetHostname() + "/pricing?success=true&session_id=" + url.QueryEscape(sessionId) + "&customerId=" + customerId),
 	}
 	ps, err := portalsession.New(params)
 	if err != nil {
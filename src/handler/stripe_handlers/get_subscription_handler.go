@@ -2,6 +2,7 @@ package stripe_handlers
 
 import (
 	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"github.com/stripe/stripe-go/v81"
@@ -11,13 +12,20 @@ import (
 
 type GetSubscriptionHandler struct{}
 
+// HandleRequest Handles the request for the Stripe subscription of the user in context. Billing is limited to a server's owner
+// so requests scoped to a shared server are rejected before they get here.
 func (g *GetSubscriptionHandler) HandleRequest(c *gin.Context) {
-	subId, ok := c.GetQuery("id")
+	tmp, exists := c.Get("user")
+	if !exists {
+		log.Errorf("user not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found in context"})
+		return
+	}
+	user := tmp.(*model.User)
 
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "you must provide a \"id\" in the query parameters.",
-		})
+	subId := user.SubscriptionId
+	if subId == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user does not have a subscription"})
 		return
 	}
 
@@ -36,6 +36,8 @@ func ConsumeMessageWithDelay(message service.Message, db *gorm.DB) {
 			return
 		}
 
+		before := billingSnapshot(&user, "")
+
 		// Sub status for users are retrieved directly from stripe every time to ensure we have to maintain as little
 		// stripe state as possible. Therefore, future webhooks like subscription updated, deleted, and trial will end which
 		// mutate sub status can be ignored.
@@ -49,10 +51,34 @@ func ConsumeMessageWithDelay(message service.Message, db *gorm.DB) {
 			return
 		}
 
+		// Billing changes arrive from Stripe rather than from a user so they are audited here instead of by the audit middleware
+		entry := service.NewAuditEntry(nil, &service.AuditRecord{
+			Action:     "billing." + message.Type,
+			TargetType: "subscription",
+			TargetID:   subscription.ID,
+			OwnerID:    user.ID,
+			Before:     before,
+			After:      billingSnapshot(&user, string(subscription.Status)),
+		})
+		entry.ActorDiscordID = "stripe"
+		service.RecordAudit(db, entry)
+
 		log.Infof("subscription updated for user %s, id: %s, status: %s", user.DiscordUsername, subscription.ID, subscription.Status)
 	}
 }
 
+// billingSnapshot Returns the billing state of a user recorded in audit entries. The status is only known once Stripe reports it.
+func billingSnapshot(user *model.User, status string) map[string]string {
+	snapshot := map[string]string{
+		"customer_id":     user.CustomerId,
+		"subscription_id": user.SubscriptionId,
+	}
+	if status != "" {
+		snapshot["subscription_status"] = status
+	}
+	return snapshot
+}
+
 func (w *WebhookHandler) HandleRequest(c *gin.Context, rabbitMQService *service.RabbitMqService) {
 	payload, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -1,17 +1,47 @@
 package src
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
 	common "github.com/cbartram/hearthhub-common/service"
+	"github.com/cbartram/hearthhub-mod-api/src/service"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
+const (
+	// ImpersonateHeader is the header admins set to the discord id of a user to view the api as that user.
+	ImpersonateHeader = "X-Impersonate-User"
+
+	// RequestIDHeader identifies a request in audit entries. Clients may send their own id which is echoed in the response.
+	RequestIDHeader = "X-Request-ID"
+
+	// ServerIDHeader scopes requests on the /server and /file routes to a server shared with the user through an organization.
+	ServerIDHeader = "X-Server-ID"
+
+	// IdempotencyKeyHeader is the header clients set to a unique value per action so retries of the action are not repeated.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is set on responses which were replayed for a retried request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// maxRequestIDLength is the longest client supplied request id which is accepted.
+	maxRequestIDLength = 64
+)
+
 func LogrusMiddleware(logger *logrus.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.URL.Path != "/api/v1/health" {
@@ -28,7 +58,7 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, "+ImpersonateHeader+", "+RequestIDHeader+", "+ServerIDHeader+", "+IdempotencyKeyHeader)
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -41,7 +71,8 @@ func CORSMiddleware() gin.HandlerFunc {
 }
 
 // AuthMiddleware is the custom authentication middleware that checks the Authorization header to ensure a given
-// discord id belong to a given refresh token.
+// discord id belong to a given refresh token or that a bearer api key is valid for the route. Admins may set the ImpersonateHeader to view the api as another user, in which
+// case the impersonated user is set as "user" and the admin as "impersonator".
 func AuthMiddleware(cognito common.CognitoService, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -51,8 +82,18 @@ func AuthMiddleware(cognito common.CognitoService, db *gorm.DB) gin.HandlerFunc
 		}
 
 		// Parse the Authorization header
-		// Expected format: "Basic <base64-encoded discord_id:refresh_token>"
+		// Expected format: "Basic <base64-encoded discord_id:refresh_token>" or "Bearer hh_<api key>"
 		parts := strings.Split(authHeader, " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			user, ok := apiKeyUser(c, cognito, db, parts[1])
+			if !ok {
+				return
+			}
+			c.Set("user", user)
+			c.Next()
+			return
+		}
+
 		if len(parts) != 2 || parts[0] != "Basic" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization header format"})
 			return
@@ -80,7 +121,418 @@ func AuthMiddleware(cognito common.CognitoService, db *gorm.DB) gin.HandlerFunc
 			return
 		}
 
+		if target := c.GetHeader(ImpersonateHeader); target != "" {
+			impersonated, ok := impersonate(c, db, user, target)
+			if !ok {
+				return
+			}
+			c.Set("impersonator", user)
+			user = impersonated
+		}
+
 		c.Set("user", user)
 		c.Next()
 	}
 }
+
+// apiKeyUser Authenticates a request made with an api key and returns the key's user. Keys must have the scope the route
+// requires and cannot be used to impersonate users. The key is set as "api_key" in the context. Requests which may start a job
+// get the user's credentials from Cognito since the key does not carry a refresh token.
+func apiKeyUser(c *gin.Context, cognito common.CognitoService, db *gorm.DB, token string) (*model.User, bool) {
+	key, err := service.AuthenticateAPIKey(db, token)
+	if err != nil {
+		if !errors.Is(err, service.ErrAPIKeyInvalid) {
+			logrus.Errorf("failed to authenticate api key: %v", err)
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": service.ErrAPIKeyInvalid.Error()})
+		return nil, false
+	}
+
+	scope, allowed := service.RequiredScope(c.Request.Method, c.FullPath())
+	if !allowed || c.GetHeader(ImpersonateHeader) != "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api keys cannot be used for this route"})
+		return nil, false
+	}
+	if !key.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("api key is missing the %s scope", scope)})
+		return nil, false
+	}
+
+	user, err := model.GetUser(key.DiscordID, db)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": service.ErrAPIKeyInvalid.Error()})
+		return nil, false
+	}
+
+	if c.Request.Method != http.MethodGet {
+		if err = service.LoadJobCredentials(c.Request.Context(), cognito, user); err != nil {
+			logrus.Errorf("failed to load credentials for api key %d: %v", key.ID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to load credentials for api key"})
+			return nil, false
+		}
+	}
+
+	if err = service.TouchAPIKey(db, key, c.ClientIP()); err != nil {
+		logrus.Errorf("failed to record use of api key %d: %v", key.ID, err)
+	}
+	c.Set("api_key", key)
+	return user, true
+}
+
+// impersonate Loads the user an admin is impersonating. Impersonation is read-only so only the GET routes which read a user's
+// data are allowed and each request made while impersonating is audited.
+func impersonate(c *gin.Context, db *gorm.DB, admin *model.User, discordId string) (*model.User, bool) {
+	if !service.IsAdmin(db, admin.DiscordID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required to impersonate users"})
+		return nil, false
+	}
+
+	if !service.ImpersonationAllowed(c.Request.Method, c.FullPath()) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "impersonated requests are read-only and limited to routes which view a user"})
+		return nil, false
+	}
+
+	user, err := model.GetUser(discordId, db)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user to impersonate not found"})
+		return nil, false
+	}
+
+	entry := service.NewAuditEntry(admin, &service.AuditRecord{
+		Action:     "admin.user.impersonate",
+		TargetType: "user",
+		TargetID:   user.ID,
+		OwnerID:    user.ID,
+	})
+	entry.Method = c.Request.Method
+	entry.Path = c.Request.URL.Path
+	entry.RequestID = c.GetString("request_id")
+	entry.SourceIP = c.ClientIP()
+	service.RecordAudit(db, entry)
+	return user, true
+}
+
+// AuditMiddleware Assigns every request an id and writes an audit entry for each POST, PUT, PATCH, and DELETE request made by
+// an authenticated user once the handler returns. Handlers describe what they changed with service.SetAudit, otherwise the
+// entry records the route and the server the request was made for.
+func AuditMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(RequestIDHeader)
+		if requestId == "" || len(requestId) > maxRequestIDLength {
+			requestId = uuid.NewString()
+		}
+		c.Set("request_id", requestId)
+		c.Header(RequestIDHeader, requestId)
+
+		c.Next()
+
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return
+		}
+
+		tmp, exists := c.Get("user")
+		if !exists || c.FullPath() == "" {
+			return
+		}
+		user := tmp.(*model.User)
+
+		record := service.GetAudit(c)
+		if record == nil {
+			record = &service.AuditRecord{Action: fmt.Sprintf("%s %s", c.Request.Method, c.FullPath())}
+			if server, ok := c.Get("server"); ok {
+				record.TargetType = "server"
+				record.TargetID = server.(*model.Server).ID
+				record.OwnerID = server.(*model.Server).UserID
+			}
+		}
+
+		// Members acting on a shared server are recorded as the actor with the server's owner as the owner
+		if record.OwnerID == 0 {
+			record.OwnerID = user.ID
+		}
+
+		entry := service.NewAuditEntry(service.Actor(c), record)
+		if key, ok := c.Get("api_key"); ok {
+			details := map[string]string{"api_key_id": strconv.Itoa(int(key.(*service.APIKey).ID))}
+			for k, v := range entry.Details {
+				details[k] = v
+			}
+			entry.Details = details
+		}
+		entry.Method = c.Request.Method
+		entry.Path = c.Request.URL.Path
+		entry.Status = c.Writer.Status()
+		entry.RequestID = requestId
+		entry.SourceIP = c.ClientIP()
+		service.RecordAudit(db, entry)
+	}
+}
+
+// ServerAccessMiddleware Resolves the :id route parameter to a server the authenticated user owns or which is shared with them
+// through an organization and sets it as "server" in the context. Requests for servers the user cannot access are rejected with a
+// 404 so server ids are not leaked.
+func ServerAccessMiddleware(cognito common.CognitoService, db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid server id"})
+			return
+		}
+
+		if !scopeToServer(c, cognito, db, uint(id)) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// ServerScopeMiddleware Scopes a request on the /server and /file routes, which act on the user's own server, to a server
+// shared with them when the ServerIDHeader or server_id query parameter is set. Requests without either are left unchanged.
+func ServerScopeMiddleware(cognito common.CognitoService, db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader(ServerIDHeader)
+		if raw == "" {
+			raw = c.Query("server_id")
+		}
+		if raw == "" {
+			c.Next()
+			return
+		}
+
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid server id"})
+			return
+		}
+
+		if !scopeToServer(c, cognito, db, uint(id)) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// scopeToServer Sets the server a request acts on along with the user's role on it. For servers shared through an organization
+// the authenticated user is moved to "actor" and the server's owner is set as "user" with only the shared server, so handlers
+// act on the owner's resources without reaching their other servers. The owner's credentials are loaded for requests which may
+// start a job since jobs on the server run as its owner.
+func scopeToServer(c *gin.Context, cognito common.CognitoService, db *gorm.DB, serverId uint) bool {
+	tmp, exists := c.Get("user")
+	if !exists {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "user not found in context"})
+		return false
+	}
+	user := tmp.(*model.User)
+
+	for i := range user.Servers {
+		if user.Servers[i].ID == serverId {
+			c.Set("server", &user.Servers[i])
+			c.Set("server_role", service.RoleOwner)
+			return true
+		}
+	}
+
+	role, err := service.ServerRole(db, user.ID, serverId)
+	if err != nil {
+		logrus.Errorf("failed to get role of user %d on server %d: %v", user.ID, serverId, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check server access"})
+		return false
+	}
+	if role == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return false
+	}
+
+	var server model.Server
+	if err = db.Preload("User").First(&server, serverId).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return false
+	}
+
+	owner, err := model.GetUser(server.User.DiscordID, db)
+	if err != nil {
+		logrus.Errorf("failed to get owner of server %d: %v", serverId, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check server access"})
+		return false
+	}
+
+	if c.Request.Method != http.MethodGet {
+		if err = service.LoadJobCredentials(c.Request.Context(), cognito, owner); err != nil {
+			logrus.Errorf("failed to load credentials for owner of server %d: %v", serverId, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to load credentials for server owner"})
+			return false
+		}
+	}
+
+	for i := range owner.Servers {
+		if owner.Servers[i].ID == serverId {
+			owner.Servers = owner.Servers[i : i+1]
+			break
+		}
+	}
+
+	c.Set("actor", user)
+	c.Set("user", owner)
+	c.Set("server", &owner.Servers[0])
+	c.Set("server_role", role)
+	return true
+}
+
+// RequirePermission Rejects requests for servers shared with the user when their role does not grant a permission. It must run
+// after the ServerAccessMiddleware or ServerScopeMiddleware. Requests a user makes for their own resources are always allowed.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("server_role")
+		if role != "" && !service.RoleAllows(role, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("the %s role does not have the %s permission on this server", role, permission)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminMiddleware Rejects requests from users who do not have the admin role. It must run after the AuthMiddleware which sets
+// the user.
+func AdminMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tmp, exists := c.Get("user")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "user not found in context"})
+			return
+		}
+
+		if !service.IsAdmin(db, tmp.(*model.User).DiscordID) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimitMiddleware Takes a token from the policy's bucket for each request and rejects requests with a 429 and a Retry-After
+// header once the bucket is empty. Buckets are keyed by the user making the request when it runs after the AuthMiddleware and by
+// ip address otherwise. Requests are allowed when the backend fails so an outage does not take the api down with it.
+func RateLimitMiddleware(backend service.RateLimitBackend, policy service.RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.URL.Path == "/api/v1/health" {
+			c.Next()
+			return
+		}
+
+		key := fmt.Sprintf("%s:ip:%s", policy.Name, c.ClientIP())
+		if actor := service.Actor(c); actor != nil {
+			key = fmt.Sprintf("%s:user:%s", policy.Name, actor.DiscordID)
+		}
+
+		result, err := backend.Take(c.Request.Context(), key, policy)
+		if err != nil {
+			logrus.Errorf("failed to check rate limit: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(policy.Burst))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		if !result.Allowed {
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("rate limit exceeded, retry in %d seconds", retryAfter)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// idempotencyWriter captures the response body so it can be stored and replayed for retries of the request.
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// IdempotencyMiddleware Replays the original response to POST, PUT, and DELETE requests retried with the same IdempotencyKeyHeader
+// instead of handling them again. Keys are scoped to the Authorization header, or the ip address for requests without one, and
+// reusing a key for a different request is rejected. A duplicate which arrives while the original is still being handled gets a
+// 409. Server errors and rate limited responses are not stored so those requests can be retried with the same key.
+func IdempotencyMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodDelete:
+		default:
+			c.Next()
+			return
+		}
+
+		if len(key) > service.MaxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, service.MaxIdempotencyKeyLength)})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := c.ClientIP()
+		if auth := c.GetHeader("Authorization"); auth != "" {
+			scope = auth
+		}
+		scopeHash := sha256.Sum256([]byte(scope))
+
+		hash := service.HashIdempotentRequest(c.Request.Method, c.Request.URL.RequestURI(), c.GetHeader(ServerIDHeader), body)
+		record, err := service.BeginIdempotentRequest(db, hex.EncodeToString(scopeHash[:]), key, hash, c.Request.Method, c.Request.URL.Path)
+		if err != nil {
+			status := service.IdempotencyErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				logrus.Errorf("failed to begin idempotent request: %v", err)
+				c.AbortWithStatusJSON(status, gin.H{"error": "failed to check idempotency key"})
+				return
+			}
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		if record.Completed {
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(record.Status, record.ContentType, record.Response)
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+		c.Next()
+
+		status := c.Writer.Status()
+		if service.IdempotentStatusReplayed(status) {
+			err = service.CompleteIdempotentRequest(db, record, status, c.Writer.Header().Get("Content-Type"), writer.body.Bytes())
+		} else {
+			err = service.ReleaseIdempotentRequest(db, record)
+		}
+		if err != nil {
+			logrus.Errorf("failed to save idempotent response for key %s: %v", key, err)
+		}
+	}
+}
@@ -3,8 +3,15 @@ package src
 import (
 	"context"
 	"github.com/cbartram/hearthhub-mod-api/src/handler"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/admin"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/apikey"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/audit"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/catalog"
 	"github.com/cbartram/hearthhub-mod-api/src/handler/cognito"
 	"github.com/cbartram/hearthhub-mod-api/src/handler/file"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/operation"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/org"
+	"github.com/cbartram/hearthhub-mod-api/src/handler/profile"
 	"github.com/cbartram/hearthhub-mod-api/src/handler/server"
 	"github.com/cbartram/hearthhub-mod-api/src/handler/stripe_handlers"
 	"github.com/cbartram/hearthhub-mod-api/src/service"
@@ -40,11 +47,23 @@ func NewRouter(ctx context.Context, wrapper *service.Wrapper) (*gin.Engine, *Web
 	gin.SetMode(gin.ReleaseMode)
 	r.MaxMultipartMemory = 32 << 20 // 32 MB
 
-	r.Use(CORSMiddleware(), LogrusMiddleware(logger))
+	// Rate limits and audit entries key on the client ip so X-Forwarded-For is only trusted from the ingress controller
+	if err = r.SetTrustedProxies(service.TrustedProxies()); err != nil {
+		logrus.Errorf("invalid trusted proxies, trusting none: %v", err)
+		_ = r.SetTrustedProxies(nil)
+	}
+
+	r.Use(CORSMiddleware(), LogrusMiddleware(logger), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitDefault), IdempotencyMiddleware(wrapper.HearthhubDb), AuditMiddleware(wrapper.HearthhubDb))
 	apiGroup := r.Group("/api/v1")
 	serverGroup := apiGroup.Group("/server", CORSMiddleware(), AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb))
 	modGroup := apiGroup.Group("/file", CORSMiddleware(), AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb))
 	cognitoGroup := apiGroup.Group("/cognito", CORSMiddleware())
+	serversGroup := apiGroup.Group("/servers/:id", CORSMiddleware(), AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), ServerAccessMiddleware(wrapper.CognitoService, wrapper.HearthhubDb))
+	catalogGroup := apiGroup.Group("/mods", CORSMiddleware(), AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb))
+	profileGroup := apiGroup.Group("/profiles", CORSMiddleware(), AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb))
+	orgGroup := apiGroup.Group("/orgs", CORSMiddleware(), AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb))
+	keyGroup := apiGroup.Group("/keys", CORSMiddleware(), AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb))
+	adminGroup := apiGroup.Group("/admin", CORSMiddleware(), AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), AdminMiddleware(wrapper.HearthhubDb))
 
 	// The connection to RabbitMQ and exchange declaration occurs here.
 	wsManager, err := NewWebSocketManager()
@@ -67,7 +86,7 @@ func NewRouter(ctx context.Context, wrapper *service.Wrapper) (*gin.Engine, *Web
 		h.HandleRequest(c, wrapper.CognitoService)
 	})
 
-	apiGroup.GET("/stripe/create-billing-session", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+	apiGroup.GET("/stripe/create-billing-session", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionBilling), func(c *gin.Context) {
 		h := stripe_handlers.BillingSessionHandler{}
 		h.HandleRequest(c)
 	})
@@ -77,13 +96,13 @@ func NewRouter(ctx context.Context, wrapper *service.Wrapper) (*gin.Engine, *Web
 		h.HandleRequest(c, wrapper.RabbitMQService)
 	})
 
-	apiGroup.GET("/stripe/subscription", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+	apiGroup.GET("/stripe/subscription", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionBilling), func(c *gin.Context) {
 		h := stripe_handlers.GetSubscriptionHandler{}
 		h.HandleRequest(c)
 	})
 
-	// The health route returns the latest versions for the valheim src and sidecar so users
-	// can be alerted when to delete and re-create their servers.
+	// The health route returns the latest versions for the valheim src and sidecar. New servers are created with
+	// these versions and existing servers can be upgraded to them with /servers/:id/upgrade.
 	apiGroup.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"api-version":             os.Getenv("API_VERSION"),
@@ -93,6 +112,11 @@ func NewRouter(ctx context.Context, wrapper *service.Wrapper) (*gin.Engine, *Web
 		})
 	})
 
+	apiGroup.GET("/images", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+		h := server.ListImageVersionsHandler{}
+		h.HandleRequest(c, wrapper.ImageService)
+	})
+
 	// The following 2 routes are the only routes that do not require Authorization in the form of a discord id
 	// and OAuth refresh token to access.
 	apiGroup.POST("/discord/oauth", func(c *gin.Context) {
@@ -105,20 +129,20 @@ func NewRouter(ctx context.Context, wrapper *service.Wrapper) (*gin.Engine, *Web
 		h.HandleRequest(c, ctx, wrapper.CognitoService, wrapper.HearthhubDb)
 	})
 
-	apiGroup.POST("/support/send-message", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+	apiGroup.POST("/support/send-message", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitSupport), func(c *gin.Context) {
 		h := handler.SupportHandler{}
 		h.HandleRequest(c)
 	})
 
 	//  Authorized routes below
-	apiGroup.GET("/file", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+	apiGroup.GET("/file", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionView), func(c *gin.Context) {
 		h := file.FileHandler{}
 		h.HandleRequest(c, wrapper.S3Service)
 	})
 
-	apiGroup.POST("/file/generate-signed-url", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+	apiGroup.POST("/file/generate-signed-url", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionMods), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitUpload), func(c *gin.Context) {
 		h := file.UploadFileHandler{}
-		h.HandleRequest(c, wrapper.S3Service, wrapper.StripeService)
+		h.HandleRequest(c, wrapper.S3Service, wrapper.StripeService, wrapper.HearthhubDb)
 	})
 
 	cognitoGroup.POST("/auth", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
@@ -131,35 +155,308 @@ func NewRouter(ctx context.Context, wrapper *service.Wrapper) (*gin.Engine, *Web
 		h.HandleRequest(c, ctx, wrapper.CognitoService)
 	})
 
-	modGroup.POST("/install", func(c *gin.Context) {
+	// Called by the client after a presigned upload finishes to verify and validate the uploaded objects.
+	modGroup.POST("/complete", ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionMods), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitUpload), func(c *gin.Context) {
+		h := file.CompleteUploadHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	modGroup.POST("/install", ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionMods), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitFileJob), func(c *gin.Context) {
 		h := file.InstallFileHandler{}
-		h.HandleRequest(c, wrapper.KubeService, wrapper.S3Service)
+		h.HandleRequest(c, wrapper)
 	})
 
-	serverGroup.GET("/", func(c *gin.Context) {
+	catalogGroup.GET("", func(c *gin.Context) {
+		h := catalog.ListModsHandler{}
+		h.HandleRequest(c, wrapper.CatalogService)
+	})
+
+	catalogGroup.GET("/:id", func(c *gin.Context) {
+		h := catalog.GetModHandler{}
+		h.HandleRequest(c, wrapper.CatalogService)
+	})
+
+	// Downloads a catalog mod into mods/general/ so it can be installed on a server with /file/install
+	catalogGroup.POST("/:id/install", ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionMods), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitFileJob), func(c *gin.Context) {
+		h := catalog.InstallModHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	// Installs or removes many files in a single job with one server restart
+	modGroup.POST("/install/batch", ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionMods), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitFileJob), func(c *gin.Context) {
+		h := file.BatchInstallHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	serverGroup.GET("/", ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionView), func(c *gin.Context) {
 		h := server.GetServerHandler{}
 		h.HandleRequest(c, wrapper.HearthhubDb)
 	})
 
-	serverGroup.POST("/create", func(c *gin.Context) {
+	serverGroup.POST("/create", RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitServerCreate), func(c *gin.Context) {
 		h := server.CreateServerHandler{}
 		h.HandleRequest(c, ctx, wrapper)
 	})
 
-	serverGroup.DELETE("/delete", func(c *gin.Context) {
+	serverGroup.DELETE("/delete", ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionDelete), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitServerUpdate), func(c *gin.Context) {
 		h := server.DeleteServerHandler{}
 		h.HandleRequest(c, wrapper)
 	})
 
-	serverGroup.PUT("/update", func(c *gin.Context) {
+	serverGroup.PUT("/update", ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionConfig), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitServerUpdate), func(c *gin.Context) {
 		h := server.PatchServerHandler{}
 		h.HandleRequest(c, ctx, wrapper)
 	})
 
-	serverGroup.PUT("/scale", func(c *gin.Context) {
+	serverGroup.PUT("/scale", ServerScopeMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), RequirePermission(service.PermissionControl), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitServerUpdate), func(c *gin.Context) {
 		h := server.ScaleServerHandler{}
 		h.HandleRequest(c, wrapper)
 	})
 
+	apiGroup.GET("/audit", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+		h := audit.ListAuditHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	apiGroup.GET("/operations/:id", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+		h := operation.GetOperationHandler{}
+		h.HandleRequest(c, wrapper.OperationService)
+	})
+
+	serversGroup.GET("/mods", RequirePermission(service.PermissionView), func(c *gin.Context) {
+		h := server.ListInstalledModsHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	serversGroup.POST("/mods/reconcile", RequirePermission(service.PermissionMods), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitFileJob), func(c *gin.Context) {
+		h := server.ReconcileModsHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	serversGroup.POST("/mods/:modId/upgrade", RequirePermission(service.PermissionMods), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitFileJob), func(c *gin.Context) {
+		h := server.UpgradeModHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	serversGroup.GET("/revisions", RequirePermission(service.PermissionView), func(c *gin.Context) {
+		h := server.ListRevisionsHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	serversGroup.GET("/revisions/diff", RequirePermission(service.PermissionView), func(c *gin.Context) {
+		h := server.DiffRevisionsHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	serversGroup.POST("/revisions/:revision/rollback", RequirePermission(service.PermissionConfig), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitServerUpdate), func(c *gin.Context) {
+		h := server.RollbackRevisionHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	serversGroup.POST("/upgrade", RequirePermission(service.PermissionControl), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitServerUpdate), func(c *gin.Context) {
+		h := server.UpgradeServerHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	serversGroup.POST("/password", RequirePermission(service.PermissionConfig), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitServerUpdate), func(c *gin.Context) {
+		h := server.RotatePasswordHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	serversGroup.GET("/configs/:file", RequirePermission(service.PermissionView), func(c *gin.Context) {
+		h := server.GetConfigHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	serversGroup.PUT("/configs/:file", RequirePermission(service.PermissionConfig), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitFileJob), func(c *gin.Context) {
+		h := server.UpdateConfigHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	serversGroup.POST("/profiles/:profileId/apply", RequirePermission(service.PermissionMods), RateLimitMiddleware(wrapper.RateLimitBackend, service.RateLimitFileJob), func(c *gin.Context) {
+		h := profile.ApplyProfileHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.GET("/rollouts", func(c *gin.Context) {
+		h := admin.ListRolloutsHandler{}
+		h.HandleRequest(c, wrapper.RolloutService)
+	})
+
+	adminGroup.POST("/rollouts", func(c *gin.Context) {
+		h := admin.CreateRolloutHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.GET("/rollouts/:rolloutId", func(c *gin.Context) {
+		h := admin.GetRolloutHandler{}
+		h.HandleRequest(c, wrapper.RolloutService)
+	})
+
+	adminGroup.POST("/rollouts/:rolloutId/cancel", func(c *gin.Context) {
+		h := admin.CancelRolloutHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.GET("/users", func(c *gin.Context) {
+		h := admin.ListUsersHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.GET("/users/:userId", func(c *gin.Context) {
+		h := admin.GetUserHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.PUT("/users/:userId/limits", func(c *gin.Context) {
+		h := admin.UpdateLimitsHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.GET("/servers", func(c *gin.Context) {
+		h := admin.ListServersHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.POST("/servers/:serverId/stop", func(c *gin.Context) {
+		h := admin.StopServerHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.DELETE("/servers/:serverId", func(c *gin.Context) {
+		h := admin.DeleteServerHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.POST("/operations/:operationId/retry", func(c *gin.Context) {
+		h := admin.RetryOperationHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	adminGroup.GET("/admins", func(c *gin.Context) {
+		h := admin.ListAdminsHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	adminGroup.POST("/admins", func(c *gin.Context) {
+		h := admin.GrantAdminHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	adminGroup.DELETE("/admins/:discordId", func(c *gin.Context) {
+		h := admin.RevokeAdminHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	adminGroup.GET("/audit", func(c *gin.Context) {
+		h := admin.ListAuditHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	apiGroup.GET("/shared-servers", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+		h := org.ListSharedServersHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	apiGroup.POST("/invites/:token/accept", AuthMiddleware(wrapper.CognitoService, wrapper.HearthhubDb), func(c *gin.Context) {
+		h := org.AcceptInviteHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.GET("", func(c *gin.Context) {
+		h := org.ListOrganizationsHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.POST("", func(c *gin.Context) {
+		h := org.CreateOrganizationHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.GET("/:orgId", func(c *gin.Context) {
+		h := org.GetOrganizationHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.DELETE("/:orgId", func(c *gin.Context) {
+		h := org.DeleteOrganizationHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.POST("/:orgId/invites", func(c *gin.Context) {
+		h := org.CreateInviteHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.DELETE("/:orgId/invites/:inviteId", func(c *gin.Context) {
+		h := org.RevokeInviteHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.PUT("/:orgId/members/:userId", func(c *gin.Context) {
+		h := org.UpdateMemberHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.DELETE("/:orgId/members/:userId", func(c *gin.Context) {
+		h := org.RemoveMemberHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.POST("/:orgId/servers", func(c *gin.Context) {
+		h := org.ShareServerHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	orgGroup.DELETE("/:orgId/servers/:serverId", func(c *gin.Context) {
+		h := org.UnshareServerHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	keyGroup.GET("", func(c *gin.Context) {
+		h := apikey.ListAPIKeysHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	keyGroup.POST("", func(c *gin.Context) {
+		h := apikey.CreateAPIKeyHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	keyGroup.DELETE("/:keyId", func(c *gin.Context) {
+		h := apikey.RevokeAPIKeyHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	profileGroup.GET("", func(c *gin.Context) {
+		h := profile.ListProfilesHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	profileGroup.POST("", func(c *gin.Context) {
+		h := profile.CreateProfileHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	profileGroup.POST("/import", func(c *gin.Context) {
+		h := profile.ImportProfileHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	profileGroup.GET("/:id", func(c *gin.Context) {
+		h := profile.GetProfileHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
+	profileGroup.GET("/:id/export", func(c *gin.Context) {
+		h := profile.ExportProfileHandler{}
+		h.HandleRequest(c, wrapper)
+	})
+
+	profileGroup.DELETE("/:id", func(c *gin.Context) {
+		h := profile.DeleteProfileHandler{}
+		h.HandleRequest(c, wrapper.HearthhubDb)
+	})
+
 	return r, wsManager
 }
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	a2sInfoRequest   = 0x54
+	a2sInfoResponse  = 0x49
+	a2sChallenge     = 0x41
+	a2sDefaultExpiry = 3 * time.Second
+)
+
+var a2sHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+
+// QueryPlayerCount Returns the number of players on a Valheim server using the Steam A2S_INFO query. Valheim answers queries on
+// the port after its game port.
+func QueryPlayerCount(ctx context.Context, host string, gamePort int) (int, error) {
+	dialer := net.Dialer{Timeout: a2sDefaultExpiry}
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(host, strconv.Itoa(gamePort+1)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to query port: %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(a2sDefaultExpiry)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	request := append(append([]byte{}, a2sHeader...), a2sInfoRequest)
+	request = append(request, []byte("Source Engine Query\x00")...)
+
+	// Servers may answer with a challenge which has to be appended to the request before they answer with their info
+	for attempt := 0; attempt < 2; attempt++ {
+		if _, err = conn.Write(request); err != nil {
+			return 0, fmt.Errorf("failed to send query: %v", err)
+		}
+
+		buf := make([]byte, 1400)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read query response: %v", err)
+		}
+
+		response := buf[:n]
+		if len(response) < 5 || !bytes.Equal(response[:4], a2sHeader) {
+			return 0, errors.New("malformed query response")
+		}
+
+		switch response[4] {
+		case a2sChallenge:
+			if len(response) < 9 {
+				return 0, errors.New("malformed query challenge")
+			}
+			request = append(request[:25], response[5:9]...)
+		case a2sInfoResponse:
+			return parseA2SPlayers(response[5:])
+		default:
+			return 0, fmt.Errorf("unexpected query response type 0x%x", response[4])
+		}
+	}
+
+	return 0, errors.New("server did not answer the query challenge")
+}
+
+// parseA2SPlayers Reads the player count from the body of an A2S_INFO response: protocol, name, map, folder, game, app id,
+// and then the number of players.
+func parseA2SPlayers(body []byte) (int, error) {
+	r := bytes.NewReader(body)
+	if _, err := r.ReadByte(); err != nil {
+		return 0, errors.New("query response is missing the protocol")
+	}
+
+	for i := 0; i < 4; i++ {
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, errors.New("query response is truncated")
+			}
+			if b == 0 {
+				break
+			}
+		}
+	}
+
+	var appId uint16
+	if err := binary.Read(r, binary.LittleEndian, &appId); err != nil {
+		return 0, errors.New("query response is missing the app id")
+	}
+
+	players, err := r.ReadByte()
+	if err != nil {
+		return 0, errors.New("query response is missing the player count")
+	}
+	return int(players), nil
+}
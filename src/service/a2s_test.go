@@ -0,0 +1,47 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestQueryPlayerCount(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	challenge := []byte{0x0A, 0x0B, 0x0C, 0x0D}
+	go func() {
+		buf := make([]byte, 1400)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			// The first request is answered with a challenge which must be sent back
+			if !bytes.HasSuffix(buf[:n], challenge) {
+				_, _ = conn.WriteTo(append([]byte{0xFF, 0xFF, 0xFF, 0xFF, a2sChallenge}, challenge...), addr)
+				continue
+			}
+
+			info := []byte{0xFF, 0xFF, 0xFF, 0xFF, a2sInfoResponse, 17}
+			info = append(info, []byte("Vikings\x00Midgard\x00valheim\x00Valheim\x00")...)
+			info = append(info, 0x00, 0x00, 3, 10)
+			_, _ = conn.WriteTo(info, addr)
+		}
+	}()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	players, err := QueryPlayerCount(context.Background(), "127.0.0.1", port-1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, players)
+}
+
+func TestParseA2SPlayersTruncated(t *testing.T) {
+	_, err := parseA2SPlayers([]byte{17, 'V', 0x00})
+	assert.Error(t, err)
+}
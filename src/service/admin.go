@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrBootstrapAdmin is returned when revoking an admin who is granted the role by ADMIN_DISCORD_IDS.
+var ErrBootstrapAdmin = errors.New("admins listed in ADMIN_DISCORD_IDS cannot be revoked through the api")
+
+// impersonationRoutes are the routes admins can call while impersonating a user. Only GET routes which read the user's data
+// are listed, GET routes with side effects such as creating Stripe sessions are not.
+var impersonationRoutes = map[string]bool{
+	"/api/v1/images":                     true,
+	"/api/v1/file":                       true,
+	"/api/v1/mods":                       true,
+	"/api/v1/mods/:id":                   true,
+	"/api/v1/server/":                    true,
+	"/api/v1/audit":                      true,
+	"/api/v1/operations/:id":             true,
+	"/api/v1/servers/:id/mods":           true,
+	"/api/v1/servers/:id/revisions":      true,
+	"/api/v1/servers/:id/revisions/diff": true,
+	"/api/v1/servers/:id/configs/:file":  true,
+	"/api/v1/stripe/subscription":        true,
+	"/api/v1/shared-servers":             true,
+	"/api/v1/orgs":                       true,
+	"/api/v1/orgs/:orgId":                true,
+	"/api/v1/profiles":                   true,
+	"/api/v1/profiles/:id":               true,
+	"/api/v1/profiles/:id/export":        true,
+}
+
+// ImpersonationAllowed Returns true when an admin may call a route while impersonating a user. Impersonation is read-only.
+func ImpersonationAllowed(method, route string) bool {
+	return method == http.MethodGet && impersonationRoutes[route]
+}
+
+// Admin grants a user the admin role which allows them to use the operator api across every tenant.
+type Admin struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DiscordID string    `gorm:"column:discord_id;size:64;uniqueIndex" json:"discord_id"`
+	GrantedBy string    `gorm:"column:granted_by" json:"granted_by"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (Admin) TableName() string {
+	return "admins"
+}
+
+// IsAdmin Returns true when a discord id has the admin role. The comma separated ids in ADMIN_DISCORD_IDS are always admins
+// so the first admin can be granted without editing the database. Admins can run operations which affect every tenant such
+// as fleet-wide upgrades.
+func IsAdmin(db *gorm.DB, discordId string) bool {
+	if discordId == "" {
+		return false
+	}
+
+	if isBootstrapAdmin(discordId) {
+		return true
+	}
+
+	if db == nil {
+		return false
+	}
+
+	var count int64
+	if err := db.Model(&Admin{}).Where("discord_id = ?", discordId).Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// AdminDiscordIDs Returns which of a set of discord ids have the admin role using a single query.
+func AdminDiscordIDs(db *gorm.DB, discordIds []string) (map[string]bool, error) {
+	admins := map[string]bool{}
+	for _, id := range discordIds {
+		if id != "" && isBootstrapAdmin(id) {
+			admins[id] = true
+		}
+	}
+
+	if db == nil || len(discordIds) == 0 {
+		return admins, nil
+	}
+
+	var granted []string
+	if err := db.Model(&Admin{}).Where("discord_id IN ?", discordIds).Pluck("discord_id", &granted).Error; err != nil {
+		return nil, fmt.Errorf("failed to list admins: %v", err)
+	}
+	for _, id := range granted {
+		admins[id] = true
+	}
+	return admins, nil
+}
+
+// isBootstrapAdmin Returns true when a discord id is one of the ids in ADMIN_DISCORD_IDS.
+func isBootstrapAdmin(discordId string) bool {
+	for _, id := range strings.Split(os.Getenv("ADMIN_DISCORD_IDS"), ",") {
+		if strings.TrimSpace(id) == discordId {
+			return true
+		}
+	}
+	return false
+}
+
+// ListAdmins Returns the users granted the admin role in the database. Admins from ADMIN_DISCORD_IDS are not included.
+func ListAdmins(db *gorm.DB) ([]Admin, error) {
+	var admins []Admin
+	if err := db.Order("id ASC").Find(&admins).Error; err != nil {
+		return nil, fmt.Errorf("failed to list admins: %v", err)
+	}
+	return admins, nil
+}
+
+// GrantAdmin Grants the admin role to a discord id. Granting the role to an existing admin has no effect.
+func GrantAdmin(db *gorm.DB, discordId, grantedBy string) (*Admin, error) {
+	admin := Admin{DiscordID: discordId, GrantedBy: grantedBy}
+	tx := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&admin)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to grant admin: %v", tx.Error)
+	}
+
+	if err := db.Where("discord_id = ?", discordId).First(&admin).Error; err != nil {
+		return nil, fmt.Errorf("failed to get admin: %v", err)
+	}
+	return &admin, nil
+}
+
+// RevokeAdmin Removes the admin role from a discord id. gorm.ErrRecordNotFound is returned when the id is not an admin.
+func RevokeAdmin(db *gorm.DB, discordId string) error {
+	if isBootstrapAdmin(discordId) {
+		return ErrBootstrapAdmin
+	}
+
+	tx := db.Where("discord_id = ?", discordId).Delete(&Admin{})
+	if tx.Error != nil {
+		return fmt.Errorf("failed to revoke admin: %v", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
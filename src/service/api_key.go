@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	common "github.com/cbartram/hearthhub-common/service"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	// APIKeyPrefix starts every api key so they are recognizable in the Authorization header and by secret scanners.
+	APIKeyPrefix = "hh_"
+
+	// ScopeRead allows GET requests for the user's servers, files, mods, and operations
+	ScopeRead = "read"
+	// ScopeServers allows creating, updating, scaling, upgrading, and deleting servers
+	ScopeServers = "servers"
+	// ScopeFiles allows uploading and installing files and mods and editing config files
+	ScopeFiles = "files"
+
+	// DefaultAPIKeyTTL is how long an api key is valid for when no expiry is requested.
+	DefaultAPIKeyTTL = 90 * 24 * time.Hour
+
+	// MaxAPIKeyTTL is the longest expiry an api key can be created with.
+	MaxAPIKeyTTL = 365 * 24 * time.Hour
+
+	// MaxAPIKeys is the number of unrevoked api keys a user can have.
+	MaxAPIKeys = 25
+
+	// apiKeyTouchInterval limits how often the last used time of a key is written so busy keys do not write on every request.
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	// ErrAPIKeyInvalid is returned when an api key does not exist, has been revoked, or has expired.
+	ErrAPIKeyInvalid = errors.New("api key is invalid, revoked, or expired")
+
+	// Scopes are the scopes an api key can be granted.
+	Scopes = []string{ScopeRead, ScopeServers, ScopeFiles}
+
+	// apiKeyDeniedRoutes are route prefixes api keys cannot be used for regardless of scope. Keys cannot manage keys, billing,
+	// sessions, organizations, or act as an admin.
+	apiKeyDeniedRoutes = []string{"/api/v1/keys", "/api/v1/admin", "/api/v1/stripe", "/api/v1/cognito"}
+
+	// apiKeyFileRoutes are the mutating routes which need the files scope, any other mutating server route needs the servers scope.
+	apiKeyFileRoutes = []string{"/api/v1/file", "/api/v1/mods/:id/install", "/api/v1/servers/:id/mods", "/api/v1/servers/:id/configs", "/api/v1/servers/:id/profiles"}
+)
+
+// APIKey is a named, revocable credential a user creates for automation. Only a hash of the key is stored, the key itself is
+// returned once when it is created.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"column:user_id;index" json:"user_id"`
+	DiscordID  string     `gorm:"column:discord_id" json:"-"`
+	Name       string     `gorm:"column:name" json:"name"`
+	Prefix     string     `gorm:"column:prefix;size:16" json:"prefix"`
+	KeyHash    string     `gorm:"column:key_hash;size:64;uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"column:scopes;serializer:json" json:"scopes"`
+	ExpiresAt  time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"column:last_used_ip;size:64" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// HasScope Returns true when the key was granted a scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateScopes Checks that at least one scope is requested and that each is a known scope.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required, valid scopes are: \"%v\"", Scopes)
+	}
+
+	for _, scope := range scopes {
+		valid := false
+		for _, s := range Scopes {
+			valid = valid || s == scope
+		}
+		if !valid {
+			return fmt.Errorf("invalid scope: \"%s\" valid scopes are: \"%v\"", scope, Scopes)
+		}
+	}
+	return nil
+}
+
+// RequiredScope Returns the scope an api key needs for a request to a route. False is returned for routes api keys can never
+// be used for.
+func RequiredScope(method, route string) (string, bool) {
+	for _, prefix := range apiKeyDeniedRoutes {
+		if strings.HasPrefix(route, prefix) {
+			return "", false
+		}
+	}
+
+	if method == "GET" {
+		return ScopeRead, true
+	}
+
+	for _, prefix := range apiKeyFileRoutes {
+		if strings.HasPrefix(route, prefix) {
+			return ScopeFiles, true
+		}
+	}
+
+	if strings.HasPrefix(route, "/api/v1/server/") || strings.HasPrefix(route, "/api/v1/servers/") {
+		return ScopeServers, true
+	}
+	return "", false
+}
+
+// CreateAPIKey Creates an api key for a user and returns it along with the key, which is only available when the key is created.
+func CreateAPIKey(db *gorm.DB, user *model.User, name string, scopes []string, ttl time.Duration) (*APIKey, string, error) {
+	var count int64
+	if err := db.Model(&APIKey{}).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).Count(&count).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to count api keys: %v", err)
+	}
+	if count >= MaxAPIKeys {
+		return nil, "", fmt.Errorf("api key limit of %d reached, revoke an existing key first", MaxAPIKeys)
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate api key: %v", err)
+	}
+	token := APIKeyPrefix + hex.EncodeToString(raw)
+
+	key := &APIKey{
+		UserID:    user.ID,
+		DiscordID: user.DiscordID,
+		Name:      name,
+		Prefix:    token[:len(APIKeyPrefix)+6],
+		KeyHash:   hashAPIKey(token),
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := db.Create(key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %v", err)
+	}
+	return key, token, nil
+}
+
+// ListAPIKeys Returns a user's api keys newest first, including revoked and expired keys.
+func ListAPIKeys(db *gorm.DB, userId uint) ([]APIKey, error) {
+	var keys []APIKey
+	if err := db.Where("user_id = ?", userId).Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %v", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey Revokes one of a user's api keys so it can no longer be used. gorm.ErrRecordNotFound is returned when the user
+// has no such key.
+func RevokeAPIKey(db *gorm.DB, userId, keyId uint) (*APIKey, error) {
+	var key APIKey
+	if err := db.Where("id = ? AND user_id = ?", keyId, userId).First(&key).Error; err != nil {
+		return nil, err
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		if err := db.Model(&key).Update("revoked_at", &now).Error; err != nil {
+			return nil, fmt.Errorf("failed to revoke api key: %v", err)
+		}
+		key.RevokedAt = &now
+	}
+	return &key, nil
+}
+
+// AuthenticateAPIKey Returns the api key matching a key from an Authorization header. ErrAPIKeyInvalid is returned when the key
+// is unknown, revoked, or expired.
+func AuthenticateAPIKey(db *gorm.DB, token string) (*APIKey, error) {
+	if !strings.HasPrefix(token, APIKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	var key APIKey
+	if err := db.Where("key_hash = ?", hashAPIKey(token)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyInvalid
+		}
+		return nil, fmt.Errorf("failed to get api key: %v", err)
+	}
+
+	if key.RevokedAt != nil || time.Now().After(key.ExpiresAt) {
+		return nil, ErrAPIKeyInvalid
+	}
+	return &key, nil
+}
+
+// TouchAPIKey Records when and where an api key was last used. Writes are skipped when the key was used within the last minute.
+func TouchAPIKey(db *gorm.DB, key *APIKey, ip string) error {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < apiKeyTouchInterval && key.LastUsedIP == ip {
+		return nil
+	}
+
+	key.LastUsedAt = &now
+	key.LastUsedIP = ip
+	return db.Model(key).Updates(map[string]interface{}{"last_used_at": &now, "last_used_ip": ip}).Error
+}
+
+// LoadJobCredentials Sets the Cognito credentials of a user loaded from the database rather than authenticated with their refresh
+// token, such as the owner of an api key or of a shared server. Jobs and the backup manager started for the user authenticate
+// with the refresh token so it must be set before they are created. Users which already have a refresh token are left unchanged.
+func LoadJobCredentials(ctx context.Context, cognito common.CognitoService, user *model.User) error {
+	if user.Credentials.RefreshToken != "" {
+		return nil
+	}
+
+	creds, err := cognito.RefreshSession(ctx, user.DiscordID)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials for user %s: %v", user.DiscordID, err)
+	}
+	user.Credentials = model.CognitoCredentials(*creds)
+	return nil
+}
+
+func hashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/cbartram/hearthhub-common/model"
+	common "github.com/cbartram/hearthhub-common/service"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// fakeCognito records the users sessions are refreshed for. Calling any other method panics.
+type fakeCognito struct {
+	common.CognitoService
+	refreshed []string
+	err       error
+}
+
+func (f *fakeCognito) RefreshSession(ctx context.Context, discordID string) (*common.CognitoCredentials, error) {
+	f.refreshed = append(f.refreshed, discordID)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &common.CognitoCredentials{RefreshToken: "refresh-" + discordID, AccessToken: "access-" + discordID}, nil
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method  string
+		route   string
+		scope   string
+		allowed bool
+	}{
+		{"GET", "/api/v1/server/", ScopeRead, true},
+		{"GET", "/api/v1/servers/:id/mods", ScopeRead, true},
+		{"PUT", "/api/v1/server/scale", ScopeServers, true},
+		{"POST", "/api/v1/servers/:id/upgrade", ScopeServers, true},
+		{"POST", "/api/v1/file/install", ScopeFiles, true},
+		{"POST", "/api/v1/file/generate-signed-url", ScopeFiles, true},
+		{"PUT", "/api/v1/servers/:id/configs/:file", ScopeFiles, true},
+		{"POST", "/api/v1/mods/:id/install", ScopeFiles, true},
+		{"POST", "/api/v1/keys", "", false},
+		{"GET", "/api/v1/keys", "", false},
+		{"GET", "/api/v1/admin/users", "", false},
+		{"GET", "/api/v1/stripe/subscription", "", false},
+		{"POST", "/api/v1/orgs", "", false},
+	}
+
+	for _, test := range tests {
+		scope, allowed := RequiredScope(test.method, test.route)
+		assert.Equal(t, test.allowed, allowed, "%s %s", test.method, test.route)
+		assert.Equal(t, test.scope, scope, "%s %s", test.method, test.route)
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	assert.NoError(t, ValidateScopes([]string{ScopeRead, ScopeFiles}))
+	assert.Error(t, ValidateScopes(nil))
+	assert.Error(t, ValidateScopes([]string{ScopeRead, "admin"}))
+
+	key := &APIKey{Scopes: []string{ScopeRead}}
+	assert.True(t, key.HasScope(ScopeRead))
+	assert.False(t, key.HasScope(ScopeServers))
+}
+
+func TestAuthenticateAPIKeyPrefix(t *testing.T) {
+	_, err := AuthenticateAPIKey(nil, "not-a-key")
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+
+	assert.Len(t, hashAPIKey(APIKeyPrefix+"abc"), 64)
+	assert.NotEqual(t, hashAPIKey(APIKeyPrefix+"abc"), hashAPIKey(APIKeyPrefix+"abd"))
+}
+
+func TestTouchAPIKeyThrottled(t *testing.T) {
+	used := time.Now().Add(-10 * time.Second)
+	key := &APIKey{LastUsedAt: &used, LastUsedIP: "10.0.0.1"}
+
+	// A nil db would panic if the recent use was written again
+	assert.NoError(t, TouchAPIKey(nil, key, "10.0.0.1"))
+	assert.Equal(t, used, *key.LastUsedAt)
+}
+
+func TestLoadJobCredentials(t *testing.T) {
+	cognito := &fakeCognito{}
+
+	// Users loaded for an api key have no refresh token so jobs would start with an empty token
+	user := &model.User{DiscordID: "123"}
+	assert.NoError(t, LoadJobCredentials(context.Background(), cognito, user))
+	assert.Equal(t, "refresh-123", user.Credentials.RefreshToken)
+	assert.Equal(t, "access-123", user.Credentials.AccessToken)
+
+	// Users which authenticated with their refresh token keep it
+	authed := &model.User{DiscordID: "456", Credentials: model.CognitoCredentials{RefreshToken: "existing"}}
+	assert.NoError(t, LoadJobCredentials(context.Background(), cognito, authed))
+	assert.Equal(t, "existing", authed.Credentials.RefreshToken)
+	assert.Equal(t, []string{"123"}, cognito.refreshed)
+
+	failing := &fakeCognito{err: errors.New("user not found")}
+	missing := &model.User{DiscordID: "789"}
+	assert.Error(t, LoadJobCredentials(context.Background(), failing, missing))
+	assert.Empty(t, missing.Credentials.RefreshToken)
+}
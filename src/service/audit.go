@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultAuditRetentionDays is how long audit entries are kept when AUDIT_RETENTION_DAYS is not set.
+	DefaultAuditRetentionDays = 365
+
+	// auditPruneBatch is the number of expired audit entries deleted per statement so pruning does not hold long locks.
+	auditPruneBatch = 1000
+
+	// auditRecordKey is the request context key handlers store the audit record for their action under.
+	auditRecordKey = "audit"
+)
+
+// auditIgnoredFields are fields which change on every save and are left out of audit diffs.
+var auditIgnoredFields = map[string]bool{"created_at": true, "updated_at": true, "deleted_at": true}
+
+// AuditEntry records an action a user took on a tenant's resources along with the state of the resource before and after.
+type AuditEntry struct {
+	ID             uint              `gorm:"primaryKey" json:"id"`
+	ActorID        uint              `gorm:"column:actor_id;index" json:"actor_id"`
+	ActorDiscordID string            `gorm:"column:actor_discord_id" json:"actor_discord_id"`
+	OwnerID        uint              `gorm:"column:owner_id;index" json:"owner_id"`
+	Action         string            `gorm:"column:action;size:64;index" json:"action"`
+	TargetType     string            `gorm:"column:target_type;size:32" json:"target_type"`
+	TargetID       string            `gorm:"column:target_id;size:191" json:"target_id"`
+	Method         string            `gorm:"column:method;size:8" json:"method,omitempty"`
+	Path           string            `gorm:"column:path" json:"path,omitempty"`
+	Status         int               `gorm:"column:status" json:"status,omitempty"`
+	RequestID      string            `gorm:"column:request_id;size:64;index" json:"request_id,omitempty"`
+	SourceIP       string            `gorm:"column:source_ip;size:64" json:"source_ip,omitempty"`
+	Before         json.RawMessage   `gorm:"column:before;type:mediumtext" json:"before,omitempty"`
+	After          json.RawMessage   `gorm:"column:after;type:mediumtext" json:"after,omitempty"`
+	Changes        []ConfigChange    `gorm:"column:changes;serializer:json" json:"changes,omitempty"`
+	Details        map[string]string `gorm:"column:details;serializer:json" json:"details,omitempty"`
+	CreatedAt      time.Time         `gorm:"column:created_at;index" json:"created_at"`
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_entries"
+}
+
+// AuditRecord is what a handler knows about the action it took. The audit middleware combines it with the request to write
+// the audit entry once the handler returns.
+type AuditRecord struct {
+	Action     string
+	TargetType string
+	TargetID   interface{}
+	OwnerID    uint
+	Before     interface{}
+	After      interface{}
+	Details    map[string]string
+}
+
+// auditContext is the part of a request context the audit record is stored in. gin.Context implements it.
+type auditContext interface {
+	Set(key string, value any)
+	Get(key string) (any, bool)
+}
+
+// SetAudit Stores the audit record for the action a handler took on the request context. Snapshots passed as Before and
+// After must already have secrets such as server passwords redacted.
+func SetAudit(c auditContext, record AuditRecord) {
+	c.Set(auditRecordKey, &record)
+}
+
+// GetAudit Returns the audit record a handler stored on the request context or nil when there is none.
+func GetAudit(c auditContext) *AuditRecord {
+	tmp, ok := c.Get(auditRecordKey)
+	if !ok {
+		return nil
+	}
+	return tmp.(*AuditRecord)
+}
+
+// NewAuditEntry Creates an audit entry for an action taken by the actor. The before and after snapshots are stored as json
+// along with the fields which differ between them. The actor may be nil for actions taken by the system.
+func NewAuditEntry(actor *model.User, record *AuditRecord) *AuditEntry {
+	entry := &AuditEntry{
+		Action:     record.Action,
+		TargetType: record.TargetType,
+		OwnerID:    record.OwnerID,
+		Details:    record.Details,
+	}
+	if record.TargetID != nil {
+		entry.TargetID = fmt.Sprintf("%v", record.TargetID)
+	}
+	if actor != nil {
+		entry.ActorID = actor.ID
+		entry.ActorDiscordID = actor.DiscordID
+		if entry.OwnerID == 0 {
+			entry.OwnerID = actor.ID
+		}
+	}
+
+	before, after := auditSnapshot(record.Before), auditSnapshot(record.After)
+	if before != nil || after != nil {
+		entry.Before = before
+		entry.After = after
+		entry.Changes = DiffAuditSnapshots(before, after)
+	}
+	return entry
+}
+
+// RecordAudit Saves an audit entry. Failures are logged rather than returned so that an action which already happened is still
+// reported to the caller as successful.
+func RecordAudit(db *gorm.DB, entry *AuditEntry) {
+	if err := db.Create(entry).Error; err != nil {
+		log.Errorf("failed to record audit entry for %s on %s %s by %s: %v", entry.Action, entry.TargetType, entry.TargetID, entry.ActorDiscordID, err)
+	}
+}
+
+// auditSnapshot Returns the json form of a snapshot or nil when there is no snapshot.
+func auditSnapshot(snapshot interface{}) json.RawMessage {
+	if snapshot == nil || (reflect.ValueOf(snapshot).Kind() == reflect.Ptr && reflect.ValueOf(snapshot).IsNil()) {
+		return nil
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Errorf("failed to marshal audit snapshot: %v", err)
+		return nil
+	}
+	return data
+}
+
+// DiffAuditSnapshots Returns the fields which differ between two json snapshots. Nested fields are reported by their dotted
+// path, array elements by their index, and any field named password is reported without its values.
+func DiffAuditSnapshots(before, after json.RawMessage) []ConfigChange {
+	a, b := map[string]interface{}{}, map[string]interface{}{}
+	flattenAuditSnapshot(before, a)
+	flattenAuditSnapshot(after, b)
+
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	changes := []ConfigChange{}
+	for k := range keys {
+		if reflect.DeepEqual(a[k], b[k]) {
+			continue
+		}
+
+		if strings.HasSuffix(strings.ToLower(k), "password") {
+			changes = append(changes, ConfigChange{Field: k, From: RedactedPassword, To: RedactedPassword})
+			continue
+		}
+		changes = append(changes, ConfigChange{Field: k, From: a[k], To: b[k]})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// flattenAuditSnapshot Adds the leaf values of a json snapshot to fields keyed by their dotted path.
+func flattenAuditSnapshot(snapshot json.RawMessage, fields map[string]interface{}) {
+	if len(snapshot) == 0 {
+		return
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(snapshot, &value); err != nil {
+		return
+	}
+	flattenAuditValue("", value, fields)
+}
+
+func flattenAuditValue(path string, value interface{}, fields map[string]interface{}) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if auditIgnoredFields[key] {
+				continue
+			}
+			flattenAuditValue(join(key), child, fields)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenAuditValue(join(strconv.Itoa(i)), child, fields)
+		}
+	default:
+		if path == "" {
+			path = "value"
+		}
+		fields[path] = v
+	}
+}
+
+// AuditFilter narrows the audit entries returned by ListAuditEntries. Zero values do not filter.
+type AuditFilter struct {
+	// UserID limits entries to actions a user took or which were taken on their resources
+	UserID         uint
+	ActorDiscordID string
+	Action         string
+	TargetType     string
+	TargetID       string
+	RequestID      string
+}
+
+// ListAuditEntries Returns a page of audit entries newest first along with the total number of matching entries.
+func ListAuditEntries(db *gorm.DB, filter AuditFilter, page, limit int) ([]AuditEntry, int64, error) {
+	query := db.Model(&AuditEntry{})
+	if filter.UserID != 0 {
+		query = query.Where("owner_id = ? OR actor_id = ?", filter.UserID, filter.UserID)
+	}
+	if filter.ActorDiscordID != "" {
+		query = query.Where("actor_discord_id = ?", filter.ActorDiscordID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %v", err)
+	}
+
+	var entries []AuditEntry
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %v", err)
+	}
+	return entries, total, nil
+}
+
+// AuditRetention Returns how long audit entries are kept, read from AUDIT_RETENTION_DAYS.
+func AuditRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("AUDIT_RETENTION_DAYS"))
+	if err != nil || days < 1 {
+		days = DefaultAuditRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PruneAuditEntries Deletes audit entries created before a time in batches and returns the number deleted.
+func PruneAuditEntries(db *gorm.DB, before time.Time) (int64, error) {
+	var deleted int64
+	for {
+		var ids []uint
+		if err := db.Model(&AuditEntry{}).Where("created_at < ?", before).Limit(auditPruneBatch).Pluck("id", &ids).Error; err != nil {
+			return deleted, fmt.Errorf("failed to list expired audit entries: %v", err)
+		}
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+
+		tx := db.Where("id IN ?", ids).Delete(&AuditEntry{})
+		if tx.Error != nil {
+			return deleted, fmt.Errorf("failed to delete expired audit entries: %v", tx.Error)
+		}
+		deleted += tx.RowsAffected
+	}
+}
+
+// RunAuditRetention Prunes audit entries older than the retention period every interval until the context is cancelled.
+func RunAuditRetention(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := PruneAuditEntries(db, time.Now().Add(-AuditRetention()))
+		if err != nil {
+			log.Errorf("failed to prune audit entries: %v", err)
+		} else if deleted > 0 {
+			log.Infof("pruned %d audit entries older than the retention period", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeAuditContext map[string]any
+
+func (f fakeAuditContext) Set(key string, value any) {
+	f[key] = value
+}
+
+func (f fakeAuditContext) Get(key string) (any, bool) {
+	v, ok := f[key]
+	return v, ok
+}
+
+func TestDiffAuditSnapshots(t *testing.T) {
+	before := model.Server{ID: 1, State: model.RUNNING, WorldDetails: model.WorldDetails{Name: "a", Password: "secret1"}}
+	after := before
+	after.State = model.TERMINATED
+	after.UpdatedAt = time.Now()
+	after.WorldDetails.Password = "secret2"
+	after.WorldDetails.Modifiers = []model.Modifier{{Key: "raids", Value: "none"}}
+
+	changes := DiffAuditSnapshots(auditSnapshot(before), auditSnapshot(after))
+	fields := map[string]ConfigChange{}
+	for _, change := range changes {
+		fields[change.Field] = change
+	}
+
+	assert.Equal(t, ConfigChange{Field: "state", From: model.RUNNING, To: model.TERMINATED}, fields["state"])
+	assert.Equal(t, RedactedPassword, fields["world_details.password"].To)
+	assert.Equal(t, "none", fields["world_details.modifiers.0.value"].To)
+	assert.NotContains(t, fields, "updated_at")
+}
+
+func TestNewAuditEntry(t *testing.T) {
+	c := fakeAuditContext{}
+	assert.Nil(t, GetAudit(c))
+
+	SetAudit(c, AuditRecord{Action: "server.scale", TargetType: "server", TargetID: uint(7), Before: map[string]int{"replicas": 1}, After: map[string]int{"replicas": 0}})
+	entry := NewAuditEntry(&model.User{ID: 3, DiscordID: "123"}, GetAudit(c))
+
+	assert.Equal(t, "7", entry.TargetID)
+	assert.Equal(t, uint(3), entry.OwnerID)
+	assert.Equal(t, "123", entry.ActorDiscordID)
+	assert.Equal(t, []ConfigChange{{Field: "replicas", From: float64(1), To: float64(0)}}, entry.Changes)
+
+	var nilOverride *LimitsOverride
+	entry = NewAuditEntry(nil, &AuditRecord{Action: "billing.customer.subscription.created", OwnerID: 9, Before: nilOverride})
+	assert.Nil(t, entry.Before)
+	assert.Empty(t, entry.Changes)
+	assert.Equal(t, uint(9), entry.OwnerID)
+}
+
+func TestAuditRetention(t *testing.T) {
+	t.Setenv("AUDIT_RETENTION_DAYS", "30")
+	assert.Equal(t, 30*24*time.Hour, AuditRetention())
+
+	t.Setenv("AUDIT_RETENTION_DAYS", "forever")
+	assert.Equal(t, DefaultAuditRetentionDays*24*time.Hour, AuditRetention())
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// BepInExConfig is a parsed BepInEx .cfg file. The original lines are kept so edits only change the values of entries and
+// every comment, blank line, and unknown line is written back as it was.
+type BepInExConfig struct {
+	// Header is the comment block before the first section i.e. the plugin name and GUID
+	Header   []string        `json:"header"`
+	Sections []ConfigSection `json:"sections"`
+
+	lines   []string
+	bom     bool
+	newline string
+}
+
+// ConfigSection is a [Section] of a BepInEx config file.
+type ConfigSection struct {
+	Name    string        `json:"name"`
+	Entries []ConfigEntry `json:"entries"`
+}
+
+// ConfigEntry is a single setting along with the metadata BepInEx writes in the comments above it.
+type ConfigEntry struct {
+	Key              string   `json:"key"`
+	Value            string   `json:"value"`
+	Description      string   `json:"description,omitempty"`
+	Type             string   `json:"type,omitempty"`
+	Default          string   `json:"default,omitempty"`
+	AcceptableValues []string `json:"acceptable_values,omitempty"`
+	Min              *float64 `json:"min,omitempty"`
+	Max              *float64 `json:"max,omitempty"`
+
+	// Multiple is set for flag enums which accept a comma separated list of the acceptable values
+	Multiple bool `json:"multiple,omitempty"`
+
+	line int
+}
+
+// ConfigEdit is a change to the value of a single config entry.
+type ConfigEdit struct {
+	Section string `json:"section"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+}
+
+// ParseBepInExConfig Parses a BepInEx config file. Entries are described by the "## " description lines and the "# Setting type",
+// "# Default value", "# Acceptable values", and "# Acceptable value range" lines BepInEx writes above each setting.
+func ParseBepInExConfig(data []byte) (*BepInExConfig, error) {
+	if err := ValidateIni(data); err != nil {
+		return nil, err
+	}
+
+	cfg := &BepInExConfig{Header: []string{}, Sections: []ConfigSection{}, newline: "\n"}
+	if bytes.HasPrefix(data, []byte("\ufeff")) {
+		cfg.bom = true
+		data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		cfg.newline = "\r\n"
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	var section *ConfigSection
+	var pending ConfigEntry
+	var description []string
+
+	for scanner.Scan() {
+		raw := strings.TrimSuffix(scanner.Text(), "\r")
+		cfg.lines = append(cfg.lines, raw)
+		line := strings.TrimSpace(raw)
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "["):
+			cfg.Sections = append(cfg.Sections, ConfigSection{Name: strings.TrimSpace(line[1 : len(line)-1]), Entries: []ConfigEntry{}})
+			section = &cfg.Sections[len(cfg.Sections)-1]
+			pending, description = ConfigEntry{}, nil
+		case strings.HasPrefix(line, "##"):
+			text := strings.TrimSpace(strings.TrimPrefix(line, "##"))
+			if section == nil {
+				cfg.Header = append(cfg.Header, text)
+				continue
+			}
+			description = append(description, text)
+		case strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"):
+			if err := pending.readMetadata(strings.TrimSpace(line[1:])); err != nil {
+				return nil, fmt.Errorf("line %d: %v", len(cfg.lines), err)
+			}
+		default:
+			key, value, _ := strings.Cut(line, "=")
+			pending.Key = strings.TrimSpace(key)
+			pending.Value = strings.TrimSpace(value)
+			pending.Description = strings.Join(description, "\n")
+			pending.line = len(cfg.lines) - 1
+
+			if section == nil {
+				cfg.Sections = append(cfg.Sections, ConfigSection{Entries: []ConfigEntry{}})
+				section = &cfg.Sections[len(cfg.Sections)-1]
+			}
+			section.Entries = append(section.Entries, pending)
+			pending, description = ConfigEntry{}, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readMetadata Reads a "# Name: value" comment describing the next entry. Unknown comments are ignored.
+func (e *ConfigEntry) readMetadata(comment string) error {
+	if strings.HasPrefix(comment, "Multiple values can be set") {
+		e.Multiple = true
+		return nil
+	}
+
+	name, value, found := strings.Cut(comment, ":")
+	if !found {
+		return nil
+	}
+	value = strings.TrimSpace(value)
+
+	switch strings.TrimSpace(name) {
+	case "Setting type":
+		e.Type = value
+	case "Default value":
+		e.Default = value
+	case "Acceptable values":
+		for _, v := range strings.Split(value, ",") {
+			e.AcceptableValues = append(e.AcceptableValues, strings.TrimSpace(v))
+		}
+	case "Acceptable value range":
+		var low, high string
+		if _, err := fmt.Sscanf(value, "From %s to %s", &low, &high); err != nil {
+			return fmt.Errorf("malformed value range: %s", value)
+		}
+		from, err := strconv.ParseFloat(low, 64)
+		if err != nil {
+			return fmt.Errorf("malformed value range: %s", value)
+		}
+		to, err := strconv.ParseFloat(high, 64)
+		if err != nil {
+			return fmt.Errorf("malformed value range: %s", value)
+		}
+		e.Min, e.Max = &from, &to
+	}
+	return nil
+}
+
+// Entry Returns the entry with a key in a section or nil when it does not exist.
+func (c *BepInExConfig) Entry(section, key string) *ConfigEntry {
+	for i := range c.Sections {
+		if c.Sections[i].Name != section {
+			continue
+		}
+		for j := range c.Sections[i].Entries {
+			if c.Sections[i].Entries[j].Key == key {
+				return &c.Sections[i].Entries[j]
+			}
+		}
+	}
+	return nil
+}
+
+// Apply Validates and applies a set of edits. No edits are applied unless every edit is valid, the returned errors describe
+// each invalid edit.
+func (c *BepInExConfig) Apply(edits []ConfigEdit) []string {
+	var errs []string
+	for _, edit := range edits {
+		entry := c.Entry(edit.Section, edit.Key)
+		if entry == nil {
+			errs = append(errs, fmt.Sprintf("[%s] %s: no such setting", edit.Section, edit.Key))
+			continue
+		}
+		if err := entry.Validate(edit.Value); err != nil {
+			errs = append(errs, fmt.Sprintf("[%s] %s: %v", edit.Section, edit.Key, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for _, edit := range edits {
+		entry := c.Entry(edit.Section, edit.Key)
+		entry.Value = strings.TrimSpace(edit.Value)
+		c.lines[entry.line] = fmt.Sprintf("%s = %s", entry.Key, entry.Value)
+	}
+	return nil
+}
+
+// Bytes Returns the config file with any edits applied.
+func (c *BepInExConfig) Bytes() []byte {
+	out := strings.Join(c.lines, c.newline) + c.newline
+	if c.bom {
+		out = "\ufeff" + out
+	}
+	return []byte(out)
+}
+
+// Validate Checks a value against the type, acceptable values, and range declared for an entry. Entries without a declared
+// type accept any single line value.
+func (e *ConfigEntry) Validate(value string) error {
+	value = strings.TrimSpace(value)
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("value must be a single line")
+	}
+
+	if len(e.AcceptableValues) > 0 {
+		values := []string{value}
+		if e.Multiple {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			if !e.acceptable(strings.TrimSpace(v)) {
+				return fmt.Errorf("%q is not one of: %s", strings.TrimSpace(v), strings.Join(e.AcceptableValues, ", "))
+			}
+		}
+		return nil
+	}
+
+	var number float64
+	var err error
+	switch e.Type {
+	case "Boolean":
+		if !strings.EqualFold(value, "true") && !strings.EqualFold(value, "false") {
+			return fmt.Errorf("expected true or false")
+		}
+		return nil
+	case "Byte", "UInt16", "UInt32", "UInt64":
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, integerBits(e.Type))
+		number = float64(n)
+	case "SByte", "Int16", "Int32", "Int64":
+		var n int64
+		n, err = strconv.ParseInt(value, 10, integerBits(e.Type))
+		number = float64(n)
+	case "Single", "Double", "Decimal":
+		number, err = strconv.ParseFloat(value, 64)
+		if err == nil && (math.IsNaN(number) || math.IsInf(number, 0)) {
+			err = fmt.Errorf("not a finite number")
+		}
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("expected a value of type %s", e.Type)
+	}
+
+	if e.Min != nil && e.Max != nil && (number < *e.Min || number > *e.Max) {
+		return fmt.Errorf("value must be between %s and %s", strconv.FormatFloat(*e.Min, 'f', -1, 64), strconv.FormatFloat(*e.Max, 'f', -1, 64))
+	}
+	return nil
+}
+
+func (e *ConfigEntry) acceptable(value string) bool {
+	for _, v := range e.AcceptableValues {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// integerBits Returns the size in bits of a .NET integer type.
+func integerBits(t string) int {
+	switch t {
+	case "Byte", "SByte":
+		return 8
+	case "Int16", "UInt16":
+		return 16
+	case "Int32", "UInt32":
+		return 32
+	default:
+		return 64
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const testBepInExConfig = "## Settings file was created by plugin Jotunn v2.20.0\r\n" +
+	"## Plugin GUID: com.jotunn.jotunn\r\n" +
+	"\r\n" +
+	"[General]\r\n" +
+	"\r\n" +
+	"## Enables the mod\r\n" +
+	"# Setting type: Boolean\r\n" +
+	"# Default value: true\r\n" +
+	"Enabled = true\r\n" +
+	"\r\n" +
+	"## Number of portals\r\n" +
+	"# Setting type: Int32\r\n" +
+	"# Default value: 5\r\n" +
+	"# Acceptable value range: From 1 to 10\r\n" +
+	"Count = 5\r\n" +
+	"\r\n" +
+	"[Logging]\r\n" +
+	"\r\n" +
+	"# Setting type: LogLevel\r\n" +
+	"# Default value: Info\r\n" +
+	"# Acceptable values: None, Info, Warning, Debug\r\n" +
+	"# Multiple values can be set at the same time by separating them with , (e.g. Debug, Warning)\r\n" +
+	"Levels = Info, Warning\r\n"
+
+func TestParseBepInExConfig(t *testing.T) {
+	cfg, err := ParseBepInExConfig([]byte(testBepInExConfig))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Settings file was created by plugin Jotunn v2.20.0", "Plugin GUID: com.jotunn.jotunn"}, cfg.Header)
+	assert.Len(t, cfg.Sections, 2)
+
+	count := cfg.Entry("General", "Count")
+	assert.NotNil(t, count)
+	assert.Equal(t, "Int32", count.Type)
+	assert.Equal(t, "Number of portals", count.Description)
+	assert.Equal(t, 1.0, *count.Min)
+	assert.Equal(t, 10.0, *count.Max)
+
+	levels := cfg.Entry("Logging", "Levels")
+	assert.True(t, levels.Multiple)
+	assert.Equal(t, []string{"None", "Info", "Warning", "Debug"}, levels.AcceptableValues)
+
+	// Unedited files are written back byte for byte
+	assert.Equal(t, testBepInExConfig, string(cfg.Bytes()))
+}
+
+func TestConfigEntryValidate(t *testing.T) {
+	cfg, err := ParseBepInExConfig([]byte(testBepInExConfig))
+	assert.NoError(t, err)
+
+	assert.NoError(t, cfg.Entry("General", "Enabled").Validate("false"))
+	assert.Error(t, cfg.Entry("General", "Enabled").Validate("yes"))
+	assert.NoError(t, cfg.Entry("General", "Count").Validate("10"))
+	assert.Error(t, cfg.Entry("General", "Count").Validate("11"))
+	assert.Error(t, cfg.Entry("General", "Count").Validate("1.5"))
+	assert.NoError(t, cfg.Entry("Logging", "Levels").Validate("Debug, Warning"))
+	assert.Error(t, cfg.Entry("Logging", "Levels").Validate("Debug, Verbose"))
+}
+
+func TestBepInExConfigApply(t *testing.T) {
+	cfg, err := ParseBepInExConfig([]byte(testBepInExConfig))
+	assert.NoError(t, err)
+
+	errs := cfg.Apply([]ConfigEdit{
+		{Section: "General", Key: "Count", Value: "7"},
+		{Section: "General", Key: "Missing", Value: "1"},
+	})
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "5", cfg.Entry("General", "Count").Value)
+
+	errs = cfg.Apply([]ConfigEdit{{Section: "General", Key: "Count", Value: "7"}})
+	assert.Empty(t, errs)
+	assert.Equal(t, strings.Replace(testBepInExConfig, "Count = 5", "Count = 7", 1), string(cfg.Bytes()))
+}
@@ -0,0 +1,473 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CatalogSourceNexus        = "nexus"
+	CatalogSourceThunderstore = "thunderstore"
+
+	// maxCatalogVersions is the number of most recent versions stored for each mod in the catalog.
+	maxCatalogVersions = 10
+
+	// maxCatalogDownloadSize is the largest mod package (256MB) which will be downloaded from a catalog source.
+	maxCatalogDownloadSize = 256 << 20
+)
+
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// CatalogMod is a mod published on Nexus Mods or Thunderstore which users can browse and install.
+type CatalogMod struct {
+	ID              uint                `gorm:"primaryKey" json:"id"`
+	Source          string              `gorm:"column:source;size:32;uniqueIndex:idx_catalog_source_external" json:"source"`
+	ExternalID      string              `gorm:"column:external_id;size:191;uniqueIndex:idx_catalog_source_external" json:"external_id"`
+	Name            string              `gorm:"column:name;index" json:"name"`
+	FullName        string              `gorm:"column:full_name;index" json:"full_name"`
+	Author          string              `gorm:"column:author" json:"author"`
+	Summary         string              `gorm:"column:summary;type:text" json:"summary"`
+	ThumbnailURL    string              `gorm:"column:thumbnail_url" json:"thumbnail_url"`
+	WebsiteURL      string              `gorm:"column:website_url" json:"website_url"`
+	Downloads       int64               `gorm:"column:downloads" json:"downloads"`
+	LatestVersion   string              `gorm:"column:latest_version" json:"latest_version"`
+	Deprecated      bool                `gorm:"column:deprecated" json:"deprecated"`
+	SourceUpdatedAt time.Time           `gorm:"column:source_updated_at" json:"source_updated_at"`
+	CreatedAt       time.Time           `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt       time.Time           `gorm:"column:updated_at" json:"updated_at"`
+	Versions        []CatalogModVersion `gorm:"foreignKey:CatalogModID;constraint:OnDelete:CASCADE" json:"versions,omitempty"`
+}
+
+func (CatalogMod) TableName() string {
+	return "catalog_mods"
+}
+
+// CatalogModVersion is a single downloadable version of a catalog mod.
+type CatalogModVersion struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CatalogModID uint      `gorm:"column:catalog_mod_id;index" json:"catalog_mod_id"`
+	Version      string    `gorm:"column:version" json:"version"`
+	DownloadURL  string    `gorm:"column:download_url" json:"-"`
+	FileID       int64     `gorm:"column:file_id" json:"-"`
+	Dependencies []string  `gorm:"column:dependencies;serializer:json" json:"dependencies"`
+	FileSize     int64     `gorm:"column:file_size" json:"file_size"`
+	PublishedAt  time.Time `gorm:"column:published_at" json:"published_at"`
+}
+
+func (CatalogModVersion) TableName() string {
+	return "catalog_mod_versions"
+}
+
+// S3Key Returns the key a version of a catalog mod is stored under once installed. The plugin-manager installs shared mods from
+// mods/general/. Each version has its own key so the object is never replaced once written and servers which installed an
+// older version keep it until they are upgraded.
+func (m *CatalogMod) S3Key(version string) string {
+	name := m.FullName
+	if name == "" {
+		name = m.Name
+	}
+	return fmt.Sprintf("mods/general/%s-%s.zip", unsafeKeyChars.ReplaceAllString(name, "_"), unsafeKeyChars.ReplaceAllString(version, "_"))
+}
+
+// CatalogService Aggregates mods from Nexus Mods and Thunderstore into a catalog cached in the database.
+type CatalogService struct {
+	db           *gorm.DB
+	nexus        *ModNexusService
+	thunderstore *ThunderstoreService
+	httpClient   *http.Client
+}
+
+func MakeCatalogService(db *gorm.DB, nexus *ModNexusService, thunderstore *ThunderstoreService) *CatalogService {
+	return &CatalogService{
+		db:           db,
+		nexus:        nexus,
+		thunderstore: thunderstore,
+		httpClient:   &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Run Refreshes the catalog immediately and then on every interval until the context is cancelled. Installed plugins are
+// checked for updates after each refresh.
+func (c *CatalogService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Refresh(); err != nil {
+			log.Errorf("failed to refresh mod catalog: %v", err)
+		}
+
+		if available, err := c.CheckUpdates(); err != nil {
+			log.Errorf("failed to check installed mods for updates: %v", err)
+		} else {
+			log.Infof("found %d installed mods with updates available", available)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh Pulls the latest mods from every catalog source into the database. A failure in one source does not prevent
+// the other from being refreshed.
+func (c *CatalogService) Refresh() error {
+	var errs []error
+	if err := c.refreshThunderstore(); err != nil {
+		errs = append(errs, fmt.Errorf("thunderstore: %v", err))
+	}
+
+	if c.nexus.Enabled() {
+		if err := c.refreshNexus(); err != nil {
+			errs = append(errs, fmt.Errorf("nexus: %v", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *CatalogService) refreshThunderstore() error {
+	packages, err := c.thunderstore.ListPackages()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("refreshing %d thunderstore packages in mod catalog", len(packages))
+	for _, pkg := range packages {
+		if len(pkg.Versions) == 0 {
+			continue
+		}
+
+		// Thunderstore returns versions newest first
+		latest := pkg.Versions[0]
+		var downloads int64
+		for _, v := range pkg.Versions {
+			downloads += v.Downloads
+		}
+
+		mod := CatalogMod{
+			Source:          CatalogSourceThunderstore,
+			ExternalID:      pkg.UUID,
+			Name:            pkg.Name,
+			FullName:        pkg.FullName,
+			Author:          pkg.Owner,
+			Summary:         latest.Description,
+			ThumbnailURL:    latest.Icon,
+			WebsiteURL:      pkg.PackageUrl,
+			Downloads:       downloads,
+			LatestVersion:   latest.VersionNumber,
+			Deprecated:      pkg.IsDeprecated,
+			SourceUpdatedAt: pkg.DateUpdated,
+		}
+
+		var versions []CatalogModVersion
+		for i, v := range pkg.Versions {
+			if i >= maxCatalogVersions {
+				break
+			}
+			versions = append(versions, CatalogModVersion{
+				Version:      v.VersionNumber,
+				DownloadURL:  v.DownloadUrl,
+				Dependencies: v.Dependencies,
+				FileSize:     v.FileSize,
+				PublishedAt:  v.DateCreated,
+			})
+		}
+
+		if err = c.upsert(&mod, versions); err != nil {
+			log.Errorf("failed to upsert thunderstore package %s: %v", pkg.FullName, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *CatalogService) refreshNexus() error {
+	seen := map[int64]bool{}
+	for _, list := range []string{"latest_added", "latest_updated", "trending"} {
+		mods, err := c.nexus.ListMods(list)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range mods {
+			if seen[m.Id] || !m.Available {
+				continue
+			}
+			seen[m.Id] = true
+			c.upsertNexusMod(&m)
+		}
+	}
+
+	// Mods hearthhub already hosts are always kept in the catalog even once they fall off the lists above
+	for _, id := range c.nexus.MappedModIds() {
+		parsed, _ := strconv.ParseInt(id, 10, 64)
+		if seen[parsed] {
+			continue
+		}
+
+		m, err := c.nexus.GetMod(id)
+		if err != nil {
+			log.Errorf("failed to get nexus mod %s: %v", id, err)
+			continue
+		}
+		c.upsertNexusMod(m)
+	}
+
+	return nil
+}
+
+// upsertNexusMod Stores a Nexus mod without versions. Listing files costs an API request per mod so versions are
+// fetched lazily when a mod's details are requested.
+func (c *CatalogService) upsertNexusMod(m *Mod) {
+	updated, _ := time.Parse(time.RFC3339, m.Updated)
+	mod := CatalogMod{
+		Source:          CatalogSourceNexus,
+		ExternalID:      strconv.FormatInt(m.Id, 10),
+		Name:            m.Name,
+		FullName:        m.Name,
+		Author:          m.Author,
+		Summary:         m.Summary,
+		ThumbnailURL:    m.Image,
+		WebsiteURL:      fmt.Sprintf("https://www.nexusmods.com/valheim/mods/%d", m.Id),
+		Downloads:       m.Downloads,
+		LatestVersion:   m.Version,
+		SourceUpdatedAt: updated,
+	}
+
+	if err := c.upsert(&mod, nil); err != nil {
+		log.Errorf("failed to upsert nexus mod %d: %v", m.Id, err)
+	}
+}
+
+// upsert Inserts or updates a catalog mod by its source and external id. When versions are provided they replace the
+// versions currently stored for the mod.
+func (c *CatalogService) upsert(mod *CatalogMod, versions []CatalogModVersion) error {
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit("Versions").Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "source"}, {Name: "external_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"name", "full_name", "author", "summary", "thumbnail_url", "website_url", "downloads",
+				"latest_version", "deprecated", "source_updated_at", "updated_at",
+			}),
+		}).Create(mod).Error
+		if err != nil {
+			return err
+		}
+
+		if versions == nil {
+			return nil
+		}
+
+		// The id is not populated by MySQL when the upsert takes the update path
+		var stored CatalogMod
+		if err = tx.Select("id").Where("source = ? AND external_id = ?", mod.Source, mod.ExternalID).First(&stored).Error; err != nil {
+			return err
+		}
+
+		if err = tx.Where("catalog_mod_id = ?", stored.ID).Delete(&CatalogModVersion{}).Error; err != nil {
+			return err
+		}
+
+		for i := range versions {
+			versions[i].CatalogModID = stored.ID
+		}
+		return tx.Create(&versions).Error
+	})
+}
+
+// Search Returns a page of catalog mods matching the query ordered by downloads along with the total number of matches.
+func (c *CatalogService) Search(query, source string, page, limit int) ([]CatalogMod, int64, error) {
+	tx := c.db.Model(&CatalogMod{}).Where("deprecated = ?", false)
+	if query != "" {
+		like := "%" + query + "%"
+		tx = tx.Where("name LIKE ? OR full_name LIKE ? OR author LIKE ? OR summary LIKE ?", like, like, like, like)
+	}
+
+	if source != "" {
+		tx = tx.Where("source = ?", source)
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count catalog mods: %v", err)
+	}
+
+	var mods []CatalogMod
+	err := tx.Order("downloads DESC").Offset((page - 1) * limit).Limit(limit).Find(&mods).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search catalog mods: %v", err)
+	}
+
+	return mods, total, nil
+}
+
+// Get Returns a catalog mod and its versions. Nexus versions are fetched and cached the first time they are requested.
+func (c *CatalogService) Get(id uint) (*CatalogMod, error) {
+	var mod CatalogMod
+	err := c.db.Preload("Versions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("published_at DESC")
+	}).First(&mod, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if mod.Source == CatalogSourceNexus && len(mod.Versions) == 0 && c.nexus.Enabled() {
+		files, err := c.nexus.GetModFiles(mod.ExternalID)
+		if err != nil {
+			log.Errorf("failed to get files for nexus mod %s: %v", mod.ExternalID, err)
+			return &mod, nil
+		}
+
+		var versions []CatalogModVersion
+		for _, f := range files {
+			// Only main files are installable, optional files and old versions are skipped
+			if f.CategoryName != "MAIN" {
+				continue
+			}
+			versions = append(versions, CatalogModVersion{
+				Version:     f.Version,
+				FileID:      f.FileId,
+				FileSize:    f.SizeKb * 1024,
+				PublishedAt: time.Unix(f.UploadedTimestamp, 0),
+			})
+		}
+
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i].PublishedAt.After(versions[j].PublishedAt)
+		})
+
+		if len(versions) > maxCatalogVersions {
+			versions = versions[:maxCatalogVersions]
+		}
+
+		if len(versions) > 0 {
+			if err = c.upsert(&mod, versions); err != nil {
+				log.Errorf("failed to store versions for nexus mod %s: %v", mod.ExternalID, err)
+			}
+			mod.Versions = versions
+		}
+	}
+
+	return &mod, nil
+}
+
+// FindByFullName Returns the catalog mod with a Thunderstore style full name i.e. denikson-BepInExPack_Valheim.
+func (c *CatalogService) FindByFullName(fullName string) (*CatalogMod, error) {
+	var mod CatalogMod
+	err := c.db.Where("full_name = ?", fullName).Order("downloads DESC").First(&mod).Error
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(mod.ID)
+}
+
+// Install Downloads a version of a catalog mod (the latest when version is empty) and stores it in S3 under mods/general/
+// where the plugin-manager installs mods from. Versions which are already stored are not downloaded again and existing
+// objects are never overwritten. The S3 key and installed version are returned.
+func (c *CatalogService) Install(ctx context.Context, s3Service *S3Service, id uint, version string) (string, *CatalogModVersion, error) {
+	mod, err := c.Get(id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(mod.Versions) == 0 {
+		return "", nil, fmt.Errorf("mod %s has no installable versions", mod.Name)
+	}
+
+	selected := &mod.Versions[0]
+	if version != "" {
+		selected = nil
+		for i := range mod.Versions {
+			if mod.Versions[i].Version == version {
+				selected = &mod.Versions[i]
+				break
+			}
+		}
+		if selected == nil {
+			return "", nil, fmt.Errorf("version %s not found for mod %s", version, mod.Name)
+		}
+	}
+
+	// Versioned keys are immutable so a version which was already mirrored is never downloaded or written again
+	key := mod.S3Key(selected.Version)
+	if _, err = s3Service.HeadObject(ctx, key); err == nil {
+		return key, selected, nil
+	}
+
+	url := selected.DownloadURL
+	if mod.Source == CatalogSourceNexus {
+		url, err = c.nexus.GetDownloadLink(mod.ExternalID, selected.FileID)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get nexus download link: %v", err)
+		}
+	}
+
+	data, err := c.download(ctx, url)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, err = zip.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+		return "", nil, fmt.Errorf("downloaded package is not a valid zip archive: %v", err)
+	}
+
+	if err = s3Service.PutObject(ctx, key, data, "application/zip"); err != nil {
+		return "", nil, err
+	}
+
+	log.Infof("installed catalog mod %s version %s to %s", mod.Name, selected.Version, key)
+	return key, selected, nil
+}
+
+func (c *CatalogService) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %v", err)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download mod package: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("mod package download returned status: %d", res.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxCatalogDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mod package: %v", err)
+	}
+
+	if len(data) > maxCatalogDownloadSize {
+		return nil, errors.New("mod package exceeds the maximum download size")
+	}
+
+	return data, nil
+}
+
+// ParseDependency Splits a Thunderstore dependency string (Owner-Name-Major.Minor.Patch) into the package full name and version.
+func ParseDependency(dependency string) (string, string, error) {
+	idx := strings.LastIndex(dependency, "-")
+	if idx <= 0 || idx == len(dependency)-1 {
+		return "", "", fmt.Errorf("invalid dependency: %s", dependency)
+	}
+	return dependency[:idx], dependency[idx+1:], nil
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseDependency(t *testing.T) {
+	name, version, err := ParseDependency("denikson-BepInExPack_Valheim-5.4.2202")
+	assert.Nil(t, err)
+	assert.Equal(t, "denikson-BepInExPack_Valheim", name)
+	assert.Equal(t, "5.4.2202", version)
+
+	_, _, err = ParseDependency("invalid")
+	assert.NotNil(t, err)
+}
+
+func TestCatalogModS3Key(t *testing.T) {
+	mod := CatalogMod{Name: "Valheim Plus", FullName: "Grantapher-ValheimPlus"}
+	assert.Equal(t, "mods/general/Grantapher-ValheimPlus-0.9.9.zip", mod.S3Key("0.9.9"))
+	assert.NotEqual(t, mod.S3Key("0.9.9"), mod.S3Key("0.9.10"))
+
+	mod = CatalogMod{Name: "Better UI / Reforged"}
+	assert.Equal(t, "mods/general/Better_UI_Reforged-1.0_1.zip", mod.S3Key("1.0/1"))
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ConfigRevision is a version of a server's world details. A revision is recorded every time the world details change so
+// changes can be reviewed and rolled back.
+type ConfigRevision struct {
+	ID        uint               `gorm:"primaryKey" json:"id"`
+	ServerID  uint               `gorm:"column:server_id;uniqueIndex:idx_revision_server_number" json:"server_id"`
+	Revision  int                `gorm:"column:revision;uniqueIndex:idx_revision_server_number" json:"revision"`
+	AuthorID  uint               `gorm:"column:author_id" json:"author_id"`
+	Author    string             `gorm:"column:author" json:"author"`
+	Reason    string             `gorm:"column:reason" json:"reason"`
+	World     model.WorldDetails `gorm:"column:world;serializer:json" json:"world"`
+	CreatedAt time.Time          `gorm:"column:created_at" json:"created_at"`
+}
+
+func (ConfigRevision) TableName() string {
+	return "config_revisions"
+}
+
+// ConfigChange is a single field which differs between two revisions.
+type ConfigChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// revisionIgnoredFields are world details fields which are bookkeeping rather than configuration.
+var revisionIgnoredFields = map[string]bool{
+	"id":         true,
+	"server_id":  true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+	"modifiers":  true,
+}
+
+// RecordConfigRevision Saves the current world details of a server as its next revision. The server row is locked while the
+// next revision number is chosen so concurrent changes to the same server are numbered one after the other.
+func RecordConfigRevision(db *gorm.DB, server *model.Server, author *model.User, reason string) (*ConfigRevision, error) {
+	revision := &ConfigRevision{
+		ServerID: server.ID,
+		AuthorID: author.ID,
+		Author:   author.DiscordUsername,
+		Reason:   reason,
+		World:    snapshotWorld(&server.WorldDetails),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked model.Server
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", server.ID).First(&locked).Error; err != nil {
+			return err
+		}
+
+		var latest int
+		if err := tx.Model(&ConfigRevision{}).Where("server_id = ?", server.ID).Select("COALESCE(MAX(revision), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		revision.Revision = latest + 1
+		return tx.Create(revision).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record config revision: %v", err)
+	}
+	return revision, nil
+}
+
+// ListConfigRevisions Returns the revisions of a server, newest first.
+func ListConfigRevisions(db *gorm.DB, serverId uint) ([]ConfigRevision, error) {
+	var revisions []ConfigRevision
+	if err := db.Where("server_id = ?", serverId).Order("revision DESC").Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list config revisions: %v", err)
+	}
+	return revisions, nil
+}
+
+// GetConfigRevision Returns a single revision of a server.
+func GetConfigRevision(db *gorm.DB, serverId uint, revision int) (*ConfigRevision, error) {
+	var r ConfigRevision
+	if err := db.Where("server_id = ? AND revision = ?", serverId, revision).First(&r).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// SaveWorldDetails Replaces the world details of a server, including its modifiers, and updates the server in place. The
+// world keeps the id and server of the existing world details so the row is updated rather than a new row being created.
+func SaveWorldDetails(db *gorm.DB, server *model.Server, world *model.WorldDetails) error {
+	updated := *world
+	updated.ID = server.WorldDetails.ID
+	updated.ServerID = server.ID
+	updated.CreatedAt = server.WorldDetails.CreatedAt
+
+	modifiers := make([]model.Modifier, 0, len(world.Modifiers))
+	for _, m := range world.Modifiers {
+		modifiers = append(modifiers, model.Modifier{Key: m.Key, Value: m.Value})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Modifiers").Save(&updated).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("world_id = ?", updated.ID).Delete(&model.Modifier{}).Error; err != nil {
+			return err
+		}
+
+		for i := range modifiers {
+			modifiers[i].WorldID = updated.ID
+		}
+		if len(modifiers) == 0 {
+			return nil
+		}
+		return tx.Create(&modifiers).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save world details: %v", err)
+	}
+
+	updated.Modifiers = modifiers
+	server.WorldDetails = updated
+	return nil
+}
+
+// DiffWorldDetails Returns the configuration fields which differ between two versions of a server's world details. Modifiers
+// are compared by key and reported as modifiers.<key>. A changed password is reported without its values.
+func DiffWorldDetails(from, to *model.WorldDetails) []ConfigChange {
+	a, b := worldFields(from), worldFields(to)
+
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	changes := []ConfigChange{}
+	for k := range keys {
+		if reflect.DeepEqual(a[k], b[k]) {
+			continue
+		}
+		if k == "password" {
+			changes = append(changes, ConfigChange{Field: k, From: RedactedPassword, To: RedactedPassword})
+			continue
+		}
+		changes = append(changes, ConfigChange{Field: k, From: a[k], To: b[k]})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// worldFields Flattens world details into their JSON field names.
+func worldFields(world *model.WorldDetails) map[string]interface{} {
+	fields := map[string]interface{}{}
+	data, _ := json.Marshal(world)
+	_ = json.Unmarshal(data, &fields)
+
+	for k := range revisionIgnoredFields {
+		delete(fields, k)
+	}
+
+	for _, m := range world.Modifiers {
+		fields["modifiers."+m.Key] = m.Value
+	}
+	return fields
+}
+
+// snapshotWorld Returns a copy of world details without database bookkeeping so it can be stored in a revision.
+func snapshotWorld(world *model.WorldDetails) model.WorldDetails {
+	snapshot := *world
+	snapshot.ID = 0
+	snapshot.ServerID = 0
+	snapshot.CreatedAt = time.Time{}
+	snapshot.UpdatedAt = time.Time{}
+
+	snapshot.Modifiers = make([]model.Modifier, 0, len(world.Modifiers))
+	for _, m := range world.Modifiers {
+		snapshot.Modifiers = append(snapshot.Modifiers, model.Modifier{Key: m.Key, Value: m.Value})
+	}
+	return snapshot
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiffWorldDetails(t *testing.T) {
+	from := &model.WorldDetails{
+		ID:          1,
+		Name:        "Vikings",
+		World:       "Midgard",
+		BackupCount: 3,
+		Modifiers:   []model.Modifier{{ID: 1, Key: "combat", Value: "hard"}, {ID: 2, Key: "raids", Value: "none"}},
+	}
+	to := &model.WorldDetails{
+		ID:          2,
+		Name:        "Vikings",
+		World:       "Midgard",
+		BackupCount: 5,
+		Modifiers:   []model.Modifier{{ID: 3, Key: "combat", Value: "veryhard"}, {ID: 4, Key: "portals", Value: "casual"}},
+	}
+
+	changes := DiffWorldDetails(from, to)
+	assert.Equal(t, []ConfigChange{
+		{Field: "backup_count", From: float64(3), To: float64(5)},
+		{Field: "modifiers.combat", From: "hard", To: "veryhard"},
+		{Field: "modifiers.portals", From: nil, To: "casual"},
+		{Field: "modifiers.raids", From: "none", To: nil},
+	}, changes)
+
+	assert.Empty(t, DiffWorldDetails(from, from))
+}
+
+func TestSnapshotWorld(t *testing.T) {
+	world := &model.WorldDetails{ID: 7, ServerID: 3, Name: "Vikings", Modifiers: []model.Modifier{{ID: 9, WorldID: 7, Key: "combat", Value: "hard"}}}
+
+	snapshot := snapshotWorld(world)
+	assert.Zero(t, snapshot.ID)
+	assert.Zero(t, snapshot.ServerID)
+	assert.Equal(t, []model.Modifier{{Key: "combat", Value: "hard"}}, snapshot.Modifiers)
+	assert.Empty(t, DiffWorldDetails(world, &snapshot))
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// preinstalledPackages are dependencies which ship with the Valheim server image and never need to be installed.
+var preinstalledPackages = map[string]bool{
+	"BepInExPack_Valheim": true,
+}
+
+// knownIncompatibilities maps a mod name to mods which cannot be installed alongside it.
+var knownIncompatibilities = map[string][]string{
+	"ValheimPlus":       {"ValheimPlus_Grant"},
+	"ValheimPlus_Grant": {"ValheimPlus"},
+}
+
+// PackageSource Locates mod packages and reads their manifests while resolving dependencies.
+type PackageSource interface {
+	// Manifest Returns the manifest of the package stored at the S3 key.
+	Manifest(ctx context.Context, key string) (*PackageManifest, error)
+
+	// Locate Makes a dependency available in S3 and returns its key. The dependency is a Thunderstore full name i.e. Owner-Name.
+	Locate(ctx context.Context, fullName string) (string, error)
+}
+
+// InstallStep is a single package which must be installed for an install request, ordered so dependencies come first.
+type InstallStep struct {
+	Prefix     string           `json:"prefix"`
+	Manifest   *PackageManifest `json:"manifest"`
+	Dependency bool             `json:"dependency"`
+}
+
+// InstallPlan is the ordered set of packages an install resolves to along with any conflicts found in the dependency graph.
+type InstallPlan struct {
+	Steps     []InstallStep `json:"steps"`
+	Conflicts []string      `json:"conflicts"`
+}
+
+// ResolveInstall Resolves the dependency graph of the package at prefix against the mods already installed on a server. Missing
+// dependencies are located through the source and returned as steps before the packages which depend on them. Dependencies
+// installed at an older version than required, duplicate DLLs, and known incompatibilities are reported as conflicts.
+func ResolveInstall(ctx context.Context, source PackageSource, installed []InstalledFile, prefix string) (*InstallPlan, error) {
+	r := &resolver{
+		ctx:       ctx,
+		source:    source,
+		installed: map[string]InstalledFile{},
+		planned:   map[string]*PackageManifest{},
+		visiting:  map[string]bool{},
+		plan:      &InstallPlan{},
+	}
+
+	for _, f := range installed {
+		// The package being installed replaces whatever is currently at its prefix
+		if f.Prefix != prefix {
+			r.installed[f.Name] = f
+		}
+	}
+
+	manifest, err := source.Manifest(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.visit(prefix, manifest, false); err != nil {
+		return nil, err
+	}
+
+	r.checkDLLs()
+	r.checkIncompatibilities()
+	return r.plan, nil
+}
+
+type resolver struct {
+	ctx       context.Context
+	source    PackageSource
+	installed map[string]InstalledFile
+	planned   map[string]*PackageManifest
+	visiting  map[string]bool
+	plan      *InstallPlan
+}
+
+func (r *resolver) visit(prefix string, manifest *PackageManifest, dependency bool) error {
+	if r.visiting[manifest.Name] {
+		return fmt.Errorf("circular dependency detected on %s", manifest.Name)
+	}
+	r.visiting[manifest.Name] = true
+	defer delete(r.visiting, manifest.Name)
+
+	for _, dep := range manifest.Dependencies {
+		fullName, version, err := ParseDependency(dep)
+		if err != nil {
+			return err
+		}
+
+		name := DependencyPackageName(fullName)
+		if preinstalledPackages[name] {
+			continue
+		}
+
+		if r.visiting[name] {
+			return fmt.Errorf("circular dependency detected between %s and %s", manifest.Name, name)
+		}
+
+		if f, ok := r.installed[name]; ok {
+			r.requireVersion(manifest.Name, name, f.Version, version)
+			continue
+		}
+
+		if m, ok := r.planned[name]; ok {
+			r.requireVersion(manifest.Name, name, m.Version, version)
+			continue
+		}
+
+		depPrefix, err := r.source.Locate(r.ctx, fullName)
+		if err != nil {
+			return fmt.Errorf("failed to locate dependency %s of %s: %v", fullName, manifest.Name, err)
+		}
+
+		depManifest, err := r.source.Manifest(r.ctx, depPrefix)
+		if err != nil {
+			return fmt.Errorf("failed to read dependency %s of %s: %v", fullName, manifest.Name, err)
+		}
+
+		r.requireVersion(manifest.Name, name, depManifest.Version, version)
+		if err = r.visit(depPrefix, depManifest, true); err != nil {
+			return err
+		}
+	}
+
+	r.planned[manifest.Name] = manifest
+	r.plan.Steps = append(r.plan.Steps, InstallStep{Prefix: prefix, Manifest: manifest, Dependency: dependency})
+	return nil
+}
+
+func (r *resolver) requireVersion(dependent, name, available, required string) {
+	if available == "" || required == "" {
+		return
+	}
+
+	if CompareVersions(available, required) < 0 {
+		r.plan.Conflicts = append(r.plan.Conflicts, fmt.Sprintf("%s requires %s %s or newer but %s is available", dependent, name, required, available))
+	}
+}
+
+// checkDLLs Reports plugin DLLs which would be provided by more than one mod on the server.
+func (r *resolver) checkDLLs() {
+	owners := map[string]string{}
+	for name, f := range r.installed {
+		for _, dll := range f.DLLs {
+			owners[strings.ToLower(dll)] = name
+		}
+	}
+
+	for _, step := range r.plan.Steps {
+		for _, dll := range step.Manifest.DLLs {
+			key := strings.ToLower(dll)
+			if owner, ok := owners[key]; ok && owner != step.Manifest.Name {
+				r.plan.Conflicts = append(r.plan.Conflicts, fmt.Sprintf("%s and %s both contain %s", step.Manifest.Name, owner, dll))
+				continue
+			}
+			owners[key] = step.Manifest.Name
+		}
+	}
+}
+
+func (r *resolver) checkIncompatibilities() {
+	for _, step := range r.plan.Steps {
+		for _, other := range knownIncompatibilities[step.Manifest.Name] {
+			_, installed := r.installed[other]
+			_, planned := r.planned[other]
+			if installed || planned {
+				r.plan.Conflicts = append(r.plan.Conflicts, fmt.Sprintf("%s is incompatible with %s", step.Manifest.Name, other))
+			}
+		}
+	}
+}
+
+// FindDependents Returns the names of installed mods which depend on the named mod.
+func FindDependents(installed []InstalledFile, name string) []string {
+	var dependents []string
+	for _, f := range installed {
+		for _, dep := range f.Dependencies {
+			fullName, _, err := ParseDependency(dep)
+			if err != nil {
+				continue
+			}
+			if DependencyPackageName(fullName) == name && f.Name != name {
+				dependents = append(dependents, f.Name)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// DependencyPackageName Returns the package name from a Thunderstore full name by removing the owner i.e. Owner-Name => Name.
+func DependencyPackageName(fullName string) string {
+	if idx := strings.Index(fullName, "-"); idx >= 0 {
+		return fullName[idx+1:]
+	}
+	return fullName
+}
+
+// CompareVersions Compares two dotted version numbers returning -1, 0, or 1. Missing parts are treated as 0 and non-numeric
+// parts are compared lexically.
+func CompareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y string
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+
+		xi, xErr := strconv.Atoi(defaultZero(x))
+		yi, yErr := strconv.Atoi(defaultZero(y))
+		if xErr == nil && yErr == nil {
+			if xi != yi {
+				if xi < yi {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func defaultZero(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
+
+// S3PackageSource Reads packages from S3 and installs missing dependencies into S3 from the mod catalog.
+type S3PackageSource struct {
+	S3Service      *S3Service
+	CatalogService *CatalogService
+	// MaxSize is the largest package uploaded by a user which is read, shared mods were downloaded by the catalog and are
+	// limited to the catalog's download size instead
+	MaxSize int64
+}
+
+func (s *S3PackageSource) Manifest(ctx context.Context, key string) (*PackageManifest, error) {
+	if strings.HasSuffix(strings.ToLower(key), ".dll") {
+		return ReadPackageManifest(key, nil)
+	}
+
+	limit := s.MaxSize
+	if strings.HasPrefix(key, "mods/general/") {
+		limit = maxCatalogDownloadSize
+	}
+
+	data, err := s.S3Service.GetObject(ctx, key, limit)
+	if err != nil {
+		return nil, err
+	}
+	return ReadPackageManifest(key, data)
+}
+
+func (s *S3PackageSource) Locate(ctx context.Context, fullName string) (string, error) {
+	// Mods uploaded to the shared prefix before catalog versions were mirrored are stored without a version
+	legacy := fmt.Sprintf("mods/general/%s.zip", unsafeKeyChars.ReplaceAllString(fullName, "_"))
+	if _, err := s.S3Service.HeadObject(ctx, legacy); err == nil {
+		return legacy, nil
+	}
+
+	if s.CatalogService == nil {
+		return "", errors.New("dependency is not available in hearthhub")
+	}
+
+	found, err := s.CatalogService.FindByFullName(fullName)
+	if err != nil {
+		return "", fmt.Errorf("dependency not found in mod catalog: %v", err)
+	}
+
+	key, _, err := s.CatalogService.Install(ctx, s.S3Service, found.ID, "")
+	return key, err
+}
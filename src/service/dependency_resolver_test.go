@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type fakePackageSource struct {
+	packages map[string]*PackageManifest
+}
+
+func (f *fakePackageSource) Manifest(ctx context.Context, key string) (*PackageManifest, error) {
+	m, ok := f.packages[key]
+	if !ok {
+		return nil, fmt.Errorf("package not found: %s", key)
+	}
+	return m, nil
+}
+
+func (f *fakePackageSource) Locate(ctx context.Context, fullName string) (string, error) {
+	key := fmt.Sprintf("mods/general/%s.zip", fullName)
+	if _, ok := f.packages[key]; !ok {
+		return "", fmt.Errorf("package not found: %s", fullName)
+	}
+	return key, nil
+}
+
+func TestResolveInstallOrdersDependencies(t *testing.T) {
+	source := &fakePackageSource{packages: map[string]*PackageManifest{
+		"mods/123/EpicLoot.zip": {Name: "EpicLoot", Version: "0.9.0", DLLs: []string{"EpicLoot.dll"}, Dependencies: []string{
+			"denikson-BepInExPack_Valheim-5.4.2202",
+			"ValheimModding-Jotunn-2.20.0",
+		}},
+		"mods/general/ValheimModding-Jotunn.zip": {Name: "Jotunn", Version: "2.21.0", DLLs: []string{"Jotunn.dll"}},
+	}}
+
+	plan, err := ResolveInstall(context.Background(), source, nil, "mods/123/EpicLoot.zip")
+	assert.Nil(t, err)
+	assert.Empty(t, plan.Conflicts)
+	assert.Len(t, plan.Steps, 2)
+	assert.Equal(t, "Jotunn", plan.Steps[0].Manifest.Name)
+	assert.True(t, plan.Steps[0].Dependency)
+	assert.Equal(t, "EpicLoot", plan.Steps[1].Manifest.Name)
+}
+
+func TestResolveInstallConflicts(t *testing.T) {
+	source := &fakePackageSource{packages: map[string]*PackageManifest{
+		"mods/123/EpicLoot.zip": {Name: "EpicLoot", Version: "0.9.0", DLLs: []string{"EpicLoot.dll", "Jotunn.dll"}, Dependencies: []string{
+			"ValheimModding-Jotunn-2.20.0",
+		}},
+	}}
+
+	installed := []InstalledFile{
+		{Prefix: "mods/general/ValheimModding-Jotunn.zip", Name: "Jotunn", Version: "2.19.1", DLLs: []string{"Jotunn.dll"}},
+	}
+
+	plan, err := ResolveInstall(context.Background(), source, installed, "mods/123/EpicLoot.zip")
+	assert.Nil(t, err)
+	assert.Len(t, plan.Steps, 1)
+	assert.Len(t, plan.Conflicts, 2)
+}
+
+func TestFindDependents(t *testing.T) {
+	installed := []InstalledFile{
+		{Name: "Jotunn"},
+		{Name: "EpicLoot", Dependencies: []string{"ValheimModding-Jotunn-2.20.0"}},
+	}
+	assert.Equal(t, []string{"EpicLoot"}, FindDependents(installed, "Jotunn"))
+	assert.Empty(t, FindDependents(installed, "EpicLoot"))
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, -1, CompareVersions("2.19.1", "2.20.0"))
+	assert.Equal(t, 0, CompareVersions("1.0", "1.0.0"))
+	assert.Equal(t, 1, CompareVersions("10.0.0", "9.9.9"))
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// maxWorldVersion is a generous upper bound on the Valheim world format version. The game is currently
+// on version 35, anything far above that is almost certainly not a world file.
+const maxWorldVersion = 1000
+
+// ValidateFileContents Validates the contents of an uploaded file based on its extension. Zip archives must be intact
+// and contain a BepInEx plugin, .fwl and .db files must start with a valid Valheim world header, and .cfg files must
+// be valid INI syntax.
+func ValidateFileContents(ext string, data []byte) error {
+	switch ext {
+	case ".zip":
+		return ValidatePluginArchive(data)
+	case ".fwl":
+		_, err := ReadWorldMetadata(data)
+		return err
+	case ".db":
+		return ValidateWorldDatabase(data)
+	case ".cfg":
+		return ValidateIni(data)
+	default:
+		return fmt.Errorf("unsupported file extension: %s", ext)
+	}
+}
+
+// ValidatePluginArchive Verifies that a zip archive can be fully decompressed (every entry's checksum is checked while reading)
+// and that it looks like a BepInEx plugin i.e. it contains at least one .dll and no entries that escape the extraction directory.
+func ValidatePluginArchive(data []byte) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %v", err)
+	}
+
+	dlls := 0
+	for _, f := range reader.File {
+		name := f.Name
+		if strings.HasPrefix(name, "/") || strings.Contains(name, "..") {
+			return fmt.Errorf("archive entry has an invalid path: %s", name)
+		}
+
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open archive entry %s: %v", name, err)
+		}
+
+		// Reading the entry to EOF forces the zip reader to verify the CRC-32 checksum
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("archive entry %s is corrupt: %v", name, err)
+		}
+
+		if strings.EqualFold(path.Ext(name), ".dll") {
+			dlls++
+		}
+	}
+
+	if dlls == 0 {
+		return errors.New("archive does not contain a BepInEx plugin (no .dll files found)")
+	}
+
+	return nil
+}
+
+// ValidateWorldDatabase Verifies the header of a Valheim world .db file. The file starts with the little endian
+// world version followed by the world data.
+func ValidateWorldDatabase(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("world database is too small")
+	}
+
+	version := int32(binary.LittleEndian.Uint32(data[:4]))
+	if version <= 0 || version > maxWorldVersion {
+		return fmt.Errorf("world database has an invalid version: %d", version)
+	}
+
+	return nil
+}
+
+// ValidateIni Verifies that a .cfg file is valid INI syntax. Every non-empty line must be a comment, a section header,
+// or a key = value pair.
+func ValidateIni(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") || len(line) < 3 {
+				return fmt.Errorf("line %d: malformed section header: %s", lineNumber, line)
+			}
+		default:
+			key, _, found := strings.Cut(line, "=")
+			if !found || strings.TrimSpace(key) == "" {
+				return fmt.Errorf("line %d: expected key = value: %s", lineNumber, line)
+			}
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for name, contents := range files {
+		f, err := w.Create(name)
+		assert.Nil(t, err)
+		_, err = f.Write([]byte(contents))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestValidatePluginArchive(t *testing.T) {
+	valid := makeZip(t, map[string]string{"plugins/Foo.dll": "dll", "README.md": "readme"})
+	assert.Nil(t, ValidatePluginArchive(valid))
+
+	noDll := makeZip(t, map[string]string{"README.md": "readme"})
+	assert.NotNil(t, ValidatePluginArchive(noDll))
+
+	traversal := makeZip(t, map[string]string{"../Foo.dll": "dll"})
+	assert.NotNil(t, ValidatePluginArchive(traversal))
+
+	assert.NotNil(t, ValidatePluginArchive([]byte("not a zip")))
+}
+
+func TestValidateIni(t *testing.T) {
+	valid := "## Settings file was created by plugin\n\n[General]\n\n# Setting type: Boolean\nEnabled = true\n"
+	assert.Nil(t, ValidateIni([]byte(valid)))
+	assert.NotNil(t, ValidateIni([]byte("[General\nEnabled = true")))
+	assert.NotNil(t, ValidateIni([]byte("[General]\njust some text")))
+}
+
+func TestValidateWorldDatabase(t *testing.T) {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint32(data, 34)
+	assert.Nil(t, ValidateWorldDatabase(data))
+	assert.NotNil(t, ValidateWorldDatabase([]byte{1}))
+	assert.NotNil(t, ValidateWorldDatabase([]byte{0, 0, 0, 0}))
+}
+
+func TestReadWorldMetadata(t *testing.T) {
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.LittleEndian, int32(34))
+	body.WriteByte(5)
+	body.WriteString("World")
+	body.WriteByte(4)
+	body.WriteString("seed")
+	binary.Write(body, binary.LittleEndian, int32(1234))
+	binary.Write(body, binary.LittleEndian, int64(99))
+
+	data := new(bytes.Buffer)
+	binary.Write(data, binary.LittleEndian, int32(body.Len()))
+	data.Write(body.Bytes())
+
+	meta, err := ReadWorldMetadata(data.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, "World", meta.Name)
+	assert.Equal(t, "seed", meta.SeedName)
+	assert.Equal(t, int32(1234), meta.Seed)
+
+	_, err = ReadWorldMetadata(data.Bytes()[:10])
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"time"
+)
+
+const (
+	// IdempotencyKeyTTL is how long the response to a request with an idempotency key is replayed for.
+	IdempotencyKeyTTL = 24 * time.Hour
+
+	// IdempotencyLockTimeout is how long a request is considered in progress. Requests still pending after this are assumed to
+	// have been abandoned by a replica which stopped and can be retried.
+	IdempotencyLockTimeout = 5 * time.Minute
+
+	// MaxIdempotencyKeyLength is the longest idempotency key which is accepted.
+	MaxIdempotencyKeyLength = 191
+)
+
+var (
+	// ErrIdempotencyInProgress is returned when a request with the same idempotency key is still being handled.
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is already in progress")
+
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+)
+
+// IdempotencyRecord stores the response to a request sent with an Idempotency-Key header so retries of the request get the
+// original response instead of repeating the action. Keys are scoped to the credentials which sent them.
+type IdempotencyRecord struct {
+	ID          uint      `gorm:"primaryKey"`
+	Scope       string    `gorm:"column:scope;size:64;uniqueIndex:idx_idempotency_scope_key"`
+	Key         string    `gorm:"column:idempotency_key;size:191;uniqueIndex:idx_idempotency_scope_key"`
+	RequestHash string    `gorm:"column:request_hash;size:64"`
+	Method      string    `gorm:"column:method;size:8"`
+	Path        string    `gorm:"column:path"`
+	Completed   bool      `gorm:"column:completed"`
+	Status      int       `gorm:"column:status"`
+	ContentType string    `gorm:"column:content_type"`
+	Response    []byte    `gorm:"column:response;type:mediumblob"`
+	ExpiresAt   time.Time `gorm:"column:expires_at;index"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+	UpdatedAt   time.Time `gorm:"column:updated_at"`
+}
+
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_records"
+}
+
+// HashIdempotentRequest Returns a hash of the parts of a request which must match for a retry to be replayed. The server
+// id header is included since it selects which server a request acts on.
+func HashIdempotentRequest(method, uri, serverId string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(uri))
+	h.Write([]byte{0})
+	h.Write([]byte(serverId))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// BeginIdempotentRequest Claims an idempotency key for a request. A pending record is returned when the caller should handle
+// the request and a completed record when the stored response should be replayed instead. ErrIdempotencyInProgress and
+// ErrIdempotencyKeyReused are returned when the key is held by another request.
+func BeginIdempotentRequest(db *gorm.DB, scope, key, hash, method, path string) (*IdempotencyRecord, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		record := &IdempotencyRecord{
+			Scope:       scope,
+			Key:         key,
+			RequestHash: hash,
+			Method:      method,
+			Path:        path,
+			ExpiresAt:   time.Now().Add(IdempotencyKeyTTL),
+		}
+		tx := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if tx.Error != nil {
+			return nil, fmt.Errorf("failed to claim idempotency key: %v", tx.Error)
+		}
+		if tx.RowsAffected == 1 {
+			return record, nil
+		}
+
+		var existing IdempotencyRecord
+		if err := db.Where("scope = ? AND idempotency_key = ?", scope, key).First(&existing).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get idempotency record: %v", err)
+		}
+
+		stale, err := checkIdempotencyRecord(&existing, hash, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if !stale {
+			return &existing, nil
+		}
+
+		// Only the request which deletes the stale record gets to claim the key again
+		deleted := db.Where("id = ? AND updated_at = ?", existing.ID, existing.UpdatedAt).Delete(&IdempotencyRecord{})
+		if deleted.Error != nil {
+			return nil, fmt.Errorf("failed to delete stale idempotency record: %v", deleted.Error)
+		}
+		if deleted.RowsAffected == 0 {
+			return nil, ErrIdempotencyInProgress
+		}
+	}
+	return nil, ErrIdempotencyInProgress
+}
+
+// checkIdempotencyRecord Decides what to do with a request whose idempotency key is already held by a record. Stale records,
+// which have expired or were abandoned while pending, are reported so the key can be claimed again. Otherwise the completed
+// record is replayed or ErrIdempotencyKeyReused and ErrIdempotencyInProgress are returned when the key is held by another request.
+func checkIdempotencyRecord(existing *IdempotencyRecord, hash string, now time.Time) (bool, error) {
+	abandoned := !existing.Completed && now.Sub(existing.CreatedAt) > IdempotencyLockTimeout
+	if now.After(existing.ExpiresAt) || abandoned {
+		return true, nil
+	}
+
+	if existing.RequestHash != hash {
+		return false, ErrIdempotencyKeyReused
+	}
+	if !existing.Completed {
+		return false, ErrIdempotencyInProgress
+	}
+	return false, nil
+}
+
+// IdempotencyErrorStatus Returns the status to respond with when an idempotency key cannot be claimed. Keys held by a request
+// in progress conflict and keys reused for a different request are unprocessable.
+func IdempotencyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrIdempotencyInProgress):
+		return http.StatusConflict
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// IdempotentStatusReplayed Returns true when a response with a status is stored and replayed for retries. Server errors and
+// rate limited responses are not stored so the request can be retried with the same idempotency key.
+func IdempotentStatusReplayed(status int) bool {
+	return status < http.StatusInternalServerError && status != http.StatusTooManyRequests
+}
+
+// CompleteIdempotentRequest Stores the response to a request so retries with the same idempotency key replay it.
+func CompleteIdempotentRequest(db *gorm.DB, record *IdempotencyRecord, status int, contentType string, response []byte) error {
+	record.Completed = true
+	record.Status = status
+	record.ContentType = contentType
+	record.Response = response
+	return db.Model(record).Updates(map[string]interface{}{
+		"completed":    true,
+		"status":       status,
+		"content_type": contentType,
+		"response":     response,
+	}).Error
+}
+
+// ReleaseIdempotentRequest Deletes the record for a request whose response should not be replayed so it can be retried with
+// the same idempotency key.
+func ReleaseIdempotentRequest(db *gorm.DB, record *IdempotencyRecord) error {
+	return db.Delete(record).Error
+}
+
+// PruneIdempotencyRecords Deletes idempotency records which expired before a time and returns the number deleted.
+func PruneIdempotencyRecords(db *gorm.DB, before time.Time) (int64, error) {
+	tx := db.Where("expires_at < ?", before).Delete(&IdempotencyRecord{})
+	if tx.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency records: %v", tx.Error)
+	}
+	return tx.RowsAffected, nil
+}
+
+// RunIdempotencyPruning Deletes expired idempotency records every interval until the context is cancelled.
+func RunIdempotencyPruning(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := PruneIdempotencyRecords(db, time.Now())
+		if err != nil {
+			log.Errorf("failed to prune idempotency records: %v", err)
+		} else if deleted > 0 {
+			log.Infof("pruned %d expired idempotency records", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHashIdempotentRequest(t *testing.T) {
+	hash := HashIdempotentRequest("POST", "/api/v1/server/create", "", []byte(`{"name":"a"}`))
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, HashIdempotentRequest("POST", "/api/v1/server/create", "", []byte(`{"name":"a"}`)))
+
+	assert.NotEqual(t, hash, HashIdempotentRequest("PUT", "/api/v1/server/create", "", []byte(`{"name":"a"}`)))
+	assert.NotEqual(t, hash, HashIdempotentRequest("POST", "/api/v1/file/install", "", []byte(`{"name":"a"}`)))
+	assert.NotEqual(t, hash, HashIdempotentRequest("POST", "/api/v1/server/create", "", []byte(`{"name":"b"}`)))
+	assert.NotEqual(t, hash, HashIdempotentRequest("POST", "/api/v1/server/create", "7", []byte(`{"name":"a"}`)))
+	assert.NotEqual(t, HashIdempotentRequest("POST", "/api/v1/file/install", "1", nil), HashIdempotentRequest("POST", "/api/v1/file/install", "2", nil))
+
+	// Parts are separated so moving bytes between the uri and body changes the hash
+	assert.NotEqual(t, HashIdempotentRequest("POST", "/a", "", []byte("b")), HashIdempotentRequest("POST", "/ab", "", nil))
+}
+
+func TestCheckIdempotencyRecord(t *testing.T) {
+	now := time.Now()
+	record := func(completed bool, created time.Time) *IdempotencyRecord {
+		return &IdempotencyRecord{
+			RequestHash: "hash",
+			Completed:   completed,
+			CreatedAt:   created,
+			ExpiresAt:   created.Add(IdempotencyKeyTTL),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		existing *IdempotencyRecord
+		hash     string
+		stale    bool
+		err      error
+	}{
+		{"completed request is replayed", record(true, now.Add(-time.Minute)), "hash", false, nil},
+		{"pending request conflicts", record(false, now.Add(-time.Minute)), "hash", false, ErrIdempotencyInProgress},
+		{"different request is rejected", record(true, now.Add(-time.Minute)), "other", false, ErrIdempotencyKeyReused},
+		{"different request while pending is rejected", record(false, now.Add(-time.Minute)), "other", false, ErrIdempotencyKeyReused},
+		{"abandoned request is reclaimed", record(false, now.Add(-IdempotencyLockTimeout-time.Second)), "hash", true, nil},
+		{"abandoned request is reclaimed for a different request", record(false, now.Add(-IdempotencyLockTimeout-time.Second)), "other", true, nil},
+		{"completed request is kept past the lock timeout", record(true, now.Add(-IdempotencyLockTimeout-time.Second)), "hash", false, nil},
+		{"expired request is reclaimed", record(true, now.Add(-IdempotencyKeyTTL-time.Second)), "other", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stale, err := checkIdempotencyRecord(tt.existing, tt.hash, now)
+			assert.Equal(t, tt.stale, stale)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestIdempotencyErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusConflict, IdempotencyErrorStatus(ErrIdempotencyInProgress))
+	assert.Equal(t, http.StatusUnprocessableEntity, IdempotencyErrorStatus(ErrIdempotencyKeyReused))
+	assert.Equal(t, http.StatusInternalServerError, IdempotencyErrorStatus(errors.New("connection refused")))
+}
+
+func TestIdempotentStatusReplayed(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusBadRequest, http.StatusConflict} {
+		assert.True(t, IdempotentStatusReplayed(status), status)
+	}
+
+	// Responses which did not complete the action are released so the request can be retried with the same key
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		assert.False(t, IdempotentStatusReplayed(status), status)
+	}
+}
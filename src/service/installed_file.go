@@ -0,0 +1,166 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	InstallStatusPending   = "PENDING"
+	InstallStatusInstalled = "INSTALLED"
+	InstallStatusFailed    = "FAILED"
+	InstallStatusRemoved   = "REMOVED"
+)
+
+// InstalledFile is a mod or config file which has been installed onto a server's PVC. Records are created when the file job is
+// created and updated from the state of the job when its operation finishes.
+type InstalledFile struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ServerID     uint      `gorm:"column:server_id;uniqueIndex:idx_installed_server_prefix" json:"server_id"`
+	Prefix       string    `gorm:"column:prefix;size:191;uniqueIndex:idx_installed_server_prefix" json:"prefix"`
+	Destination  string    `gorm:"column:destination" json:"destination"`
+	Name         string    `gorm:"column:name;index" json:"name"`
+	Version      string    `gorm:"column:version" json:"version"`
+	Dependencies []string  `gorm:"column:dependencies;serializer:json" json:"dependencies"`
+	DLLs         []string  `gorm:"column:dlls;serializer:json" json:"dlls"`
+	Checksum     string    `gorm:"column:checksum" json:"checksum"`
+	JobName      string    `gorm:"column:job_name;index" json:"job_name"`
+	Status       string    `gorm:"column:status" json:"status"`
+	Error        string    `gorm:"column:error;type:text" json:"error,omitempty"`
+	InstalledAt  time.Time `gorm:"column:installed_at" json:"installed_at"`
+
+	// CatalogModID, LatestVersion, and UpdateAvailable are set by the update checker for plugins found in the mod catalog
+	CatalogModID    *uint  `gorm:"column:catalog_mod_id" json:"catalog_mod_id,omitempty"`
+	LatestVersion   string `gorm:"column:latest_version" json:"latest_version,omitempty"`
+	UpdateAvailable bool   `gorm:"column:update_available" json:"update_available"`
+
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (InstalledFile) TableName() string {
+	return "installed_files"
+}
+
+// ListInstalledFiles Returns every file installed on a server.
+func ListInstalledFiles(db *gorm.DB, serverId uint) ([]InstalledFile, error) {
+	var files []InstalledFile
+	err := db.Where("server_id = ?", serverId).Order("installed_at ASC").Find(&files).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list installed files: %v", err)
+	}
+	return files, nil
+}
+
+// SaveInstalledFile Creates or replaces the record of a file installed on a server at the file's prefix.
+func SaveInstalledFile(db *gorm.DB, file *InstalledFile) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "server_id"}, {Name: "prefix"}},
+		DoUpdates: clause.AssignmentColumns([]string{"destination", "name", "version", "dependencies", "dlls", "checksum", "job_name", "status", "error", "installed_at", "updated_at", "update_available"}),
+	}).Create(file).Error
+}
+
+// UpdateInstalledFileStatus Sets the status of a file installed by a job. Files removed by a job are deleted.
+func UpdateInstalledFileStatus(db *gorm.DB, jobName, prefix, status, errMsg string) error {
+	tx := db.Where("job_name = ? AND prefix = ?", jobName, prefix)
+	if status == InstallStatusRemoved {
+		return tx.Delete(&InstalledFile{}).Error
+	}
+
+	return tx.Model(&InstalledFile{}).Updates(map[string]interface{}{
+		"status": status,
+		"error":  errMsg,
+	}).Error
+}
+
+// ReassignInstalledFiles Moves the files applied by a job to the job which retries it. Files which failed to install are
+// pending again until the retry finishes.
+func ReassignInstalledFiles(db *gorm.DB, jobName, retryJobName string) error {
+	err := db.Model(&InstalledFile{}).Where("job_name = ? AND status = ?", jobName, InstallStatusFailed).Updates(map[string]interface{}{
+		"status": InstallStatusPending,
+		"error":  "",
+	}).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&InstalledFile{}).Where("job_name = ?", jobName).Update("job_name", retryJobName).Error
+}
+
+// DeleteInstalledFile Removes the record of a file installed on a server.
+func DeleteInstalledFile(db *gorm.DB, serverId uint, prefix string) error {
+	return db.Where("server_id = ? AND prefix = ?", serverId, prefix).Delete(&InstalledFile{}).Error
+}
+
+// PackageManifest describes the contents of a mod package. Thunderstore packages declare their name, version, and
+// dependencies in a manifest.json at the root of the archive.
+type PackageManifest struct {
+	Name         string   `json:"name"`
+	Version      string   `json:"version_number"`
+	Dependencies []string `json:"dependencies"`
+	DLLs         []string `json:"-"`
+}
+
+// ReadPackageManifest Reads the manifest and plugin DLLs from a mod archive. Archives without a manifest are named after
+// their file and have no dependencies. A bare .dll is treated as a package containing only itself.
+func ReadPackageManifest(key string, data []byte) (*PackageManifest, error) {
+	base := path.Base(key)
+	ext := strings.ToLower(path.Ext(base))
+	manifest := &PackageManifest{Name: strings.TrimSuffix(base, path.Ext(base))}
+
+	if ext == ".dll" {
+		manifest.DLLs = []string{base}
+		return manifest, nil
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mod archive: %v", err)
+	}
+
+	var manifestFile *zip.File
+	for _, f := range reader.File {
+		name := path.Base(f.Name)
+		if strings.EqualFold(path.Ext(name), ".dll") {
+			manifest.DLLs = append(manifest.DLLs, name)
+		}
+
+		// Prefer the manifest closest to the root of the archive
+		if name == "manifest.json" && (manifestFile == nil || len(f.Name) < len(manifestFile.Name)) {
+			manifestFile = f
+		}
+	}
+
+	if manifestFile == nil {
+		return manifest, nil
+	}
+
+	rc, err := manifestFile.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest.json: %v", err)
+	}
+	defer rc.Close()
+
+	var parsed PackageManifest
+	// Some manifests are saved with a UTF-8 BOM which encoding/json rejects
+	raw := new(bytes.Buffer)
+	if _, err = raw.ReadFrom(rc); err != nil {
+		return nil, fmt.Errorf("failed to read manifest.json: %v", err)
+	}
+	if err = json.Unmarshal(bytes.TrimPrefix(raw.Bytes(), []byte("\ufeff")), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest.json: %v", err)
+	}
+
+	if parsed.Name != "" {
+		manifest.Name = parsed.Name
+	}
+	manifest.Version = parsed.Version
+	manifest.Dependencies = parsed.Dependencies
+	return manifest, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	Namespace = "hearthhub"
+
+	// maxJobLogBytes is the most log output read from a job's pod.
+	maxJobLogBytes = 1 << 20
+)
+
+// JobFinished Returns true when a job has either succeeded or failed.
+func JobFinished(job *batchv1.Job) bool {
+	return job.Status.Succeeded > 0 || job.Status.Failed > 0
+}
+
+// JobLogs Returns the logs from the main container of the most recent pod created for a job.
+func JobLogs(ctx context.Context, clientset kubernetes.Interface, name string) (string, error) {
+	return JobContainerLogs(ctx, clientset, name, "main")
+}
+
+// JobContainerLogs Returns the logs of a single container in the pod created for a job.
+func JobContainerLogs(ctx context.Context, clientset kubernetes.Interface, name, container string) (string, error) {
+	pod, err := jobPod(ctx, clientset, name)
+	if err != nil {
+		return "", err
+	}
+
+	stream, err := clientset.CoreV1().Pods(Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: container}).Stream(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to stream logs for pod %s: %v", pod.Name, err)
+	}
+	defer stream.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err = io.Copy(buf, io.LimitReader(stream, maxJobLogBytes)); err != nil {
+		return "", fmt.Errorf("failed to read logs for pod %s: %v", pod.Name, err)
+	}
+	return buf.String(), nil
+}
+
+func jobPod(ctx context.Context, clientset kubernetes.Interface, name string) (*corev1.Pod, error) {
+	pods, err := clientset.CoreV1().Pods(Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods for job %s: %v", name, err)
+	}
+
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("no pods found for job %s", name)
+	}
+
+	latest := &pods.Items[0]
+	for i := range pods.Items {
+		if pods.Items[i].CreationTimestamp.After(latest.CreationTimestamp.Time) {
+			latest = &pods.Items[i]
+		}
+	}
+
+	log.Debugf("found pod %s for job %s", latest.Name, name)
+	return latest, nil
+}
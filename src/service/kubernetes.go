@@ -11,6 +11,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 	"net/http"
 )
 
@@ -75,20 +76,17 @@ func (p PVCAction) Rollback(clientset kubernetes.Interface) (string, error) {
 	return p.PVC.Name, nil
 }
 
+// KubernetesService wraps the Kubernetes client. It holds no per-request state so a single instance is shared by every request
+// and replica, resources applied together are passed to ApplyResources and RollbackResources instead.
 type KubernetesService interface {
-	AddAction(action ResourceAction)
-	ApplyResources() ([]string, error)
-	GetActions() []ResourceAction
 	GetClient() kubernetes.Interface
 	GetClusterIp() (string, error)
-	Rollback() ([]string, error)
 	DoesPvcExist(name string) bool
 	RemoveFinalizersAndDelete(name string) error
 }
 
 type KubernetesServiceImpl struct {
-	Client          kubernetes.Interface
-	ResourceActions []ResourceAction
+	Client kubernetes.Interface
 }
 
 // MakeKubernetesService Creates a new kubernetes service object which intelligently loads configuration from
@@ -99,8 +97,7 @@ func MakeKubernetesService(config *rest.Config) KubernetesService {
 		log.Fatalf("Error creating kubernetes client: %v", err)
 	}
 	return &KubernetesServiceImpl{
-		Client:          clientset,
-		ResourceActions: []ResourceAction{},
+		Client: clientset,
 	}
 }
 
@@ -177,47 +174,60 @@ func (k *KubernetesServiceImpl) GetClient() kubernetes.Interface {
 	return k.Client
 }
 
-func (k *KubernetesServiceImpl) GetActions() []ResourceAction {
-	return k.ResourceActions
-}
-
-func (k *KubernetesServiceImpl) AddAction(action ResourceAction) {
-	k.ResourceActions = append(k.ResourceActions, action)
-}
-
-// ApplyResources applies a list of resources and rolls them back on failure.
-func (k *KubernetesServiceImpl) ApplyResources() ([]string, error) {
-	count := 0
+// ApplyResources Applies resources in order and returns their names. When a resource fails to apply the resources applied
+// before it are rolled back so the cluster is left as it was.
+func ApplyResources(clientset kubernetes.Interface, actions ...ResourceAction) ([]string, error) {
 	var appliedNames []string
-	for _, resource := range k.ResourceActions {
-		name, err := resource.Apply(k.Client)
-
-		// When 1 resource fails to apply rollback all resources to preserve cluster state
+	for i, action := range actions {
+		name, err := action.Apply(clientset)
 		if err != nil {
 			log.Errorf("error applying resource rolling back: %s err: %v", name, err)
-			deletedResources, _ := k.Rollback()
+			deletedResources, _ := RollbackResources(clientset, actions[:i]...)
 			log.Infof("deleted resource(s): %s", deletedResources)
-			break
-		} else {
-			count++
+			return appliedNames, fmt.Errorf("failed to apply %s: %v", name, err)
 		}
 		appliedNames = append(appliedNames, name)
 	}
 
-	log.Infof("%d/%d resources applied", count, len(k.ResourceActions))
-	k.ResourceActions = nil
+	log.Infof("%d/%d resources applied", len(appliedNames), len(actions))
 	return appliedNames, nil
 }
 
-func (k *KubernetesServiceImpl) Rollback() ([]string, error) {
+// RollbackResources Deletes resources and returns their names. Every resource is attempted and the first error is returned.
+func RollbackResources(clientset kubernetes.Interface, actions ...ResourceAction) ([]string, error) {
 	var deletedNames []string
-	for _, appliedResource := range k.ResourceActions {
-		name, err := appliedResource.Rollback(k.Client)
+	var firstErr error
+	for _, action := range actions {
+		name, err := action.Rollback(clientset)
 		if err != nil {
 			log.Errorf("error deleting resource: %s err: %v", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
 		}
 		deletedNames = append(deletedNames, name)
 	}
-	k.ResourceActions = nil
-	return deletedNames, nil
+	return deletedNames, firstErr
+}
+
+// ScaleDeployment Sets the replicas of a deployment in the hearthhub namespace and returns the replicas it had before.
+func ScaleDeployment(ctx context.Context, clientset kubernetes.Interface, name string, replicas int32) (int32, error) {
+	var previous int32
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		scale, err := clientset.AppsV1().Deployments(Namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		previous = scale.Spec.Replicas
+		scale.Spec.Replicas = replicas
+		_, err = clientset.AppsV1().Deployments(Namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scale deployment %s: %v", name, err)
+	}
+
+	log.Infof("scaled deployment %s from %d to %d replicas", name, previous, replicas)
+	return previous, nil
 }
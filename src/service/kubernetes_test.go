@@ -1,9 +1,11 @@
 package service
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
@@ -96,26 +98,32 @@ func TestGetClient(t *testing.T) {
 	assert.NotNil(t, client)
 }
 
-func TestAddAction(t *testing.T) {
-	cfg := &rest.Config{}
-	svc := MakeKubernetesService(cfg)
-	svc.AddAction(DeploymentAction{
-		Deployment: spec,
-	})
+func TestApplyResources(t *testing.T) {
+	clientset := fake.NewClientset()
+	names, err := ApplyResources(clientset, PVCAction{PVC: pvc}, DeploymentAction{Deployment: spec})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test", "test"}, names)
+
+	_, err = clientset.AppsV1().Deployments("test").Get(context.TODO(), "test", metav1.GetOptions{})
+	assert.Nil(t, err)
+}
+
+func TestApplyResourcesRollback(t *testing.T) {
+	// The deployment already exists so applying it fails and the pvc applied before it is deleted
+	clientset := fake.NewClientset(spec)
+	_, err := ApplyResources(clientset, PVCAction{PVC: pvc}, DeploymentAction{Deployment: spec})
+	assert.NotNil(t, err)
 
-	assert.Len(t, svc.GetActions(), 1)
+	_, err = clientset.CoreV1().PersistentVolumeClaims("test").Get(context.TODO(), "test", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
 }
 
-func TestApplyResources(t *testing.T) {
-	svc := KubernetesServiceImpl{
-		Client: fake.NewClientset(spec),
-		ResourceActions: []ResourceAction{
-			DeploymentAction{
-				Deployment: spec,
-			},
-		},
-	}
-	assert.Len(t, svc.GetActions(), 1)
-	_, err := svc.ApplyResources()
+func TestRollbackResources(t *testing.T) {
+	clientset := fake.NewClientset(spec, pvc)
+	names, err := RollbackResources(clientset, DeploymentAction{Deployment: spec}, PVCAction{PVC: pvc})
 	assert.Nil(t, err)
+	assert.Equal(t, []string{"test", "test"}, names)
+
+	_, err = clientset.AppsV1().Deployments("test").Get(context.TODO(), "test", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
 }
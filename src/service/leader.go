@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// ControllerLeaseName is the Lease replicas compete for to run the background controllers.
+	ControllerLeaseName = "hearthhub-api-controllers"
+
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// Controller is a background loop which must only run on one replica at a time. It runs until its context is cancelled.
+type Controller struct {
+	Name string
+	Run  func(ctx context.Context)
+}
+
+// LeaderElector runs the background controllers on the single replica holding a Kubernetes Lease. The controllers are stopped
+// when the lease is lost and another replica takes over within the lease duration.
+type LeaderElector struct {
+	client      kubernetes.Interface
+	identity    string
+	controllers []Controller
+}
+
+// MakeLeaderElector Creates a leader elector which identifies the replica by POD_NAME or its hostname, which is the pod name
+// in Kubernetes.
+func MakeLeaderElector(client kubernetes.Interface) *LeaderElector {
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	return &LeaderElector{client: client, identity: identity}
+}
+
+// Add Registers a controller to run while this replica is the leader.
+func (l *LeaderElector) Add(name string, run func(ctx context.Context)) {
+	l.controllers = append(l.controllers, Controller{Name: name, Run: run})
+}
+
+// Run Competes for the lease until the context is cancelled, running the controllers whenever this replica holds it. Setting
+// LEADER_ELECTION to "false" runs the controllers without a lease for local development against a single replica.
+func (l *LeaderElector) Run(ctx context.Context) {
+	if os.Getenv("LEADER_ELECTION") == "false" {
+		log.Warnf("leader election is disabled, running %d controllers on this replica", len(l.controllers))
+		l.runControllers(ctx)
+		return
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: ControllerLeaseName, Namespace: Namespace},
+		Client:     l.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: l.identity},
+	}
+
+	// RunOrDie returns once leadership is lost so the replica keeps competing for the lease until it shuts down
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            ControllerLeaseName,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					log.Infof("%s acquired the %s lease, starting controllers", l.identity, ControllerLeaseName)
+					l.runControllers(ctx)
+				},
+				OnStoppedLeading: func() {
+					log.Infof("%s is no longer the leader, controllers stopped", l.identity)
+				},
+				OnNewLeader: func(identity string) {
+					if identity != l.identity {
+						log.Infof("%s is the leader running controllers", identity)
+					}
+				},
+			},
+		})
+	}
+}
+
+// runControllers Runs every controller until the context is cancelled and they have all returned.
+func (l *LeaderElector) runControllers(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, controller := range l.controllers {
+		wg.Add(1)
+		go func(c Controller) {
+			defer wg.Done()
+			log.Infof("starting controller: %s", c.Name)
+			c.Run(ctx)
+			log.Infof("controller stopped: %s", c.Name)
+		}(controller)
+	}
+	wg.Wait()
+}
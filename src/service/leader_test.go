@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func TestLeaderElectorRunsControllers(t *testing.T) {
+	clientset := fake.NewClientset()
+	elector := MakeLeaderElector(clientset)
+	elector.identity = "replica-a"
+
+	started := make(chan struct{})
+	elector.Add("test", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		elector.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("controller was not started after acquiring the lease")
+	}
+
+	lease, err := clientset.CoordinationV1().Leases(Namespace).Get(context.TODO(), ControllerLeaseName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "replica-a", *lease.Spec.HolderIdentity)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("leader elector did not stop after its context was cancelled")
+	}
+}
+
+func TestLeaderElectorDisabled(t *testing.T) {
+	t.Setenv("LEADER_ELECTION", "false")
+	elector := MakeLeaderElector(fake.NewClientset())
+
+	ran := false
+	elector.Add("test", func(ctx context.Context) { ran = true })
+	elector.Run(context.Background())
+	assert.True(t, ran)
+}
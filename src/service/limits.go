@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// LimitsOverride replaces some of the limits a user's subscription grants them. Operators use overrides to give a tenant
+// more (or fewer) resources than their plan without changing the plan in Stripe. Nil fields keep the plan's limit.
+type LimitsOverride struct {
+	ID                  uint      `gorm:"primaryKey" json:"-"`
+	UserID              uint      `gorm:"column:user_id;uniqueIndex" json:"user_id"`
+	CpuLimit            *int      `gorm:"column:cpu_limit" json:"cpuLimit,omitempty"`
+	MemoryLimit         *int      `gorm:"column:memory_limit" json:"memoryLimit,omitempty"`
+	MaxBackups          *int      `gorm:"column:max_backups" json:"maxBackups,omitempty"`
+	MaxWorlds           *int      `gorm:"column:max_worlds" json:"maxWorlds,omitempty"`
+	ExistingWorldUpload *bool     `gorm:"column:existing_world_upload" json:"existingWorldUpload,omitempty"`
+	StorageQuotaBytes   *int64    `gorm:"column:storage_quota_bytes" json:"storageQuotaBytes,omitempty"`
+	Reason              string    `gorm:"column:reason;type:text" json:"reason,omitempty"`
+	UpdatedBy           string    `gorm:"column:updated_by" json:"updated_by"`
+	CreatedAt           time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt           time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (LimitsOverride) TableName() string {
+	return "limits_overrides"
+}
+
+// Validate Checks that none of the overridden limits are negative.
+func (o *LimitsOverride) Validate() error {
+	for name, value := range map[string]*int{"cpuLimit": o.CpuLimit, "memoryLimit": o.MemoryLimit, "maxBackups": o.MaxBackups, "maxWorlds": o.MaxWorlds} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	if o.StorageQuotaBytes != nil && *o.StorageQuotaBytes < 0 {
+		return errors.New("storageQuotaBytes must not be negative")
+	}
+	return nil
+}
+
+// Empty Returns true when the override does not replace any limit.
+func (o *LimitsOverride) Empty() bool {
+	return o.CpuLimit == nil && o.MemoryLimit == nil && o.MaxBackups == nil && o.MaxWorlds == nil &&
+		o.ExistingWorldUpload == nil && o.StorageQuotaBytes == nil
+}
+
+// Apply Replaces the subscription limits which are set on the override.
+func (o *LimitsOverride) Apply(limits *model.SubscriptionLimits) {
+	if o.CpuLimit != nil {
+		limits.CpuLimit = *o.CpuLimit
+	}
+	if o.MemoryLimit != nil {
+		limits.MemoryLimit = *o.MemoryLimit
+	}
+	if o.MaxBackups != nil {
+		limits.MaxBackups = *o.MaxBackups
+	}
+	if o.MaxWorlds != nil {
+		limits.MaxWorlds = *o.MaxWorlds
+	}
+	if o.ExistingWorldUpload != nil {
+		limits.ExistingWorldUpload = *o.ExistingWorldUpload
+	}
+}
+
+// GetLimitsOverride Returns the limits override for a user or nil when the user has none.
+func GetLimitsOverride(db *gorm.DB, userId uint) (*LimitsOverride, error) {
+	var override LimitsOverride
+	tx := db.Where("user_id = ?", userId).First(&override)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to get limits override: %v", tx.Error)
+	}
+	return &override, nil
+}
+
+// SaveLimitsOverride Creates or replaces the limits override for a user. Saving an override which does not replace any
+// limit removes the user's override.
+func SaveLimitsOverride(db *gorm.DB, override *LimitsOverride) error {
+	if override.Empty() {
+		if err := db.Where("user_id = ?", override.UserID).Delete(&LimitsOverride{}).Error; err != nil {
+			return fmt.Errorf("failed to delete limits override: %v", err)
+		}
+		return nil
+	}
+
+	tx := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"cpu_limit", "memory_limit", "max_backups", "max_worlds",
+			"existing_world_upload", "storage_quota_bytes", "reason", "updated_by", "updated_at"}),
+	}).Create(override)
+	if tx.Error != nil {
+		return fmt.Errorf("failed to save limits override: %v", tx.Error)
+	}
+	return nil
+}
+
+// UserLimits Returns the limits of a user's subscription with any operator override applied.
+func UserLimits(db *gorm.DB, stripeService *StripeService, user *model.User) (*model.SubscriptionLimits, error) {
+	limits, err := stripeService.GetSubscriptionLimits(user.SubscriptionId)
+	if err != nil {
+		return nil, err
+	}
+
+	override, err := GetLimitsOverride(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if override != nil {
+		override.Apply(limits)
+	}
+	return limits, nil
+}
+
+// UserStorageQuota Returns the storage quota of a user's subscription or the operator override when one is set.
+func UserStorageQuota(db *gorm.DB, stripeService *StripeService, user *model.User) (int64, error) {
+	override, err := GetLimitsOverride(db, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	if override != nil && override.StorageQuotaBytes != nil {
+		return *override.StorageQuotaBytes, nil
+	}
+	return stripeService.GetStorageQuota(user.SubscriptionId)
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLimitsOverrideApply(t *testing.T) {
+	cpu, backups, upload := 4, 10, true
+	override := &LimitsOverride{CpuLimit: &cpu, MaxBackups: &backups, ExistingWorldUpload: &upload}
+
+	limits := &model.SubscriptionLimits{CpuLimit: 2, MemoryLimit: 8, MaxBackups: 3, MaxWorlds: 1}
+	override.Apply(limits)
+	assert.Equal(t, model.SubscriptionLimits{CpuLimit: 4, MemoryLimit: 8, MaxBackups: 10, MaxWorlds: 1, ExistingWorldUpload: true}, *limits)
+	assert.False(t, override.Empty())
+	assert.True(t, (&LimitsOverride{Reason: "no limits"}).Empty())
+}
+
+func TestLimitsOverrideValidate(t *testing.T) {
+	negative, quota := -1, int64(-5)
+	assert.NoError(t, (&LimitsOverride{}).Validate())
+	assert.EqualError(t, (&LimitsOverride{MaxWorlds: &negative}).Validate(), "maxWorlds must not be negative")
+	assert.Error(t, (&LimitsOverride{StorageQuotaBytes: &quota}).Validate())
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Migrate Runs database migrations for the models owned by this API. Shared models (users, servers, etc...) are
+// migrated by hearthhub-common when the connection is opened.
+func Migrate(db *gorm.DB) error {
+	log.Infof("migrating api database models")
+	return db.AutoMigrate(
+		&StorageUsage{},
+		&CatalogMod{},
+		&CatalogModVersion{},
+		&InstalledFile{},
+		&ReconcileReport{},
+		&Operation{},
+		&Profile{},
+		&ConfigRevision{},
+		&WorldSeed{},
+		&ServerImage{},
+		&Rollout{},
+		&RolloutTarget{},
+		&Admin{},
+		&LimitsOverride{},
+		&AuditEntry{},
+		&Organization{},
+		&OrganizationMember{},
+		&OrganizationServer{},
+		&OrganizationInvite{},
+		&APIKey{},
+		&RateLimitBucket{},
+		&IdempotencyRecord{},
+	)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"io"
@@ -17,15 +18,38 @@ type ModNexusService struct {
 }
 
 type Mod struct {
-	Id        string `json:"mod_id"`
-	Version   string `json:"version"`
-	Updated   string `json:"updated_time"`
-	Created   string `json:"created_time"`
+	Id          int64  `json:"mod_id"`
+	Version     string `json:"version"`
+	Updated     string `json:"updated_time"`
+	Created     string `json:"created_time"`
+	Name        string `json:"name"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	Image       string `json:"picture_url"`
+	Downloads   int64  `json:"mod_downloads"`
+	Author      string `json:"author"`
+	Available   bool   `json:"available"`
+}
+
+// ModFile is a single downloadable file uploaded to a Nexus mod page.
+type ModFile struct {
+	FileId            int64  `json:"file_id"`
+	Name              string `json:"name"`
+	Version           string `json:"version"`
+	CategoryName      string `json:"category_name"`
+	FileName          string `json:"file_name"`
+	SizeKb            int64  `json:"size_kb"`
+	UploadedTimestamp int64  `json:"uploaded_timestamp"`
+}
+
+type modFilesResponse struct {
+	Files []ModFile `json:"files"`
+}
+
+type downloadLink struct {
 	Name      string `json:"name"`
-	Summary   string `json:"summary"`
-	Image     string `json:"picture_url"`
-	Downloads int64  `json:"mod_downloads"`
-	Author    string `json:"author"`
+	ShortName string `json:"short_name"`
+	URI       string `json:"URI"`
 }
 
 func MakeModNexusService() *ModNexusService {
@@ -44,11 +68,25 @@ func MakeModNexusService() *ModNexusService {
 	}
 }
 
+// Enabled Returns true when an API key is configured. Every Nexus API call requires a key.
+func (m *ModNexusService) Enabled() bool {
+	return m.apiKey != ""
+}
+
 func (m *ModNexusService) ModIdForPrefix(prefix string) string {
 	return m.modMapping[prefix]
 
 }
 
+// MappedModIds Returns the ids of the Nexus mods which are already hosted in hearthhub.
+func (m *ModNexusService) MappedModIds() []string {
+	ids := make([]string, 0, len(m.modMapping))
+	for id := range m.modMapping {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 func (m *ModNexusService) GetMod(id string) (*Mod, error) {
 	body, err := m.makeRequest(fmt.Sprintf("/v1/games/valheim/mods/%s.json", id))
 	if err != nil {
@@ -63,13 +101,61 @@ func (m *ModNexusService) GetMod(id string) (*Mod, error) {
 	return mod, nil
 }
 
-func (m *ModNexusService) makeRequest(url string) ([]byte, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// ListMods Returns one of the mod lists Nexus publishes for a game: latest_added, latest_updated, or trending.
+func (m *ModNexusService) ListMods(list string) ([]Mod, error) {
+	body, err := m.makeRequest(fmt.Sprintf("/v1/games/valheim/mods/%s.json", list))
+	if err != nil {
+		return nil, err
+	}
+
+	var mods []Mod
+	if err = json.Unmarshal(body, &mods); err != nil {
+		return nil, err
+	}
+	return mods, nil
+}
+
+// GetModFiles Returns the files uploaded for a mod. Each file is a specific version of the mod.
+func (m *ModNexusService) GetModFiles(id string) ([]ModFile, error) {
+	body, err := m.makeRequest(fmt.Sprintf("/v1/games/valheim/mods/%s/files.json", id))
+	if err != nil {
+		return nil, err
+	}
+
+	var res modFilesResponse
+	if err = json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	return res.Files, nil
+}
+
+// GetDownloadLink Returns a CDN link which can be used to download a mod file. Nexus only generates links directly
+// through the API for premium accounts.
+func (m *ModNexusService) GetDownloadLink(modId string, fileId int64) (string, error) {
+	body, err := m.makeRequest(fmt.Sprintf("/v1/games/valheim/mods/%s/files/%d/download_link.json", modId, fileId))
+	if err != nil {
+		return "", err
+	}
+
+	var links []downloadLink
+	if err = json.Unmarshal(body, &links); err != nil {
+		return "", err
+	}
+
+	if len(links) == 0 {
+		return "", errors.New("no download links available for mod file")
+	}
+	return links[0].URI, nil
+}
+
+func (m *ModNexusService) makeRequest(path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", m.baseUrl+path, nil)
 	if err != nil {
 		log.Errorf("error while creating request to Mod Nexus: %v", err)
 		return nil, err
 	}
 	req.Header.Add("apikey", m.apiKey)
+	req.Header.Add("Accept", "application/json")
 
 	res, err := m.Client.Do(req)
 	if err != nil {
@@ -84,5 +170,10 @@ func (m *ModNexusService) makeRequest(url string) ([]byte, error) {
 		return nil, err
 	}
 
+	if res.StatusCode != http.StatusOK {
+		log.Errorf("unexpected status code from Mod Nexus: %d, path: %s", res.StatusCode, path)
+		return nil, fmt.Errorf("mod nexus returned status: %d", res.StatusCode)
+	}
+
 	return body, nil
 }
@@ -0,0 +1,531 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OperationPending   = "PENDING"
+	OperationRunning   = "RUNNING"
+	OperationSucceeded = "SUCCEEDED"
+	OperationFailed    = "FAILED"
+
+	OperationTypeInstall   = "install"
+	OperationTypeDelete    = "delete"
+	OperationTypeCopy      = "copy"
+	OperationTypeBatch     = "batch"
+	OperationTypeUpgrade   = "upgrade"
+	OperationTypeReconcile = "reconcile"
+
+	// maxOperationLogBytes is the amount of pod log output kept on a failed operation.
+	maxOperationLogBytes = 64 << 10
+)
+
+// Operation is a long-running change to a server, usually backed by a Kubernetes job. The operation controller moves
+// operations from PENDING through RUNNING to either SUCCEEDED or FAILED by observing their jobs.
+type Operation struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	ParentID       *uint      `gorm:"column:parent_id;index" json:"parent_id,omitempty"`
+	UserID         uint       `gorm:"column:user_id;index" json:"user_id"`
+	DiscordID      string     `gorm:"column:discord_id" json:"-"`
+	ActorID        uint       `gorm:"column:actor_id;index" json:"actor_id,omitempty"`
+	ActorDiscordID string     `gorm:"column:actor_discord_id" json:"-"`
+	ServerID       uint       `gorm:"column:server_id;index" json:"server_id"`
+	Type           string     `gorm:"column:type" json:"type"`
+	Target         string     `gorm:"column:target" json:"target"`
+	Step           int        `gorm:"column:step" json:"step"`
+	JobName        string     `gorm:"column:job_name;index" json:"job_name"`
+	Status         string     `gorm:"column:status;index" json:"status"`
+	Message        string     `gorm:"column:message;type:text" json:"message,omitempty"`
+	Logs           string     `gorm:"column:logs;type:mediumtext" json:"logs,omitempty"`
+	StartedAt      *time.Time `gorm:"column:started_at" json:"started_at"`
+	FinishedAt     *time.Time `gorm:"column:finished_at" json:"finished_at"`
+	CreatedAt      time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at" json:"updated_at"`
+
+	// Metadata holds details specific to an operation type such as the replicas to restore after a batch
+	Metadata map[string]string `gorm:"column:metadata;serializer:json" json:"-"`
+
+	// Items are the per file results of a batch operation
+	Items []Operation `gorm:"foreignKey:ParentID" json:"items,omitempty"`
+}
+
+func (Operation) TableName() string {
+	return "operations"
+}
+
+// SetActor Records the user who started an operation when it is not the owner of the server, such as a member of an
+// organization the server is shared with, so they can view the operation and are sent its events.
+func (o *Operation) SetActor(actor *model.User) {
+	if actor == nil || actor.ID == o.UserID {
+		return
+	}
+	o.ActorID = actor.ID
+	o.ActorDiscordID = actor.DiscordID
+}
+
+// Finished Returns true once an operation has either succeeded or failed.
+func (o *Operation) Finished() bool {
+	return o.Status == OperationSucceeded || o.Status == OperationFailed
+}
+
+// OperationHook is called by the operation controller after an operation finishes.
+type OperationHook func(op *Operation)
+
+// OperationService Creates operations and runs the controller which keeps them in sync with their jobs.
+type OperationService struct {
+	db          *gorm.DB
+	kubeService KubernetesService
+	rabbit      *RabbitMqService
+	hooks       []OperationHook
+}
+
+func MakeOperationService(db *gorm.DB, kubeService KubernetesService, rabbit *RabbitMqService) *OperationService {
+	o := &OperationService{
+		db:          db,
+		kubeService: kubeService,
+		rabbit:      rabbit,
+	}
+
+	o.OnFinish(o.finishBatch)
+	o.OnFinish(o.updateInstalledFiles)
+	o.OnFinish(o.completeReconcile)
+	return o
+}
+
+// OnFinish Registers a hook which is called whenever an operation finishes.
+func (o *OperationService) OnFinish(hook OperationHook) {
+	o.hooks = append(o.hooks, hook)
+}
+
+// Create Saves a new operation as PENDING and notifies the user.
+func (o *OperationService) Create(op *Operation) error {
+	op.Status = OperationPending
+	if err := o.db.Omit("Items").Create(op).Error; err != nil {
+		return fmt.Errorf("failed to create operation: %v", err)
+	}
+
+	o.publish(op)
+	return nil
+}
+
+// CreateBatch Saves a batch operation and an item operation for each file in the batch. Items are numbered by their position
+// in the batch job.
+func (o *OperationService) CreateBatch(batch *Operation, items []Operation) error {
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		batch.Status = OperationPending
+		if err := tx.Omit("Items").Create(batch).Error; err != nil {
+			return err
+		}
+
+		for i := range items {
+			items[i].ParentID = &batch.ID
+			items[i].Step = i
+			items[i].Status = OperationPending
+		}
+
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Omit("Items").Create(&items).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create batch operation: %v", err)
+	}
+
+	batch.Items = items
+	o.publish(batch)
+	return nil
+}
+
+// Get Returns an operation by id along with its items.
+func (o *OperationService) Get(id uint) (*Operation, error) {
+	var op Operation
+	err := o.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("step ASC")
+	}).First(&op, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// CanView Returns true when a user owns an operation, started it, or has a role on the server it runs on.
+func (o *OperationService) CanView(op *Operation, userId uint) (bool, error) {
+	if op.UserID == userId || (op.ActorID != 0 && op.ActorID == userId) {
+		return true, nil
+	}
+	if op.ServerID == 0 {
+		return false, nil
+	}
+
+	role, err := ServerRole(o.db, userId, op.ServerID)
+	if err != nil {
+		return false, err
+	}
+	return role != "", nil
+}
+
+// FindActive Returns an unfinished operation of a type on a server or nil when there is none.
+func (o *OperationService) FindActive(serverId uint, opType string) (*Operation, error) {
+	var ops []Operation
+	err := o.db.Where("server_id = ? AND type = ? AND status IN ?", serverId, opType, []string{OperationPending, OperationRunning}).Limit(1).Find(&ops).Error
+	if err != nil || len(ops) == 0 {
+		return nil, err
+	}
+	return &ops[0], nil
+}
+
+// Run Syncs every unfinished operation with its job on each interval until the context is cancelled. Operations are read from
+// the database on each pass so progress is never lost when the API restarts.
+func (o *OperationService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.syncAll(ctx)
+		}
+	}
+}
+
+func (o *OperationService) syncAll(ctx context.Context) {
+	var ops []Operation
+	// Batch items share their parent's job and are finished when the parent finishes. Upgrades have no job and follow the
+	// rollout of the server deployment instead.
+	err := o.db.Where("status IN ? AND (job_name <> '' OR type = ?) AND parent_id IS NULL", []string{OperationPending, OperationRunning}, OperationTypeUpgrade).Find(&ops).Error
+	if err != nil {
+		log.Errorf("failed to list unfinished operations: %v", err)
+		return
+	}
+
+	for i := range ops {
+		if err = o.Sync(ctx, &ops[i]); err != nil {
+			log.Errorf("failed to sync operation %d: %v", ops[i].ID, err)
+		}
+	}
+}
+
+// Sync Moves an operation to the state of its job. Failed jobs have their pod logs and termination message captured. Upgrades
+// are moved to the state of their server's rollout instead.
+func (o *OperationService) Sync(ctx context.Context, op *Operation) error {
+	if op.Type == OperationTypeUpgrade {
+		return o.syncUpgrade(ctx, op)
+	}
+
+	clientset := o.kubeService.GetClient()
+	job, err := clientset.BatchV1().Jobs(Namespace).Get(ctx, op.JobName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return o.Finish(op, OperationFailed, fmt.Sprintf("job %s no longer exists", op.JobName), "")
+		}
+		return err
+	}
+
+	switch {
+	case job.Status.Succeeded > 0:
+		return o.Finish(op, OperationSucceeded, "", "")
+	case job.Status.Failed > 0:
+		message, logs := o.failureDetails(ctx, job)
+		return o.Finish(op, OperationFailed, message, logs)
+	case job.Status.Active > 0 && op.Status == OperationPending:
+		now := time.Now()
+		op.Status = OperationRunning
+		op.StartedAt = &now
+		if err = o.db.Omit("Items").Save(op).Error; err != nil {
+			return err
+		}
+		o.publish(op)
+	}
+
+	return nil
+}
+
+// Finish Moves an operation to a finished status, runs the finish hooks, and notifies the user.
+func (o *OperationService) Finish(op *Operation, status, message, logs string) error {
+	now := time.Now()
+	if op.StartedAt == nil {
+		op.StartedAt = &now
+	}
+	op.Status = status
+	op.Message = message
+	op.Logs = logs
+	op.FinishedAt = &now
+
+	if err := o.db.Omit("Items").Save(op).Error; err != nil {
+		return err
+	}
+
+	for _, hook := range o.hooks {
+		hook(op)
+	}
+
+	o.publish(op)
+	return nil
+}
+
+// Retry Re-runs the job of a failed operation and tracks it as a new operation. The new job is copied from the failed job so
+// it applies the same files. Batch operations stop the server again while the retried job runs.
+func (o *OperationService) Retry(ctx context.Context, op *Operation) (*Operation, error) {
+	switch {
+	case op.Status != OperationFailed:
+		return nil, fmt.Errorf("only failed operations can be retried, operation is %s", op.Status)
+	case op.ParentID != nil:
+		return nil, fmt.Errorf("operation is part of batch operation %d which must be retried instead", *op.ParentID)
+	case op.Type == OperationTypeUpgrade:
+		return nil, fmt.Errorf("upgrade operations cannot be retried, upgrade the server again instead")
+	case op.Type == OperationTypeReconcile:
+		return nil, fmt.Errorf("reconcile operations cannot be retried, reconcile the server again instead")
+	}
+
+	clientset := o.kubeService.GetClient()
+	failed, err := clientset.BatchV1().Jobs(Namespace).Get(ctx, op.JobName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("job %s no longer exists and cannot be retried", op.JobName)
+		}
+		return nil, fmt.Errorf("failed to get job %s: %v", op.JobName, err)
+	}
+
+	deployment := op.Metadata["deployment"]
+	if op.Type == OperationTypeBatch && deployment != "" {
+		if _, err = ScaleDeployment(ctx, clientset, deployment, 0); err != nil {
+			return nil, fmt.Errorf("could not stop server for batch: %v", err)
+		}
+	}
+
+	job, err := clientset.BatchV1().Jobs(Namespace).Create(ctx, retryJob(failed), metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %v", err)
+	}
+
+	metadata := map[string]string{}
+	for k, v := range op.Metadata {
+		metadata[k] = v
+	}
+	metadata["retry_of"] = strconv.Itoa(int(op.ID))
+
+	retried := &Operation{
+		UserID:         op.UserID,
+		DiscordID:      op.DiscordID,
+		ActorID:        op.ActorID,
+		ActorDiscordID: op.ActorDiscordID,
+		ServerID:       op.ServerID,
+		Type:           op.Type,
+		Target:         op.Target,
+		JobName:        job.Name,
+		Metadata:       metadata,
+	}
+
+	if op.Type == OperationTypeBatch {
+		var items []Operation
+		if err = o.db.Where("parent_id = ?", op.ID).Order("step ASC").Find(&items).Error; err != nil {
+			return nil, fmt.Errorf("failed to list items for batch operation %d: %v", op.ID, err)
+		}
+
+		retriedItems := make([]Operation, 0, len(items))
+		for _, item := range items {
+			retriedItems = append(retriedItems, Operation{
+				UserID:         item.UserID,
+				DiscordID:      item.DiscordID,
+				ActorID:        item.ActorID,
+				ActorDiscordID: item.ActorDiscordID,
+				ServerID:       item.ServerID,
+				Type:           item.Type,
+				Target:         item.Target,
+				JobName:        job.Name,
+			})
+		}
+		err = o.CreateBatch(retried, retriedItems)
+	} else {
+		err = o.Create(retried)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("job %s created but the operation could not be recorded: %v", job.Name, err)
+	}
+
+	if err = ReassignInstalledFiles(o.db, op.JobName, job.Name); err != nil {
+		log.Errorf("failed to move installed files from job %s to %s: %v", op.JobName, job.Name, err)
+	}
+	return retried, nil
+}
+
+// retryJob Returns a copy of a failed job which can be created to run it again. The selector and labels Kubernetes generated
+// for the failed job are removed because they would match the failed job's pods.
+func retryJob(failed *batchv1.Job) *batchv1.Job {
+	generateName := failed.GenerateName
+	if generateName == "" {
+		generateName = failed.Name + "-"
+	}
+
+	labels := map[string]string{}
+	for k, v := range failed.Labels {
+		labels[k] = v
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: generateName,
+			Namespace:    failed.Namespace,
+			Labels:       labels,
+		},
+		Spec: *failed.Spec.DeepCopy(),
+	}
+
+	job.Spec.Selector = nil
+	job.Spec.ManualSelector = nil
+	for _, key := range []string{"controller-uid", "batch.kubernetes.io/controller-uid", "job-name", "batch.kubernetes.io/job-name"} {
+		delete(job.Spec.Template.Labels, key)
+		delete(job.Labels, key)
+	}
+	return job
+}
+
+// failureDetails Returns the termination message and logs of a failed job's pod. Init containers are checked first since a
+// failed init container stops the pod before its main container runs.
+func (o *OperationService) failureDetails(ctx context.Context, job *batchv1.Job) (string, string) {
+	message := fmt.Sprintf("job %s failed", job.Name)
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Message != "" {
+			message = cond.Message
+		}
+	}
+
+	// Logs are read from the container which failed, batch jobs have no container named main
+	container := "main"
+	if specs := job.Spec.Template.Spec.Containers; len(specs) > 0 {
+		container = specs[len(specs)-1].Name
+	}
+
+	clientset := o.kubeService.GetClient()
+	if pod, err := jobPod(ctx, clientset, job.Name); err == nil {
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			if t := status.State.Terminated; t != nil && t.ExitCode != 0 {
+				message = strings.TrimSpace(fmt.Sprintf("container %s exited with code %d (%s): %s", status.Name, t.ExitCode, t.Reason, t.Message))
+				container = status.Name
+				break
+			}
+		}
+	}
+
+	logs, err := JobContainerLogs(ctx, clientset, job.Name, container)
+	if err != nil {
+		log.Errorf("failed to get logs for failed job %s: %v", job.Name, err)
+	}
+
+	if len(logs) > maxOperationLogBytes {
+		logs = logs[len(logs)-maxOperationLogBytes:]
+	}
+
+	return message, logs
+}
+
+// updateInstalledFiles Records the outcome of a file operation on the installed files created for its job.
+func (o *OperationService) updateInstalledFiles(op *Operation) {
+	var status, errMsg string
+	switch {
+	case op.Type == OperationTypeDelete && op.Status == OperationSucceeded:
+		status = InstallStatusRemoved
+	case op.Type == OperationTypeDelete:
+		// The file is still on the PVC when a removal fails
+		status = InstallStatusInstalled
+		errMsg = op.Message
+	case op.Type == OperationTypeInstall || op.Type == OperationTypeCopy:
+		status = InstallStatusInstalled
+		if op.Status == OperationFailed {
+			status = InstallStatusFailed
+			errMsg = op.Message
+		}
+	default:
+		return
+	}
+
+	if err := UpdateInstalledFileStatus(o.db, op.JobName, op.Target, status, errMsg); err != nil {
+		log.Errorf("failed to update installed files for operation %d: %v", op.ID, err)
+	}
+}
+
+// finishBatch Finishes each item of a batch from the exit status of its container in the batch job and then restores the
+// server to the number of replicas it had before the batch started.
+func (o *OperationService) finishBatch(op *Operation) {
+	if op.Type != OperationTypeBatch {
+		return
+	}
+
+	ctx := context.Background()
+	clientset := o.kubeService.GetClient()
+
+	var items []Operation
+	if err := o.db.Where("parent_id = ?", op.ID).Order("step ASC").Find(&items).Error; err != nil {
+		log.Errorf("failed to list items for batch operation %d: %v", op.ID, err)
+	}
+
+	statuses := map[string]corev1.ContainerStatus{}
+	if pod, err := jobPod(ctx, clientset, op.JobName); err == nil {
+		for _, s := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			statuses[s.Name] = s
+		}
+	} else {
+		log.Errorf("failed to get pod for batch operation %d: %v", op.ID, err)
+	}
+
+	for i := range items {
+		status, message := OperationFailed, "not run because an earlier item in the batch failed"
+		if s, ok := statuses[BatchContainerName(items[i].Step)]; ok && s.State.Terminated != nil {
+			t := s.State.Terminated
+			if t.ExitCode == 0 {
+				status, message = OperationSucceeded, ""
+			} else {
+				message = strings.TrimSpace(fmt.Sprintf("exited with code %d (%s): %s", t.ExitCode, t.Reason, t.Message))
+			}
+		} else if op.Status == OperationSucceeded {
+			status, message = OperationSucceeded, ""
+		}
+
+		if err := o.Finish(&items[i], status, message, ""); err != nil {
+			log.Errorf("failed to finish batch item %d: %v", items[i].ID, err)
+		}
+	}
+
+	deployment := op.Metadata["deployment"]
+	if replicas, err := strconv.Atoi(op.Metadata["restore_replicas"]); err == nil && replicas > 0 && deployment != "" {
+		if _, err = ScaleDeployment(ctx, clientset, deployment, int32(replicas)); err != nil {
+			log.Errorf("failed to restore deployment %s after batch operation %d: %v", deployment, op.ID, err)
+		}
+	}
+}
+
+// BatchContainerName Returns the name of the container which runs an item of a batch job.
+func BatchContainerName(step int) string {
+	return fmt.Sprintf("item-%d", step)
+}
+
+// publish Sends an OperationUpdated event to the owner of an operation and to the member who started it.
+func (o *OperationService) publish(op *Operation) {
+	if o.rabbit == nil {
+		return
+	}
+
+	for _, discordId := range []string{op.DiscordID, op.ActorDiscordID} {
+		if discordId == "" {
+			continue
+		}
+		if err := o.rabbit.PublishUserEvent(discordId, "OperationUpdated", op); err != nil {
+			log.Errorf("failed to publish operation %d event: %v", op.ID, err)
+		}
+	}
+}
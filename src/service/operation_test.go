@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func TestOperationFailureDetails(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mod-install-123-abc", Namespace: Namespace},
+		Status:     batchv1.JobStatus{Failed: 1},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mod-install-123-abc-xyz",
+			Namespace: Namespace,
+			Labels:    map[string]string{"job-name": job.Name},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "main",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 1,
+					Reason:   "Error",
+					Message:  "failed to download prefix from s3",
+				}},
+			}},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(job, pod)
+	o := MakeOperationService(nil, &KubernetesServiceImpl{Client: clientset}, nil)
+
+	message, logs := o.failureDetails(context.Background(), job)
+	assert.Equal(t, "container main exited with code 1 (Error): failed to download prefix from s3", message)
+	assert.Equal(t, "fake logs", logs)
+}
+
+func TestOperationFailureDetailsInitContainer(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mod-batch-123-abc", Namespace: Namespace},
+		Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: BatchContainerName(0)}, {Name: BatchContainerName(1)}},
+			Containers:     []corev1.Container{{Name: BatchContainerName(2)}},
+		}}},
+		Status: batchv1.JobStatus{Failed: 1},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mod-batch-123-abc-xyz",
+			Namespace: Namespace,
+			Labels:    map[string]string{"job-name": job.Name},
+		},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: BatchContainerName(0), State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}},
+				{Name: BatchContainerName(1), State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 2,
+					Reason:   "Error",
+					Message:  "archive is corrupt",
+				}}},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: BatchContainerName(2), State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}},
+			},
+		},
+	}
+
+	o := MakeOperationService(nil, &KubernetesServiceImpl{Client: fake.NewSimpleClientset(job, pod)}, nil)
+
+	message, logs := o.failureDetails(context.Background(), job)
+	assert.Equal(t, "container item-1 exited with code 2 (Error): archive is corrupt", message)
+	assert.Equal(t, "fake logs", logs)
+}
+
+func TestRetryJob(t *testing.T) {
+	failed := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:         "mod-install-123-abc",
+			GenerateName: "mod-install-123-",
+			Namespace:    Namespace,
+			Labels:       map[string]string{"tenant-discord-id": "123", "job-name": "mod-install-123-abc"},
+		},
+		Spec: batchv1.JobSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"batch.kubernetes.io/controller-uid": "uid"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+					"batch.kubernetes.io/controller-uid": "uid",
+					"batch.kubernetes.io/job-name":       "mod-install-123-abc",
+				}},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "plugin-manager:1"}}},
+			},
+		},
+	}
+
+	job := retryJob(failed)
+	assert.Equal(t, "", job.Name)
+	assert.Equal(t, "mod-install-123-", job.GenerateName)
+	assert.Equal(t, map[string]string{"tenant-discord-id": "123"}, job.Labels)
+	assert.Nil(t, job.Spec.Selector)
+	assert.Empty(t, job.Spec.Template.Labels)
+	assert.Equal(t, "plugin-manager:1", job.Spec.Template.Spec.Containers[0].Image)
+
+	// The failed job is left untouched
+	assert.NotNil(t, failed.Spec.Selector)
+	assert.Len(t, failed.Labels, 2)
+}
+
+func TestOperationActor(t *testing.T) {
+	owner := &model.User{ID: 1, DiscordID: "owner"}
+	member := &model.User{ID: 2, DiscordID: "member"}
+
+	op := &Operation{UserID: owner.ID, DiscordID: owner.DiscordID}
+	op.SetActor(owner)
+	op.SetActor(nil)
+	assert.Zero(t, op.ActorID)
+	assert.Empty(t, op.ActorDiscordID)
+
+	op.SetActor(member)
+	assert.Equal(t, member.ID, op.ActorID)
+	assert.Equal(t, "member", op.ActorDiscordID)
+
+	// The owner and the member who started the operation can view it without looking up a role
+	o := MakeOperationService(nil, &KubernetesServiceImpl{Client: fake.NewSimpleClientset()}, nil)
+	for _, id := range []uint{owner.ID, member.ID} {
+		allowed, err := o.CanView(op, id)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	}
+
+	// Operations which are not on a server are only visible to their owner
+	allowed, err := o.CanView(&Operation{UserID: owner.ID}, member.ID)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+}
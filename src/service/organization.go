@@ -0,0 +1,445 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const (
+	RoleOwner    = "owner"
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+
+	// PermissionView allows reading a server's details, mods, configs, and revisions
+	PermissionView = "server:view"
+	// PermissionControl allows starting, stopping, and upgrading a server
+	PermissionControl = "server:control"
+	// PermissionMods allows installing, upgrading, and removing mods and files
+	PermissionMods = "server:mods"
+	// PermissionConfig allows editing a server's world settings, config files, and password
+	PermissionConfig = "server:config"
+	// PermissionDelete allows deleting a server
+	PermissionDelete = "server:delete"
+	// PermissionBilling allows viewing and managing the subscription which pays for a server. No organization role grants it
+	// so billing stays with the server's owner.
+	PermissionBilling = "billing"
+
+	// InviteTTL is how long an organization invite can be accepted for.
+	InviteTTL = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrLastOwner is returned when a change would leave an organization without an owner.
+	ErrLastOwner = errors.New("an organization must keep at least one owner")
+
+	// ErrInviteInvalid is returned when an invite does not exist, has expired, or is for another user.
+	ErrInviteInvalid = errors.New("invite is invalid or has expired")
+
+	// Roles are the roles a member can have in an organization, most privileged first.
+	Roles = []string{RoleOwner, RoleAdmin, RoleOperator, RoleViewer}
+
+	rolePermissions = map[string][]string{
+		RoleOwner:    {PermissionView, PermissionControl, PermissionMods, PermissionConfig, PermissionDelete},
+		RoleAdmin:    {PermissionView, PermissionControl, PermissionMods, PermissionConfig},
+		RoleOperator: {PermissionView, PermissionControl, PermissionMods},
+		RoleViewer:   {PermissionView},
+	}
+)
+
+// Organization is a group of users who share access to the servers its members add to it. Each member has a role which
+// decides what they can do with the shared servers.
+type Organization struct {
+	ID        uint                 `gorm:"primaryKey" json:"id"`
+	Name      string               `gorm:"column:name" json:"name"`
+	CreatedBy uint                 `gorm:"column:created_by" json:"created_by"`
+	CreatedAt time.Time            `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time            `gorm:"column:updated_at" json:"updated_at"`
+	Members   []OrganizationMember `gorm:"foreignKey:OrganizationID;constraint:OnDelete:CASCADE" json:"members,omitempty"`
+	Servers   []OrganizationServer `gorm:"foreignKey:OrganizationID;constraint:OnDelete:CASCADE" json:"servers,omitempty"`
+	Invites   []OrganizationInvite `gorm:"foreignKey:OrganizationID;constraint:OnDelete:CASCADE" json:"invites,omitempty"`
+}
+
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// OrganizationMember is a user's membership and role in an organization.
+type OrganizationMember struct {
+	ID             uint      `gorm:"primaryKey" json:"-"`
+	OrganizationID uint      `gorm:"column:organization_id;uniqueIndex:idx_org_member" json:"organization_id"`
+	UserID         uint      `gorm:"column:user_id;uniqueIndex:idx_org_member;index" json:"user_id"`
+	DiscordID      string    `gorm:"column:discord_id" json:"discord_id"`
+	Role           string    `gorm:"column:role;size:16" json:"role"`
+	CreatedAt      time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (OrganizationMember) TableName() string {
+	return "organization_members"
+}
+
+// OrganizationServer shares a server with the members of an organization.
+type OrganizationServer struct {
+	ID             uint      `gorm:"primaryKey" json:"-"`
+	OrganizationID uint      `gorm:"column:organization_id;uniqueIndex:idx_org_server" json:"organization_id"`
+	ServerID       uint      `gorm:"column:server_id;uniqueIndex:idx_org_server;index" json:"server_id"`
+	SharedBy       uint      `gorm:"column:shared_by" json:"shared_by"`
+	CreatedAt      time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (OrganizationServer) TableName() string {
+	return "organization_servers"
+}
+
+// OrganizationInvite lets a user join an organization with a role. Invites for a discord id can only be accepted by that user
+// and only once, invite links without a discord id can be shared and accepted by anyone until they expire. Only a hash of the
+// invite token is stored.
+type OrganizationInvite struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrganizationID uint       `gorm:"column:organization_id;index" json:"organization_id"`
+	TokenHash      string     `gorm:"column:token_hash;size:64;uniqueIndex" json:"-"`
+	DiscordID      string     `gorm:"column:discord_id" json:"discord_id,omitempty"`
+	Role           string     `gorm:"column:role;size:16" json:"role"`
+	CreatedBy      uint       `gorm:"column:created_by" json:"created_by"`
+	ExpiresAt      time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	AcceptedAt     *time.Time `gorm:"column:accepted_at" json:"accepted_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (OrganizationInvite) TableName() string {
+	return "organization_invites"
+}
+
+// ValidateRole Checks that a role is one of the organization roles.
+func ValidateRole(role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("invalid role: \"%s\" valid roles are: \"%v\"", role, Roles)
+	}
+	return nil
+}
+
+// RoleAllows Returns true when a role grants a permission.
+func RoleAllows(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleRank Returns the position of a role in Roles where lower is more privileged. Unknown roles rank last.
+func RoleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return len(Roles)
+}
+
+// CreateOrganization Creates an organization with its creator as the owner.
+func CreateOrganization(db *gorm.DB, name string, owner *model.User) (*Organization, error) {
+	org := &Organization{Name: name, CreatedBy: owner.ID}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(org).Error; err != nil {
+			return err
+		}
+
+		member := OrganizationMember{OrganizationID: org.ID, UserID: owner.ID, DiscordID: owner.DiscordID, Role: RoleOwner}
+		if err := tx.Create(&member).Error; err != nil {
+			return err
+		}
+		org.Members = []OrganizationMember{member}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %v", err)
+	}
+	return org, nil
+}
+
+// OrganizationMembership is an organization along with the role a user has in it.
+type OrganizationMembership struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// ListOrganizations Returns the organizations a user is a member of along with their role in each.
+func ListOrganizations(db *gorm.DB, userId uint) ([]OrganizationMembership, error) {
+	var members []OrganizationMember
+	if err := db.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organization memberships: %v", err)
+	}
+
+	memberships := make([]OrganizationMembership, 0, len(members))
+	for _, member := range members {
+		var org Organization
+		if err := db.Preload("Servers").First(&org, member.OrganizationID).Error; err != nil {
+			return nil, fmt.Errorf("failed to get organization %d: %v", member.OrganizationID, err)
+		}
+		memberships = append(memberships, OrganizationMembership{Organization: org, Role: member.Role})
+	}
+	return memberships, nil
+}
+
+// GetOrganization Returns an organization with its members, shared servers, and pending invites.
+func GetOrganization(db *gorm.DB, orgId uint) (*Organization, error) {
+	var org Organization
+	err := db.Preload("Members").Preload("Servers").Preload("Invites", "accepted_at IS NULL AND expires_at > ?", time.Now()).First(&org, orgId).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// DeleteOrganization Deletes an organization along with its memberships, invites, and server shares. The servers themselves
+// stay with their owners.
+func DeleteOrganization(db *gorm.DB, orgId uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, m := range []interface{}{&OrganizationMember{}, &OrganizationServer{}, &OrganizationInvite{}} {
+			if err := tx.Where("organization_id = ?", orgId).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&Organization{}, orgId).Error
+	})
+}
+
+// GetMember Returns a user's membership in an organization. gorm.ErrRecordNotFound is returned when they are not a member.
+func GetMember(db *gorm.DB, orgId, userId uint) (*OrganizationMember, error) {
+	var member OrganizationMember
+	if err := db.Where("organization_id = ? AND user_id = ?", orgId, userId).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// UpdateMemberRole Changes the role of a member. The last owner of an organization cannot be demoted.
+func UpdateMemberRole(db *gorm.DB, member *OrganizationMember, role string) error {
+	if member.Role == RoleOwner && role != RoleOwner {
+		if err := ensureAnotherOwner(db, member); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Model(member).Update("role", role).Error; err != nil {
+		return fmt.Errorf("failed to update member role: %v", err)
+	}
+	member.Role = role
+	return nil
+}
+
+// RemoveMember Removes a user from an organization. The last owner of an organization cannot be removed.
+func RemoveMember(db *gorm.DB, member *OrganizationMember) error {
+	if member.Role == RoleOwner {
+		if err := ensureAnotherOwner(db, member); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Delete(member).Error; err != nil {
+		return fmt.Errorf("failed to remove member: %v", err)
+	}
+	return nil
+}
+
+func ensureAnotherOwner(db *gorm.DB, member *OrganizationMember) error {
+	var owners int64
+	err := db.Model(&OrganizationMember{}).Where("organization_id = ? AND role = ? AND id <> ?", member.OrganizationID, RoleOwner, member.ID).Count(&owners).Error
+	if err != nil {
+		return fmt.Errorf("failed to count organization owners: %v", err)
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// CreateInvite Creates an invite to an organization and returns it along with the token which accepts it. The token is only
+// available when the invite is created. An empty discord id creates an invite link anyone can accept.
+func CreateInvite(db *gorm.DB, orgId uint, role, discordId string, createdBy uint) (*OrganizationInvite, string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate invite token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	invite := &OrganizationInvite{
+		OrganizationID: orgId,
+		TokenHash:      hashInviteToken(token),
+		DiscordID:      discordId,
+		Role:           role,
+		CreatedBy:      createdBy,
+		ExpiresAt:      time.Now().Add(InviteTTL),
+	}
+	if err := db.Create(invite).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create invite: %v", err)
+	}
+	return invite, token, nil
+}
+
+// RevokeInvite Deletes a pending invite to an organization.
+func RevokeInvite(db *gorm.DB, orgId, inviteId uint) error {
+	tx := db.Where("id = ? AND organization_id = ?", inviteId, orgId).Delete(&OrganizationInvite{})
+	if tx.Error != nil {
+		return fmt.Errorf("failed to revoke invite: %v", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AcceptInvite Adds a user to the organization of an invite with the invite's role. Users who are already members keep their
+// current role.
+func AcceptInvite(db *gorm.DB, token string, user *model.User) (*OrganizationMember, error) {
+	var member *OrganizationMember
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var invite OrganizationInvite
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", hashInviteToken(token)).First(&invite).Error
+		if err != nil {
+			return ErrInviteInvalid
+		}
+
+		if time.Now().After(invite.ExpiresAt) || invite.AcceptedAt != nil || (invite.DiscordID != "" && invite.DiscordID != user.DiscordID) {
+			return ErrInviteInvalid
+		}
+
+		existing, err := GetMember(tx, invite.OrganizationID, user.ID)
+		if err == nil {
+			member = existing
+			return nil
+		}
+
+		member = &OrganizationMember{OrganizationID: invite.OrganizationID, UserID: user.ID, DiscordID: user.DiscordID, Role: invite.Role}
+		if err = tx.Create(member).Error; err != nil {
+			return err
+		}
+
+		// Invites for a user are used up once accepted while invite links stay valid until they expire
+		if invite.DiscordID != "" {
+			now := time.Now()
+			return tx.Model(&invite).Update("accepted_at", &now).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ShareServer Shares a server with the members of an organization. Sharing an already shared server has no effect.
+func ShareServer(db *gorm.DB, orgId, serverId, sharedBy uint) (*OrganizationServer, error) {
+	share := &OrganizationServer{OrganizationID: orgId, ServerID: serverId, SharedBy: sharedBy}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(share).Error; err != nil {
+		return nil, fmt.Errorf("failed to share server: %v", err)
+	}
+	return share, nil
+}
+
+// UnshareServer Stops sharing a server with the members of an organization.
+func UnshareServer(db *gorm.DB, orgId, serverId uint) error {
+	tx := db.Where("organization_id = ? AND server_id = ?", orgId, serverId).Delete(&OrganizationServer{})
+	if tx.Error != nil {
+		return fmt.Errorf("failed to unshare server: %v", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ServerRole Returns the role a user has on a server through the organizations the server is shared with, or an empty string
+// when the server is not shared with the user. The most privileged role wins when the server is shared with several of the
+// user's organizations.
+func ServerRole(db *gorm.DB, userId, serverId uint) (string, error) {
+	var roles []string
+	err := db.Model(&OrganizationMember{}).
+		Joins("JOIN organization_servers ON organization_servers.organization_id = organization_members.organization_id").
+		Where("organization_members.user_id = ? AND organization_servers.server_id = ?", userId, serverId).
+		Pluck("organization_members.role", &roles).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to get server role: %v", err)
+	}
+
+	role := ""
+	for _, r := range roles {
+		if role == "" || RoleRank(r) < RoleRank(role) {
+			role = r
+		}
+	}
+	return role, nil
+}
+
+// SharedServer is a server shared with a user through an organization along with the role they have on it.
+type SharedServer struct {
+	Server         model.Server `json:"server"`
+	OrganizationID uint         `json:"organization_id"`
+	Role           string       `json:"role"`
+}
+
+// ListSharedServers Returns the servers shared with a user through their organizations. Servers the user owns are not included.
+func ListSharedServers(db *gorm.DB, userId uint) ([]SharedServer, error) {
+	var rows []struct {
+		ServerID       uint
+		OrganizationID uint
+		Role           string
+	}
+	err := db.Model(&OrganizationMember{}).
+		Select("organization_servers.server_id, organization_members.organization_id, organization_members.role").
+		Joins("JOIN organization_servers ON organization_servers.organization_id = organization_members.organization_id").
+		Where("organization_members.user_id = ?", userId).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shared servers: %v", err)
+	}
+
+	shared := []SharedServer{}
+	seen := map[uint]int{}
+	for _, row := range rows {
+		if i, ok := seen[row.ServerID]; ok {
+			if RoleRank(row.Role) < RoleRank(shared[i].Role) {
+				shared[i].Role = row.Role
+				shared[i].OrganizationID = row.OrganizationID
+			}
+			continue
+		}
+
+		var server model.Server
+		if err = db.Preload("WorldDetails").Preload("WorldDetails.Modifiers").First(&server, row.ServerID).Error; err != nil {
+			return nil, fmt.Errorf("failed to get shared server %d: %v", row.ServerID, err)
+		}
+		if server.UserID == userId {
+			continue
+		}
+		seen[row.ServerID] = len(shared)
+		shared = append(shared, SharedServer{Server: RedactServer(server), OrganizationID: row.OrganizationID, Role: row.Role})
+	}
+	return shared, nil
+}
+
+// Actor Returns the user who made a request. This is the authenticated user, which differs from the "user" in the context when
+// they are acting on a server shared with them, in which case "user" is the server's owner.
+func Actor(c auditContext) *model.User {
+	if tmp, ok := c.Get("actor"); ok {
+		return tmp.(*model.User)
+	}
+	if tmp, ok := c.Get("user"); ok {
+		return tmp.(*model.User)
+	}
+	return nil
+}
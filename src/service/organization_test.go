@@ -0,0 +1,51 @@
+package service
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRoleAllows(t *testing.T) {
+	assert.False(t, RoleAllows(RoleOwner, PermissionBilling))
+	assert.True(t, RoleAllows(RoleOwner, PermissionDelete))
+	assert.True(t, RoleAllows(RoleAdmin, PermissionConfig))
+	assert.False(t, RoleAllows(RoleAdmin, PermissionBilling))
+	assert.False(t, RoleAllows(RoleAdmin, PermissionDelete))
+	assert.True(t, RoleAllows(RoleOperator, PermissionControl))
+	assert.True(t, RoleAllows(RoleOperator, PermissionMods))
+	assert.False(t, RoleAllows(RoleOperator, PermissionConfig))
+	assert.True(t, RoleAllows(RoleViewer, PermissionView))
+	assert.False(t, RoleAllows(RoleViewer, PermissionControl))
+	assert.False(t, RoleAllows("unknown", PermissionView))
+}
+
+func TestRoleRank(t *testing.T) {
+	assert.Less(t, RoleRank(RoleOwner), RoleRank(RoleAdmin))
+	assert.Less(t, RoleRank(RoleAdmin), RoleRank(RoleOperator))
+	assert.Less(t, RoleRank(RoleOperator), RoleRank(RoleViewer))
+	assert.Less(t, RoleRank(RoleViewer), RoleRank("unknown"))
+
+	assert.NoError(t, ValidateRole(RoleOperator))
+	assert.Error(t, ValidateRole("superuser"))
+}
+
+func TestHashInviteToken(t *testing.T) {
+	hash := hashInviteToken("token")
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, hashInviteToken("token"))
+	assert.NotEqual(t, hash, hashInviteToken("other"))
+}
+
+func TestActor(t *testing.T) {
+	owner, member := &model.User{ID: 1}, &model.User{ID: 2}
+
+	c := fakeAuditContext{}
+	assert.Nil(t, Actor(c))
+
+	c.Set("user", owner)
+	assert.Equal(t, owner, Actor(c))
+
+	c.Set("actor", member)
+	assert.Equal(t, member, Actor(c))
+}
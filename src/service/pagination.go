@@ -0,0 +1,118 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor is the position of the last item returned in a page of sorted S3 objects. Cursors are opaque to clients
+// and encoded as base64.
+type Cursor struct {
+	LastModified time.Time
+	Key          string
+}
+
+// Encode Returns the opaque string form of the cursor which is handed to clients.
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.LastModified.UnixNano(), 10) + "|" + c.Key
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor Parses a cursor previously returned by Encode.
+func DecodeCursor(encoded string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	nanos, key, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, errors.New("invalid cursor")
+	}
+
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return &Cursor{LastModified: time.Unix(0, n).UTC(), Key: key}, nil
+}
+
+// less Orders objects by last modified time using the key to break ties so that the order is total and stable
+// across requests.
+func less(aTime time.Time, aKey string, bTime time.Time, bKey string, descending bool) bool {
+	if !aTime.Equal(bTime) {
+		if descending {
+			return aTime.After(bTime)
+		}
+		return aTime.Before(bTime)
+	}
+	return aKey < bKey
+}
+
+// PageObjects Sorts objects by their last modified time and returns the page of at most limit objects which comes
+// after the cursor. A cursor for the next page is returned when more objects remain.
+func PageObjects(objects []SimpleS3Object, descending bool, cursor *Cursor, limit int) ([]SimpleS3Object, *Cursor) {
+	sort.Slice(objects, func(i, j int) bool {
+		return less(objects[i].LastModified, objects[i].Key, objects[j].LastModified, objects[j].Key, descending)
+	})
+
+	start := 0
+	if cursor != nil {
+		start = sort.Search(len(objects), func(i int) bool {
+			return less(cursor.LastModified, cursor.Key, objects[i].LastModified, objects[i].Key, descending)
+		})
+	}
+
+	end := start + limit
+	if end >= len(objects) {
+		return objects[start:], nil
+	}
+
+	last := objects[end-1]
+	return objects[start:end], &Cursor{LastModified: last.LastModified, Key: last.Key}
+}
+
+// PageObjectsByKey Returns the page of at most limit objects which comes after the cursor when objects are ordered by
+// key. Prefixes are read in key order and list is asked only for the objects still needed, so a page never requires
+// listing a prefix in full. A cursor for the next page is returned when more objects remain.
+func PageObjectsByKey(prefixes []string, cursor *Cursor, limit int, list func(prefix, startAfter string, limit int) ([]SimpleS3Object, error)) ([]SimpleS3Object, *Cursor, error) {
+	sorted := append([]string(nil), prefixes...)
+	sort.Strings(sorted)
+
+	var objects []SimpleS3Object
+	for _, prefix := range sorted {
+		need := limit + 1 - len(objects)
+		if need <= 0 {
+			break
+		}
+
+		startAfter := ""
+		if cursor != nil {
+			if cursor.Key >= prefix && !strings.HasPrefix(cursor.Key, prefix) {
+				// Every key under this prefix sorts before the cursor.
+				continue
+			}
+			if strings.HasPrefix(cursor.Key, prefix) {
+				startAfter = cursor.Key
+			}
+		}
+
+		listed, err := list(prefix, startAfter, need)
+		if err != nil {
+			return nil, nil, err
+		}
+		objects = append(objects, listed...)
+	}
+
+	if len(objects) <= limit {
+		return objects, nil, nil
+	}
+
+	objects = objects[:limit]
+	return objects, &Cursor{Key: objects[limit-1].Key}, nil
+}
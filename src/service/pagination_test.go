@@ -0,0 +1,81 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCursorEncodeDecode(t *testing.T) {
+	c := Cursor{LastModified: time.Unix(100, 5).UTC(), Key: "mods/123/foo|bar.zip"}
+	decoded, err := DecodeCursor(c.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, c, *decoded)
+
+	_, err = DecodeCursor("!!!")
+	assert.NotNil(t, err)
+}
+
+func TestPageObjects(t *testing.T) {
+	base := time.Unix(1000, 0)
+	objects := []SimpleS3Object{
+		{Key: "a", LastModified: base.Add(1 * time.Minute)},
+		{Key: "b", LastModified: base.Add(3 * time.Minute)},
+		{Key: "c", LastModified: base.Add(2 * time.Minute)},
+		{Key: "d", LastModified: base.Add(2 * time.Minute)},
+	}
+
+	page, next := PageObjects(objects, true, nil, 2)
+	assert.Equal(t, []string{"b", "c"}, keys(page))
+	assert.NotNil(t, next)
+
+	page, next = PageObjects(objects, true, next, 2)
+	assert.Equal(t, []string{"d", "a"}, keys(page))
+	assert.Nil(t, next)
+
+	page, next = PageObjects(objects, false, nil, 10)
+	assert.Equal(t, []string{"a", "c", "d", "b"}, keys(page))
+	assert.Nil(t, next)
+}
+
+func keys(objects []SimpleS3Object) []string {
+	var k []string
+	for _, o := range objects {
+		k = append(k, o.Key)
+	}
+	return k
+}
+
+func TestPageObjectsByKey(t *testing.T) {
+	store := map[string][]string{
+		"mods/123/":     {"mods/123/a.zip", "mods/123/b.zip"},
+		"mods/general/": {"mods/general/c.zip"},
+		"config/123/":   {"config/123/d.cfg"},
+	}
+
+	var requested []string
+	list := func(prefix, startAfter string, limit int) ([]SimpleS3Object, error) {
+		requested = append(requested, prefix)
+		var objects []SimpleS3Object
+		for _, key := range store[prefix] {
+			if key > startAfter && len(objects) < limit {
+				objects = append(objects, SimpleS3Object{Key: key})
+			}
+		}
+		return objects, nil
+	}
+
+	prefixes := []string{"mods/general/", "mods/123/", "config/123/"}
+	page, next, err := PageObjectsByKey(prefixes, nil, 2, list)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"config/123/d.cfg", "mods/123/a.zip"}, keys(page))
+	assert.Equal(t, []string{"config/123/", "mods/123/"}, requested)
+	assert.NotNil(t, next)
+
+	requested = nil
+	page, next, err = PageObjectsByKey(prefixes, next, 2, list)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mods/123/b.zip", "mods/general/c.zip"}, keys(page))
+	assert.Equal(t, []string{"mods/123/", "mods/general/"}, requested)
+	assert.Nil(t, next)
+}
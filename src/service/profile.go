@@ -0,0 +1,446 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ProfileFormatJSON = "json"
+	ProfileFormatZip  = "zip"
+	ProfileFormatR2Z  = "r2z"
+
+	ConfigDestination  = "/valheim/BepInEx/config"
+	PluginsDestination = "/valheim/BepInEx/plugins"
+
+	// profileManifestName is the profile definition inside a hearthhub profile zip.
+	profileManifestName = "profile.json"
+
+	// r2modmanManifestName is the profile definition inside an r2modman .r2z export.
+	r2modmanManifestName = "export.r2x"
+
+	// maxProfileExtractSize is the most data (30MB) decompressed from a profile archive across its manifest and config files.
+	maxProfileExtractSize = 30 << 20
+)
+
+// Profile is a named set of mods, config files, and world modifiers which can be applied to a server.
+type Profile struct {
+	ID          uint              `gorm:"primaryKey" json:"id"`
+	UserID      uint              `gorm:"column:user_id;uniqueIndex:idx_profile_user_name" json:"user_id"`
+	Name        string            `gorm:"column:name;size:191;uniqueIndex:idx_profile_user_name" json:"name"`
+	Description string            `gorm:"column:description;type:text" json:"description"`
+	Mods        []ProfileMod      `gorm:"column:mods;serializer:json" json:"mods"`
+	Configs     []ProfileConfig   `gorm:"column:configs;serializer:json" json:"configs"`
+	Modifiers   []ProfileModifier `gorm:"column:modifiers;serializer:json" json:"modifiers"`
+	CreatedAt   time.Time         `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   time.Time         `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Profile) TableName() string {
+	return "profiles"
+}
+
+// ProfileMod is a mod in a profile. Mods imported from r2modman only have a Thunderstore full name and version until they are
+// located in the mod catalog when the profile is applied.
+type ProfileMod struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+}
+
+// ProfileConfig is a config file in a profile. The file contents are stored in S3 under Prefix.
+type ProfileConfig struct {
+	Prefix      string `json:"prefix"`
+	Destination string `json:"destination"`
+}
+
+// ProfileModifier is a world modifier in a profile.
+type ProfileModifier struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ProfileDiff is the set of changes needed to make a server match a profile.
+type ProfileDiff struct {
+	Install []ProfileMod    `json:"install"`
+	Remove  []InstalledFile `json:"remove"`
+	Configs []ProfileConfig `json:"configs"`
+}
+
+// Empty Returns true when no files need to change.
+func (d *ProfileDiff) Empty() bool {
+	return len(d.Install) == 0 && len(d.Remove) == 0 && len(d.Configs) == 0
+}
+
+// CaptureProfile Creates a profile from the mods and configs installed on a server and the modifiers of its world.
+func CaptureProfile(name, description string, installed []InstalledFile, world *model.WorldDetails) *Profile {
+	profile := &Profile{
+		Name:        name,
+		Description: description,
+		Mods:        []ProfileMod{},
+		Configs:     []ProfileConfig{},
+		Modifiers:   []ProfileModifier{},
+	}
+
+	for _, f := range installed {
+		if f.Status == InstallStatusFailed {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(f.Destination, ConfigDestination):
+			profile.Configs = append(profile.Configs, ProfileConfig{Prefix: f.Prefix, Destination: f.Destination})
+		case strings.HasPrefix(f.Destination, PluginsDestination):
+			profile.Mods = append(profile.Mods, ProfileMod{
+				Name:     f.Name,
+				FullName: fullNameFromPrefix(f.Prefix),
+				Version:  f.Version,
+				Prefix:   f.Prefix,
+			})
+		}
+	}
+
+	if world != nil {
+		for _, m := range world.Modifiers {
+			profile.Modifiers = append(profile.Modifiers, ProfileModifier{Key: m.Key, Value: m.Value})
+		}
+	}
+
+	return profile
+}
+
+// DiffProfile Compares the mods and configs of a profile with the files installed on a server. Installed mods not in the profile
+// are removed and profile mods which are missing or installed at a different version are installed. Configs in the profile are
+// always written since their contents may differ from what is on the server.
+func DiffProfile(profile *Profile, installed []InstalledFile) *ProfileDiff {
+	diff := &ProfileDiff{Install: []ProfileMod{}, Remove: []InstalledFile{}, Configs: []ProfileConfig{}}
+
+	wanted := map[string]ProfileMod{}
+	for _, m := range profile.Mods {
+		if preinstalledPackages[m.Name] {
+			continue
+		}
+		wanted[m.Name] = m
+	}
+
+	wantedConfigs := map[string]bool{}
+	for _, c := range profile.Configs {
+		wantedConfigs[path.Join(c.Destination, path.Base(c.Prefix))] = true
+		diff.Configs = append(diff.Configs, c)
+	}
+
+	current := map[string]InstalledFile{}
+	for _, f := range installed {
+		switch {
+		case strings.HasPrefix(f.Destination, ConfigDestination):
+			if !wantedConfigs[path.Join(f.Destination, path.Base(f.Prefix))] {
+				diff.Remove = append(diff.Remove, f)
+			}
+		case strings.HasPrefix(f.Destination, PluginsDestination):
+			if _, ok := wanted[f.Name]; !ok {
+				diff.Remove = append(diff.Remove, f)
+				continue
+			}
+			current[f.Name] = f
+		}
+	}
+
+	for _, m := range profile.Mods {
+		if preinstalledPackages[m.Name] {
+			continue
+		}
+
+		f, ok := current[m.Name]
+		if !ok || f.Status == InstallStatusFailed || (m.Version != "" && f.Version != "" && CompareVersions(f.Version, m.Version) != 0) {
+			diff.Install = append(diff.Install, m)
+		}
+	}
+
+	sort.Slice(diff.Remove, func(i, j int) bool {
+		return diff.Remove[i].Prefix < diff.Remove[j].Prefix
+	})
+	return diff
+}
+
+// ExportedProfile is the portable definition of a profile used by the JSON and zip export formats.
+type ExportedProfile struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Mods        []ProfileMod      `json:"mods"`
+	Configs     []ProfileConfig   `json:"configs"`
+	Modifiers   []ProfileModifier `json:"modifiers"`
+}
+
+// ProfileFile is a config file read from or written to a profile archive.
+type ProfileFile struct {
+	// Path is the path of the file relative to the BepInEx config directory
+	Path string
+	Data []byte
+}
+
+// ImportedProfile is a profile parsed from an uploaded file along with the config files it contained.
+type ImportedProfile struct {
+	Profile *Profile
+	Files   []ProfileFile
+}
+
+type r2modmanExport struct {
+	ProfileName string        `yaml:"profileName"`
+	Mods        []r2modmanMod `yaml:"mods"`
+}
+
+type r2modmanMod struct {
+	Name    string `yaml:"name"`
+	Version struct {
+		Major int `yaml:"major"`
+		Minor int `yaml:"minor"`
+		Patch int `yaml:"patch"`
+	} `yaml:"version"`
+	Enabled bool `yaml:"enabled"`
+}
+
+// Export Returns the portable definition of a profile.
+func (p *Profile) Export() *ExportedProfile {
+	return &ExportedProfile{
+		Name:        p.Name,
+		Description: p.Description,
+		Mods:        p.Mods,
+		Configs:     p.Configs,
+		Modifiers:   p.Modifiers,
+	}
+}
+
+// WriteProfileArchive Writes a profile archive. Zip archives contain profile.json and r2z archives contain an r2modman
+// export.r2x, both store config files under BepInEx/config/.
+func WriteProfileArchive(p *Profile, format string, files []ProfileFile) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	var manifestName string
+	var manifest []byte
+	var err error
+
+	switch format {
+	case ProfileFormatZip:
+		manifestName = profileManifestName
+		manifest, err = json.MarshalIndent(p.Export(), "", "  ")
+	case ProfileFormatR2Z:
+		manifestName = r2modmanManifestName
+		manifest, err = yaml.Marshal(toR2modman(p))
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profile: %v", err)
+	}
+
+	w, err := zw.Create(manifestName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(manifest); err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		w, err = zw.Create(path.Join("BepInEx/config", f.Path))
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toR2modman(p *Profile) *r2modmanExport {
+	export := &r2modmanExport{ProfileName: p.Name, Mods: []r2modmanMod{}}
+	for _, m := range p.Mods {
+		// r2modman can only install Thunderstore packages
+		if m.FullName == "" {
+			continue
+		}
+
+		mod := r2modmanMod{Name: m.FullName, Enabled: true}
+		parts := strings.Split(m.Version, ".")
+		nums := make([]int, 3)
+		for i := 0; i < len(parts) && i < 3; i++ {
+			_, _ = fmt.Sscanf(parts[i], "%d", &nums[i])
+		}
+		mod.Version.Major, mod.Version.Minor, mod.Version.Patch = nums[0], nums[1], nums[2]
+		export.Mods = append(export.Mods, mod)
+	}
+	return export
+}
+
+// ParseProfile Parses an uploaded profile which may be a JSON export, a hearthhub profile zip, or an r2modman .r2z export.
+func ParseProfile(data []byte) (*ImportedProfile, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var exported ExportedProfile
+		if err := json.Unmarshal(trimmed, &exported); err != nil {
+			return nil, fmt.Errorf("failed to parse profile json: %v", err)
+		}
+		return &ImportedProfile{Profile: fromExported(&exported)}, nil
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("profile must be a json file, a profile zip, or an r2modman .r2z export")
+	}
+
+	imported := &ImportedProfile{}
+	remaining := int64(maxProfileExtractSize)
+	for _, f := range reader.File {
+		// Only the manifests and config files are read so other entries are never decompressed
+		isConfig := strings.HasPrefix(f.Name, "BepInEx/config/")
+		if f.FileInfo().IsDir() || (f.Name != profileManifestName && f.Name != r2modmanManifestName && !isConfig) {
+			continue
+		}
+
+		contents, err := readZipFile(f, &remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case f.Name == profileManifestName:
+			var exported ExportedProfile
+			if err = json.Unmarshal(contents, &exported); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", profileManifestName, err)
+			}
+			imported.Profile = fromExported(&exported)
+		case f.Name == r2modmanManifestName:
+			var export r2modmanExport
+			if err = yaml.Unmarshal(contents, &export); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", r2modmanManifestName, err)
+			}
+			imported.Profile = fromR2modman(&export)
+		case isConfig:
+			rel := strings.TrimPrefix(f.Name, "BepInEx/config/")
+			if strings.Contains(rel, "..") || path.IsAbs(rel) {
+				return nil, fmt.Errorf("invalid config path in profile: %s", f.Name)
+			}
+			imported.Files = append(imported.Files, ProfileFile{Path: rel, Data: contents})
+		}
+	}
+
+	if imported.Profile == nil {
+		return nil, fmt.Errorf("archive does not contain a %s or %s", profileManifestName, r2modmanManifestName)
+	}
+	return imported, nil
+}
+
+// readZipFile Decompresses a file from an archive, taking its size from the remaining bytes which may be extracted. The size in
+// the archive's header is checked first but the read is limited too since the header can understate the contents.
+func readZipFile(f *zip.File, remaining *int64) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(*remaining) {
+		return nil, fmt.Errorf("profile archive exceeds the maximum extracted size of %d bytes", maxProfileExtractSize)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, *remaining+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", f.Name, err)
+	}
+	if int64(len(data)) > *remaining {
+		return nil, fmt.Errorf("profile archive exceeds the maximum extracted size of %d bytes", maxProfileExtractSize)
+	}
+	*remaining -= int64(len(data))
+	return data, nil
+}
+
+func fromExported(e *ExportedProfile) *Profile {
+	return &Profile{
+		Name:        e.Name,
+		Description: e.Description,
+		Mods:        e.Mods,
+		Configs:     e.Configs,
+		Modifiers:   e.Modifiers,
+	}
+}
+
+func fromR2modman(e *r2modmanExport) *Profile {
+	profile := &Profile{Name: e.ProfileName, Mods: []ProfileMod{}}
+	for _, m := range e.Mods {
+		if !m.Enabled {
+			continue
+		}
+		profile.Mods = append(profile.Mods, ProfileMod{
+			Name:     DependencyPackageName(m.Name),
+			FullName: m.Name,
+			Version:  fmt.Sprintf("%d.%d.%d", m.Version.Major, m.Version.Minor, m.Version.Patch),
+		})
+	}
+	return profile
+}
+
+// ScopeToUser Drops references to files in S3 which the user does not own. Mods outside of the user's mods and the shared
+// catalog mods keep their Thunderstore name so they can still be located in the catalog when the profile is applied.
+func (p *Profile) ScopeToUser(discordId string) {
+	mods := make([]ProfileMod, 0, len(p.Mods))
+	for _, m := range p.Mods {
+		if m.Prefix != "" && !strings.HasPrefix(m.Prefix, "mods/general/") && !strings.HasPrefix(m.Prefix, fmt.Sprintf("mods/%s/", discordId)) {
+			m.Prefix = ""
+		}
+		mods = append(mods, m)
+	}
+	p.Mods = mods
+
+	configs := make([]ProfileConfig, 0, len(p.Configs))
+	for _, c := range p.Configs {
+		if strings.HasPrefix(c.Prefix, fmt.Sprintf("config/%s/", discordId)) && strings.HasPrefix(c.Destination, ConfigDestination) {
+			configs = append(configs, c)
+		}
+	}
+	p.Configs = configs
+}
+
+// fullNameFromPrefix Returns the Thunderstore full name of a mod installed from the catalog i.e. mods/general/Owner-Name.zip.
+func fullNameFromPrefix(prefix string) string {
+	base := strings.TrimSuffix(path.Base(prefix), path.Ext(prefix))
+	if strings.Contains(base, "-") {
+		return base
+	}
+	return ""
+}
+
+// ListProfiles Returns every profile owned by a user.
+func ListProfiles(db *gorm.DB, userId uint) ([]Profile, error) {
+	var profiles []Profile
+	if err := db.Where("user_id = ?", userId).Order("name ASC").Find(&profiles).Error; err != nil {
+		return nil, fmt.Errorf("failed to list profiles: %v", err)
+	}
+	return profiles, nil
+}
+
+// GetProfile Returns a profile owned by a user.
+func GetProfile(db *gorm.DB, userId, id uint) (*Profile, error) {
+	var profile Profile
+	if err := db.Where("user_id = ?", userId).First(&profile, id).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
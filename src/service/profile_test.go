@@ -0,0 +1,123 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCaptureProfile(t *testing.T) {
+	installed := []InstalledFile{
+		{Prefix: "mods/general/ValheimModding-Jotunn.zip", Destination: PluginsDestination, Name: "Jotunn", Version: "2.20.0", Status: InstallStatusInstalled},
+		{Prefix: "mods/123/Broken.dll", Destination: PluginsDestination, Name: "Broken", Status: InstallStatusFailed},
+		{Prefix: "config/123/jotunn.cfg", Destination: ConfigDestination, Status: InstallStatusInstalled},
+	}
+	world := &model.WorldDetails{Modifiers: []model.Modifier{{Key: "combat", Value: "hard"}}}
+
+	p := CaptureProfile("hardcore", "", installed, world)
+	assert.Equal(t, []ProfileMod{{Name: "Jotunn", FullName: "ValheimModding-Jotunn", Version: "2.20.0", Prefix: "mods/general/ValheimModding-Jotunn.zip"}}, p.Mods)
+	assert.Equal(t, []ProfileConfig{{Prefix: "config/123/jotunn.cfg", Destination: ConfigDestination}}, p.Configs)
+	assert.Equal(t, []ProfileModifier{{Key: "combat", Value: "hard"}}, p.Modifiers)
+}
+
+func TestDiffProfile(t *testing.T) {
+	installed := []InstalledFile{
+		{Prefix: "mods/general/ValheimModding-Jotunn.zip", Destination: PluginsDestination, Name: "Jotunn", Version: "2.19.0", Status: InstallStatusInstalled},
+		{Prefix: "mods/123/PlantEverything.dll", Destination: PluginsDestination, Name: "PlantEverything", Status: InstallStatusInstalled},
+		{Prefix: "mods/general/RandyKnapp-EpicLoot.zip", Destination: PluginsDestination, Name: "EpicLoot", Version: "0.10.0", Status: InstallStatusInstalled},
+		{Prefix: "config/123/old.cfg", Destination: ConfigDestination, Status: InstallStatusInstalled},
+		{Prefix: "worlds/123/world.db", Destination: "/root/.config/unity3d/IronGate/Valheim/worlds_local", Status: InstallStatusInstalled},
+	}
+	p := &Profile{
+		Mods: []ProfileMod{
+			{Name: "BepInExPack_Valheim", FullName: "denikson-BepInExPack_Valheim"},
+			{Name: "Jotunn", FullName: "ValheimModding-Jotunn", Version: "2.20.0"},
+			{Name: "EpicLoot", Version: "0.10.0"},
+		},
+		Configs: []ProfileConfig{{Prefix: "config/123/profiles/hardcore/jotunn.cfg", Destination: ConfigDestination}},
+	}
+
+	diff := DiffProfile(p, installed)
+	assert.Equal(t, []ProfileMod{{Name: "Jotunn", FullName: "ValheimModding-Jotunn", Version: "2.20.0"}}, diff.Install)
+	assert.Len(t, diff.Remove, 2)
+	assert.Equal(t, "config/123/old.cfg", diff.Remove[0].Prefix)
+	assert.Equal(t, "mods/123/PlantEverything.dll", diff.Remove[1].Prefix)
+	assert.Len(t, diff.Configs, 1)
+	assert.False(t, diff.Empty())
+}
+
+func TestParseProfileRoundTrip(t *testing.T) {
+	p := &Profile{
+		Name:      "hardcore",
+		Mods:      []ProfileMod{{Name: "Jotunn", FullName: "ValheimModding-Jotunn", Version: "2.20.1"}, {Name: "Local", Prefix: "mods/123/Local.dll"}},
+		Modifiers: []ProfileModifier{{Key: "combat", Value: "hard"}},
+	}
+	files := []ProfileFile{{Path: "com.jotunn.cfg", Data: []byte("[General]")}}
+
+	archive, err := WriteProfileArchive(p, ProfileFormatZip, files)
+	assert.NoError(t, err)
+	imported, err := ParseProfile(archive)
+	assert.NoError(t, err)
+	assert.Equal(t, p.Mods, imported.Profile.Mods)
+	assert.Equal(t, p.Modifiers, imported.Profile.Modifiers)
+	assert.Equal(t, files, imported.Files)
+
+	// r2modman exports only keep enabled Thunderstore mods
+	archive, err = WriteProfileArchive(p, ProfileFormatR2Z, files)
+	assert.NoError(t, err)
+	imported, err = ParseProfile(archive)
+	assert.NoError(t, err)
+	assert.Equal(t, "hardcore", imported.Profile.Name)
+	assert.Equal(t, []ProfileMod{{Name: "Jotunn", FullName: "ValheimModding-Jotunn", Version: "2.20.1"}}, imported.Profile.Mods)
+	assert.Len(t, imported.Files, 1)
+
+	imported, err = ParseProfile([]byte(`{"name": "json", "mods": [{"name": "Jotunn"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "json", imported.Profile.Name)
+
+	_, err = ParseProfile([]byte("not a profile"))
+	assert.Error(t, err)
+}
+
+func TestParseProfileExtractLimit(t *testing.T) {
+	archive := func(name string) []byte {
+		buf := new(bytes.Buffer)
+		zw := zip.NewWriter(buf)
+		w, _ := zw.Create(profileManifestName)
+		_, _ = w.Write([]byte(`{"name": "bomb"}`))
+		// Zeros compress to a small archive which would decompress past the limit
+		w, _ = zw.Create(name)
+		_, _ = w.Write(make([]byte, maxProfileExtractSize+1))
+		assert.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	_, err := ParseProfile(archive("BepInEx/config/huge.cfg"))
+	assert.ErrorContains(t, err, "maximum extracted size")
+
+	// Entries which are not used are never decompressed
+	imported, err := ParseProfile(archive("BepInEx/plugins/huge.dll"))
+	assert.NoError(t, err)
+	assert.Equal(t, "bomb", imported.Profile.Name)
+	assert.Empty(t, imported.Files)
+}
+
+func TestProfileScopeToUser(t *testing.T) {
+	p := &Profile{
+		Mods: []ProfileMod{
+			{Name: "Jotunn", FullName: "ValheimModding-Jotunn", Prefix: "mods/general/ValheimModding-Jotunn.zip"},
+			{Name: "Theirs", Prefix: "mods/456/Theirs.dll"},
+		},
+		Configs: []ProfileConfig{
+			{Prefix: "config/123/mine.cfg", Destination: ConfigDestination},
+			{Prefix: "config/456/theirs.cfg", Destination: ConfigDestination},
+		},
+	}
+
+	p.ScopeToUser("123")
+	assert.Equal(t, "mods/general/ValheimModding-Jotunn.zip", p.Mods[0].Prefix)
+	assert.Empty(t, p.Mods[1].Prefix)
+	assert.Equal(t, []ProfileConfig{{Prefix: "config/123/mine.cfg", Destination: ConfigDestination}}, p.Configs)
+}
@@ -10,6 +10,9 @@ import (
 	"time"
 )
 
+// ServerStatusExchange is the exchange websocket connections bind to using the user's discord id as the routing key.
+const ServerStatusExchange = "valheim-server-status"
+
 type Message struct {
 	Type string `json:"type"`
 	Body []byte `json:"content"`
@@ -24,6 +27,8 @@ type RabbitMqService struct {
 	routingName    string
 }
 
+// MakeRabbitMQService Connects to RabbitMQ and declares a durable queue named after the routing key which is bound to the exchange.
+// Replicas share the queue as competing consumers.
 func MakeRabbitMQService(exchangeName, routingKey string) (*RabbitMqService, error) {
 	credentials := fmt.Sprintf("%s:%s", os.Getenv("RABBITMQ_DEFAULT_USER"), os.Getenv("RABBITMQ_DEFAULT_PASS"))
 	conn, err := amqp.Dial(fmt.Sprintf("amqp://%s@%s/", credentials, os.Getenv("RABBITMQ_BASE_URL")))
@@ -58,15 +63,30 @@ func MakeRabbitMQService(exchangeName, routingKey string) (*RabbitMqService, err
 		return nil, err
 	}
 
-	// Declare a unique queue for this object instance
-	q, err := ch.QueueDeclare(
-		"",
-		false,
-		true,
+	err = ch.ExchangeDeclare(
+		ServerStatusExchange,
+		"direct",
 		true,
 		false,
+		false,
+		false,
 		nil,
 	)
+	if err != nil {
+		log.Errorf("failed to declare server status exchange: %v", err)
+		return nil, err
+	}
+
+	// The queue is durable and shared by every replica so each message is delivered to exactly one consumer and messages published
+	// while no replica is consuming wait in the queue instead of being dropped.
+	q, err := ch.QueueDeclare(
+		routingKey, // name
+		true,       // durable
+		false,      // auto-deleted
+		false,      // exclusive
+		false,      // no-wait
+		nil,        // arguments
+	)
 
 	if err != nil {
 		log.Errorf("error declaring queue: %v", err)
@@ -110,6 +130,32 @@ func (r *RabbitMqService) PublishMessage(message *Message) error {
 		r.routingName,
 		false,
 		false,
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Body:         messageBytes,
+		},
+	)
+}
+
+// PublishUserEvent Publishes an event for a single user. Every websocket connection the user has open is bound to the
+// server status exchange by their discord id so the event is forwarded straight to the frontend.
+func (r *RabbitMqService) PublishUserEvent(discordId, eventType string, content interface{}) error {
+	messageBytes, err := json.Marshal(map[string]interface{}{
+		"type":       eventType,
+		"content":    content,
+		"discord_id": discordId,
+	})
+	if err != nil {
+		log.Errorf("failed to marshal user event: %v", err)
+		return err
+	}
+
+	return r.PublishChannel.Publish(
+		ServerStatusExchange,
+		discordId,
+		false,
+		false,
 		amqp.Publishing{
 			ContentType: "application/json",
 			Body:        messageBytes,
@@ -117,12 +163,21 @@ func (r *RabbitMqService) PublishMessage(message *Message) error {
 	)
 }
 
+// RegisterConsumer Consumes messages from the shared queue one at a time, waiting for the delay before each message. Messages are
+// acknowledged once the consumer returns so a replica which stops mid-message leaves it for another replica. A message whose
+// consumer panics is requeued once and dropped if it fails again so it cannot block the queue.
 func (r *RabbitMqService) RegisterConsumer(consumer func(message Message, db *gorm.DB), delay time.Duration, db *gorm.DB) error {
+	if err := r.ConsumeChannel.Qos(1, 0, false); err != nil {
+		log.Errorf("error setting consumer prefetch: %v", err)
+		r.Connection.Close()
+		return err
+	}
+
 	msgs, err := r.ConsumeChannel.Consume(
 		r.Queue.Name,
 		"",
-		true,
-		true,
+		false, // auto-ack
+		false, // exclusive
 		false,
 		false,
 		nil,
@@ -139,15 +194,30 @@ func (r *RabbitMqService) RegisterConsumer(consumer func(message Message, db *go
 			var message Message
 			if err := json.Unmarshal(msg.Body, &message); err != nil {
 				log.Errorf("error unmarshaling stripe websocket message: %v", err)
+				msg.Nack(false, false)
 				continue
 			}
-			consumer(message, db)
+			consumeMessage(consumer, message, db, msg)
 		}
 	}()
 
 	return nil
 }
 
+func consumeMessage(consumer func(message Message, db *gorm.DB), message Message, db *gorm.DB, delivery amqp.Delivery) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Errorf("consumer panicked on %s message (redelivered: %t): %v", message.Type, delivery.Redelivered, p)
+			delivery.Nack(false, !delivery.Redelivered)
+		}
+	}()
+
+	consumer(message, db)
+	if err := delivery.Ack(false); err != nil {
+		log.Errorf("failed to ack %s message: %v", message.Type, err)
+	}
+}
+
 func (r *RabbitMqService) Close() {
 	r.PublishChannel.Close()
 	r.ConsumeChannel.Close()
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RateLimitBackendMemory keeps buckets in the memory of each replica so limits apply per replica.
+	RateLimitBackendMemory = "memory"
+
+	// RateLimitBackendDatabase keeps buckets in the database so limits are shared by every replica.
+	RateLimitBackendDatabase = "database"
+
+	// rateLimitSweepInterval is how often backends delete buckets which have not been used in a while.
+	rateLimitSweepInterval = 10 * time.Minute
+
+	// rateLimitIdleTTL is how long a bucket is kept after it was last used. It must be longer than any policy takes to refill.
+	rateLimitIdleTTL = 24 * time.Hour
+)
+
+var (
+	// RateLimitDefault limits every request from a single ip address.
+	RateLimitDefault = RateLimitPolicy{Name: "default", Limit: 600, Period: time.Minute, Burst: 120}
+
+	// RateLimitServerCreate limits server creation which waits on and creates several Kubernetes resources.
+	RateLimitServerCreate = RateLimitPolicy{Name: "server-create", Limit: 5, Period: time.Hour, Burst: 2}
+
+	// RateLimitServerUpdate limits requests which patch, scale, upgrade, or delete a server's Kubernetes resources.
+	RateLimitServerUpdate = RateLimitPolicy{Name: "server-update", Limit: 30, Period: time.Hour, Burst: 10}
+
+	// RateLimitFileJob limits requests which create a Kubernetes Job to install or remove files.
+	RateLimitFileJob = RateLimitPolicy{Name: "file-job", Limit: 20, Period: 10 * time.Minute, Burst: 10}
+
+	// RateLimitUpload limits presigned upload urls and the checks which run once an upload completes.
+	RateLimitUpload = RateLimitPolicy{Name: "upload", Limit: 60, Period: 10 * time.Minute, Burst: 20}
+
+	// RateLimitSupport limits support messages which are each sent as an email.
+	RateLimitSupport = RateLimitPolicy{Name: "support", Limit: 5, Period: time.Hour, Burst: 2}
+)
+
+// DefaultTrustedProxies are the private ranges the ingress controller forwards requests from inside the cluster.
+var DefaultTrustedProxies = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// TrustedProxies Returns the proxies whose X-Forwarded-For header is trusted when resolving the client ip which rate limits and
+// audit entries use. TRUSTED_PROXIES is a comma separated list of ips and cidrs which defaults to the private ranges, setting it
+// to an empty value trusts no proxies so the ip the request came from is used.
+func TrustedProxies() []string {
+	value, ok := os.LookupEnv("TRUSTED_PROXIES")
+	if !ok {
+		return DefaultTrustedProxies
+	}
+
+	var proxies []string
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// RateLimitPolicy is a token bucket which holds up to Burst tokens and refills at Limit tokens per Period. Each request takes
+// one token and requests are rejected while the bucket is empty.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// rate Returns the number of tokens the bucket refills per second.
+func (p RateLimitPolicy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// RetryAfter is how long until the next token is available when the request was not allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitBackend stores token buckets. Implementations must take tokens atomically so concurrent requests for the same key
+// cannot both take the last token.
+type RateLimitBackend interface {
+	Take(ctx context.Context, key string, policy RateLimitPolicy) (*RateLimitResult, error)
+}
+
+// MakeRateLimitBackend Creates the rate limit backend named by RATE_LIMIT_BACKEND. The in memory backend is used when it is not
+// set, deployments with more than one replica should use the database backend so every replica shares the same limits.
+func MakeRateLimitBackend(db *gorm.DB) RateLimitBackend {
+	switch os.Getenv("RATE_LIMIT_BACKEND") {
+	case RateLimitBackendDatabase:
+		return MakeDatabaseRateLimitBackend(db)
+	case "", RateLimitBackendMemory:
+		return MakeMemoryRateLimitBackend()
+	default:
+		log.Warnf("unknown rate limit backend: %s, using in memory rate limits", os.Getenv("RATE_LIMIT_BACKEND"))
+		return MakeMemoryRateLimitBackend()
+	}
+}
+
+// tokenBucket is the state of a single bucket. Tokens are refilled lazily based on the time since the bucket was last refilled.
+type tokenBucket struct {
+	Tokens     float64
+	RefilledAt time.Time
+}
+
+// take Refills the bucket for the time elapsed since it was last refilled and takes a token if one is available.
+func (b *tokenBucket) take(policy RateLimitPolicy, now time.Time) *RateLimitResult {
+	elapsed := now.Sub(b.RefilledAt).Seconds()
+	if elapsed > 0 {
+		b.Tokens = math.Min(float64(policy.Burst), b.Tokens+elapsed*policy.rate())
+		b.RefilledAt = now
+	}
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return &RateLimitResult{Allowed: true, Remaining: int(b.Tokens)}
+	}
+
+	wait := (1 - b.Tokens) / policy.rate()
+	return &RateLimitResult{RetryAfter: time.Duration(wait * float64(time.Second))}
+}
+
+// MemoryRateLimitBackend keeps token buckets in memory. Limits are enforced separately by each replica.
+type MemoryRateLimitBackend struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// MakeMemoryRateLimitBackend Creates an empty in memory rate limit backend.
+func MakeMemoryRateLimitBackend() *MemoryRateLimitBackend {
+	return &MemoryRateLimitBackend{
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Take Takes a token from the bucket for a key, creating a full bucket the first time a key is seen.
+func (m *MemoryRateLimitBackend) Take(ctx context.Context, key string, policy RateLimitPolicy) (*RateLimitResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) > rateLimitSweepInterval {
+		for k, b := range m.buckets {
+			if now.Sub(b.RefilledAt) > rateLimitIdleTTL {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{Tokens: float64(policy.Burst), RefilledAt: now}
+		m.buckets[key] = bucket
+	}
+	return bucket.take(policy, now), nil
+}
+
+// RateLimitBucket is a token bucket stored in the database so it is shared by every replica.
+type RateLimitBucket struct {
+	Key        string    `gorm:"column:key;primaryKey;size:191"`
+	Tokens     float64   `gorm:"column:tokens"`
+	RefilledAt time.Time `gorm:"column:refilled_at;index"`
+}
+
+func (RateLimitBucket) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// DatabaseRateLimitBackend keeps token buckets in the database. Buckets are locked while a token is taken so limits hold across
+// replicas.
+type DatabaseRateLimitBackend struct {
+	db        *gorm.DB
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// MakeDatabaseRateLimitBackend Creates a rate limit backend which stores buckets in the rate_limit_buckets table.
+func MakeDatabaseRateLimitBackend(db *gorm.DB) *DatabaseRateLimitBackend {
+	return &DatabaseRateLimitBackend{db: db, lastSweep: time.Now()}
+}
+
+// Take Takes a token from the bucket for a key, creating a full bucket the first time a key is seen.
+func (d *DatabaseRateLimitBackend) Take(ctx context.Context, key string, policy RateLimitPolicy) (*RateLimitResult, error) {
+	d.sweep()
+
+	var result *RateLimitResult
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var row RateLimitBucket
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", key).First(&row).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Another replica may create the bucket first in which case the insert is skipped and its bucket is locked instead
+			row = RateLimitBucket{Key: key, Tokens: float64(policy.Burst), RefilledAt: now}
+			if err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+				return err
+			}
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", key).First(&row).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		bucket := tokenBucket{Tokens: row.Tokens, RefilledAt: row.RefilledAt}
+		result = bucket.take(policy, now)
+		return tx.Model(&row).Updates(map[string]interface{}{"tokens": bucket.Tokens, "refilled_at": bucket.RefilledAt}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to take rate limit token for %s: %v", key, err)
+	}
+	return result, nil
+}
+
+// sweep Deletes buckets which have not been used in a day. Sweeps run in the background at most once per sweep interval.
+func (d *DatabaseRateLimitBackend) sweep() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Since(d.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	d.lastSweep = time.Now()
+
+	go func() {
+		if err := d.db.Where("refilled_at < ?", time.Now().Add(-rateLimitIdleTTL)).Delete(&RateLimitBucket{}).Error; err != nil {
+			log.Errorf("failed to delete idle rate limit buckets: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	policy := RateLimitPolicy{Name: "test", Limit: 1, Period: time.Second, Burst: 2}
+	now := time.Now()
+	bucket := &tokenBucket{Tokens: 2, RefilledAt: now}
+
+	assert.True(t, bucket.take(policy, now).Allowed)
+	result := bucket.take(policy, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result = bucket.take(policy, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	result = bucket.take(policy, now.Add(500*time.Millisecond))
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	assert.True(t, bucket.take(policy, now.Add(time.Second)).Allowed)
+
+	// Buckets never refill past their burst
+	result = bucket.take(policy, now.Add(time.Hour))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+}
+
+func TestMemoryRateLimitBackend(t *testing.T) {
+	policy := RateLimitPolicy{Name: "test", Limit: 1, Period: time.Minute, Burst: 1}
+	now := time.Now()
+	backend := MakeMemoryRateLimitBackend()
+	backend.now = func() time.Time { return now }
+
+	result, err := backend.Take(context.Background(), "a", policy)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, _ = backend.Take(context.Background(), "a", policy)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Minute, result.RetryAfter)
+
+	result, _ = backend.Take(context.Background(), "b", policy)
+	assert.True(t, result.Allowed)
+
+	// Idle buckets are swept once they would have refilled
+	now = now.Add(rateLimitIdleTTL + rateLimitSweepInterval + time.Second)
+	result, _ = backend.Take(context.Background(), "a", policy)
+	assert.True(t, result.Allowed)
+	assert.Len(t, backend.buckets, 1)
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	assert.Empty(t, TrustedProxies())
+
+	t.Setenv("TRUSTED_PROXIES", " 10.1.0.0/16, 192.168.1.5 ,")
+	assert.Equal(t, []string{"10.1.0.0/16", "192.168.1.5"}, TrustedProxies())
+
+	// t.Setenv restores the variable once the test finishes
+	os.Unsetenv("TRUSTED_PROXIES")
+	assert.Equal(t, DefaultTrustedProxies, TrustedProxies())
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/cbartram/hearthhub-mod-api/src/util"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ReconcileStatusRunning   = "RUNNING"
+	ReconcileStatusCompleted = "COMPLETED"
+	ReconcileStatusFailed    = "FAILED"
+
+	defaultScanImage = "busybox:1.36"
+)
+
+// DriftReport lists the differences between the files recorded as installed on a server and the files actually on its PVC.
+type DriftReport struct {
+	// Missing are installed files which could not be found on the PVC
+	Missing []string `json:"missing"`
+
+	// Changed are installed files whose contents no longer match what was installed
+	Changed []string `json:"changed"`
+
+	// Unexpected are plugin DLLs on the PVC which were not installed through hearthhub
+	Unexpected []string `json:"unexpected"`
+}
+
+// HasDrift Returns true when the PVC does not match the installed files.
+func (d *DriftReport) HasDrift() bool {
+	return len(d.Missing) > 0 || len(d.Changed) > 0 || len(d.Unexpected) > 0
+}
+
+// ReconcileReport is the result of re-scanning a server's PVC and comparing it to the installed files.
+type ReconcileReport struct {
+	ID          uint        `gorm:"primaryKey" json:"id"`
+	ServerID    uint        `gorm:"column:server_id;index" json:"server_id"`
+	JobName     string      `gorm:"column:job_name" json:"job_name"`
+	Status      string      `gorm:"column:status" json:"status"`
+	Drift       DriftReport `gorm:"column:drift;serializer:json" json:"drift"`
+	Error       string      `gorm:"column:error;type:text" json:"error,omitempty"`
+	CreatedAt   time.Time   `gorm:"column:created_at" json:"created_at"`
+	CompletedAt *time.Time  `gorm:"column:completed_at" json:"completed_at"`
+}
+
+func (ReconcileReport) TableName() string {
+	return "reconcile_reports"
+}
+
+// LatestReconcileReport Returns the most recent reconcile report for a server or nil if it has never been reconciled.
+func LatestReconcileReport(db *gorm.DB, serverId uint) (*ReconcileReport, error) {
+	var reports []ReconcileReport
+	err := db.Where("server_id = ?", serverId).Order("created_at DESC").Limit(1).Find(&reports).Error
+	if err != nil || len(reports) == 0 {
+		return nil, err
+	}
+	return &reports[0], nil
+}
+
+// CreateReconcileJob Creates a job which mounts a server's PVC and prints the checksum of every plugin and config file.
+func CreateReconcileJob(clientset kubernetes.Interface, server *model.Server, discordId string) (string, error) {
+	image := os.Getenv("SCAN_IMAGE")
+	if image == "" {
+		image = defaultScanImage
+	}
+
+	pvcName := server.PVCName
+	if pvcName == "" {
+		pvcName = fmt.Sprintf("valheim-pvc-%s", discordId)
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("mod-reconcile-%s-", discordId),
+			Labels: map[string]string{
+				"tenant-discord-id": discordId,
+			},
+			Namespace: Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            ptr.To(int32(0)),
+			TTLSecondsAfterFinished: ptr.To(int32(3600)),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:            "main",
+							Image:           image,
+							Command:         []string{"sh", "-c", "find /valheim/BepInEx/plugins /valheim/BepInEx/config -type f -exec md5sum {} +"},
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							VolumeMounts:    util.MakeVolumeMounts(),
+						},
+					},
+					RestartPolicy: corev1.RestartPolicyNever,
+					Volumes:       util.MakeVolumes(pvcName),
+				},
+			},
+		},
+	}
+
+	created, err := clientset.BatchV1().Jobs(Namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create reconcile job: %v", err)
+	}
+
+	log.Infof("reconcile job created: %s", created.Name)
+	return created.Name, nil
+}
+
+// StartReconcile Creates a job which scans a server's PVC along with a RUNNING report and a reconcile operation tracking the job.
+// The operation controller completes the report once the job finishes. The actor is the user who requested the reconcile.
+func StartReconcile(db *gorm.DB, clientset kubernetes.Interface, operations *OperationService, server *model.Server, user, actor *model.User) (*ReconcileReport, *Operation, error) {
+	jobName, err := CreateReconcileJob(clientset, server, user.DiscordID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &ReconcileReport{
+		ServerID: server.ID,
+		JobName:  jobName,
+		Status:   ReconcileStatusRunning,
+	}
+	if err = db.Create(report).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create reconcile report: %v", err)
+	}
+
+	op := &Operation{
+		UserID:    user.ID,
+		DiscordID: user.DiscordID,
+		ServerID:  server.ID,
+		Type:      OperationTypeReconcile,
+		Target:    fmt.Sprintf("server-%d", server.ID),
+		JobName:   jobName,
+		Metadata:  map[string]string{"report_id": strconv.Itoa(int(report.ID))},
+	}
+	op.SetActor(actor)
+	if err = operations.Create(op); err != nil {
+		return nil, nil, err
+	}
+	return report, op, nil
+}
+
+// completeReconcile Compares the output of a finished reconcile job with the installed files and saves the result on its report.
+// The user is sent a ModsReconciled event with the report.
+func (o *OperationService) completeReconcile(op *Operation) {
+	if op.Type != OperationTypeReconcile {
+		return
+	}
+
+	var report ReconcileReport
+	if err := o.db.Where("id = ?", op.Metadata["report_id"]).First(&report).Error; err != nil {
+		log.Errorf("failed to get reconcile report for operation %d: %v", op.ID, err)
+		return
+	}
+
+	now := time.Now()
+	report.CompletedAt = &now
+	if drift, err := o.scanDrift(op); err != nil {
+		report.Status = ReconcileStatusFailed
+		report.Error = err.Error()
+	} else {
+		report.Status = ReconcileStatusCompleted
+		report.Drift = *drift
+	}
+
+	if err := o.db.Save(&report).Error; err != nil {
+		log.Errorf("failed to save reconcile report %d: %v", report.ID, err)
+		return
+	}
+
+	if o.rabbit != nil {
+		if err := o.rabbit.PublishUserEvent(op.DiscordID, "ModsReconciled", report); err != nil {
+			log.Errorf("failed to publish reconcile event: %v", err)
+		}
+	}
+}
+
+// scanDrift Returns the drift between the files a reconcile job scanned and the installed files of its server.
+func (o *OperationService) scanDrift(op *Operation) (*DriftReport, error) {
+	if op.Status != OperationSucceeded {
+		return nil, fmt.Errorf("reconcile job %s failed: %s", op.JobName, op.Message)
+	}
+
+	logs, err := JobLogs(context.Background(), o.kubeService.GetClient(), op.JobName)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ListInstalledFiles(o.db, op.ServerID)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := ComputeDrift(files, ParseScanOutput(logs))
+	return &drift, nil
+}
+
+// ParseScanOutput Parses md5sum output into a map of file path to checksum.
+func ParseScanOutput(output string) map[string]string {
+	files := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || len(fields[0]) != 32 {
+			continue
+		}
+		files[fields[1]] = fields[0]
+	}
+	return files
+}
+
+// ComputeDrift Compares the installed files of a server with the files scanned from its PVC. Archives are checked by the DLLs
+// they contain while single files are checked by their path and checksum. Checksums from multipart uploads are not MD5s and
+// are skipped.
+func ComputeDrift(installed []InstalledFile, scanned map[string]string) DriftReport {
+	drift := DriftReport{Missing: []string{}, Changed: []string{}, Unexpected: []string{}}
+
+	dllPaths := map[string]string{}
+	for p := range scanned {
+		if strings.EqualFold(path.Ext(p), ".dll") {
+			dllPaths[strings.ToLower(path.Base(p))] = p
+		}
+	}
+
+	accounted := map[string]bool{}
+	for _, f := range installed {
+		if f.Status != InstallStatusInstalled {
+			continue
+		}
+
+		if strings.HasSuffix(strings.ToLower(f.Prefix), ".zip") {
+			for _, dll := range f.DLLs {
+				p, ok := dllPaths[strings.ToLower(dll)]
+				if !ok {
+					drift.Missing = append(drift.Missing, fmt.Sprintf("%s (%s)", f.Name, dll))
+					continue
+				}
+				accounted[p] = true
+			}
+			continue
+		}
+
+		expected := path.Join(f.Destination, path.Base(f.Prefix))
+		checksum, ok := scanned[expected]
+		if !ok {
+			drift.Missing = append(drift.Missing, expected)
+			continue
+		}
+
+		accounted[expected] = true
+		if f.Checksum != "" && !strings.Contains(f.Checksum, "-") && !strings.EqualFold(f.Checksum, checksum) {
+			drift.Changed = append(drift.Changed, expected)
+		}
+	}
+
+	for _, p := range dllPaths {
+		if !accounted[p] {
+			drift.Unexpected = append(drift.Unexpected, p)
+		}
+	}
+	sort.Strings(drift.Unexpected)
+
+	return drift
+}
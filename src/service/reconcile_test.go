@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func TestParseScanOutput(t *testing.T) {
+	out := "d41d8cd98f00b204e9800998ecf8427e  /valheim/BepInEx/plugins/Jotunn.dll\n" +
+		"not a checksum line\n" +
+		"0cc175b9c0f1b6a831c399e269772661  /valheim/BepInEx/config/jotunn.cfg\n"
+
+	files := ParseScanOutput(out)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "0cc175b9c0f1b6a831c399e269772661", files["/valheim/BepInEx/config/jotunn.cfg"])
+}
+
+func TestComputeDrift(t *testing.T) {
+	installed := []InstalledFile{
+		{Prefix: "mods/general/ValheimModding-Jotunn.zip", Name: "Jotunn", DLLs: []string{"Jotunn.dll"}, Status: InstallStatusInstalled},
+		{Prefix: "mods/123/EpicLoot.zip", Name: "EpicLoot", DLLs: []string{"EpicLoot.dll"}, Status: InstallStatusInstalled},
+		{Prefix: "config/123/jotunn.cfg", Destination: "/valheim/BepInEx/config", Checksum: "0cc175b9c0f1b6a831c399e269772661", Status: InstallStatusInstalled},
+		{Prefix: "config/123/pending.cfg", Destination: "/valheim/BepInEx/config", Status: InstallStatusPending},
+	}
+
+	scanned := map[string]string{
+		"/valheim/BepInEx/plugins/Jotunn/Jotunn.dll": "d41d8cd98f00b204e9800998ecf8427e",
+		"/valheim/BepInEx/plugins/Unknown.dll":       "d41d8cd98f00b204e9800998ecf8427e",
+		"/valheim/BepInEx/config/jotunn.cfg":         "92eb5ffee6ae2fec3ad71c777531578f",
+	}
+
+	drift := ComputeDrift(installed, scanned)
+	assert.True(t, drift.HasDrift())
+	assert.Equal(t, []string{"EpicLoot (EpicLoot.dll)"}, drift.Missing)
+	assert.Equal(t, []string{"/valheim/BepInEx/config/jotunn.cfg"}, drift.Changed)
+	assert.Equal(t, []string{"/valheim/BepInEx/plugins/Unknown.dll"}, drift.Unexpected)
+}
+
+func TestReconcileOperationFailure(t *testing.T) {
+	o := MakeOperationService(nil, &KubernetesServiceImpl{Client: fake.NewSimpleClientset()}, nil)
+	op := &Operation{Type: OperationTypeReconcile, JobName: "mod-reconcile-123-abc", Status: OperationFailed, Message: "container main exited with code 1"}
+
+	_, err := o.scanDrift(op)
+	assert.EqualError(t, err, "reconcile job mod-reconcile-123-abc failed: container main exited with code 1")
+
+	_, err = o.Retry(context.Background(), op)
+	assert.ErrorContains(t, err, "reconcile operations cannot be retried")
+}
@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+const (
+	RolloutRunning   = "RUNNING"
+	RolloutSucceeded = "SUCCEEDED"
+	RolloutHalted    = "HALTED"
+	RolloutCancelled = "CANCELLED"
+
+	RolloutTargetPending   = "PENDING"
+	RolloutTargetUpgrading = "UPGRADING"
+	RolloutTargetSucceeded = "SUCCEEDED"
+	RolloutTargetFailed    = "FAILED"
+	RolloutTargetSkipped   = "SKIPPED"
+
+	DefaultRolloutConcurrency      = 5
+	MaxRolloutConcurrency          = 50
+	DefaultRolloutFailureThreshold = 0.2
+
+	// MinRolloutFailureSample is the number of upgrades which must finish before the failure rate is compared with the
+	// threshold so a single early failure does not halt a large rollout.
+	MinRolloutFailureSample = 5
+)
+
+// ErrRolloutRunning is returned when a rollout is created while another is still running.
+var ErrRolloutRunning = errors.New("a rollout is already running")
+
+// Rollout upgrades the images of every tenant server. Servers are upgraded a few at a time and the rollout halts when too
+// many upgrades fail.
+type Rollout struct {
+	ID                   uint   `gorm:"primaryKey" json:"id"`
+	ValheimVersion       string `gorm:"column:valheim_version" json:"valheim_version"`
+	BackupManagerVersion string `gorm:"column:backup_manager_version" json:"backup_manager_version"`
+
+	// Concurrency is the number of servers upgraded at the same time
+	Concurrency int `gorm:"column:concurrency" json:"concurrency"`
+
+	// FailureThreshold is the fraction of finished upgrades which may fail before the rollout halts
+	FailureThreshold float64 `gorm:"column:failure_threshold" json:"failure_threshold"`
+
+	Status     string          `gorm:"column:status;index" json:"status"`
+	Message    string          `gorm:"column:message;type:text" json:"message,omitempty"`
+	CreatedBy  string          `gorm:"column:created_by" json:"created_by"`
+	Total      int             `gorm:"column:total" json:"total"`
+	Succeeded  int             `gorm:"column:succeeded" json:"succeeded"`
+	Failed     int             `gorm:"column:failed" json:"failed"`
+	Skipped    int             `gorm:"column:skipped" json:"skipped"`
+	Upgrading  int             `gorm:"column:upgrading" json:"upgrading"`
+	CreatedAt  time.Time       `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt  time.Time       `gorm:"column:updated_at" json:"updated_at"`
+	FinishedAt *time.Time      `gorm:"column:finished_at" json:"finished_at"`
+	Targets    []RolloutTarget `gorm:"foreignKey:RolloutID;constraint:OnDelete:CASCADE" json:"targets,omitempty"`
+}
+
+func (Rollout) TableName() string {
+	return "rollouts"
+}
+
+// RolloutTarget is a single server being upgraded by a rollout.
+type RolloutTarget struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	RolloutID   uint       `gorm:"column:rollout_id;index" json:"rollout_id"`
+	ServerID    uint       `gorm:"column:server_id" json:"server_id"`
+	Status      string     `gorm:"column:status" json:"status"`
+	Reason      string     `gorm:"column:reason;type:text" json:"reason,omitempty"`
+	OperationID *uint      `gorm:"column:operation_id" json:"operation_id,omitempty"`
+	Backups     []string   `gorm:"column:backups;serializer:json" json:"backups,omitempty"`
+	StartedAt   *time.Time `gorm:"column:started_at" json:"started_at"`
+	FinishedAt  *time.Time `gorm:"column:finished_at" json:"finished_at"`
+}
+
+func (RolloutTarget) TableName() string {
+	return "rollout_targets"
+}
+
+// Finished Returns true once a rollout will not upgrade any more servers.
+func (r *Rollout) Finished() bool {
+	return r.Status != RolloutRunning
+}
+
+// FailureRate Returns the fraction of finished upgrades which failed. Skipped servers are not counted.
+func (r *Rollout) FailureRate() float64 {
+	finished := r.Succeeded + r.Failed
+	if finished == 0 {
+		return 0
+	}
+	return float64(r.Failed) / float64(finished)
+}
+
+// ExceedsFailureThreshold Returns true when more upgrades have failed than the rollout allows. The failure rate is only used
+// once MinRolloutFailureSample upgrades have finished, unless the failures already exceed the threshold of every server in the
+// rollout. A threshold of 0 halts on the first failure.
+func (r *Rollout) ExceedsFailureThreshold() bool {
+	if r.Failed == 0 {
+		return false
+	}
+	if r.FailureThreshold <= 0 {
+		return true
+	}
+
+	// The rollout would fail too many upgrades even if every remaining upgrade succeeded
+	if eligible := r.Total - r.Skipped; eligible > 0 && float64(r.Failed)/float64(eligible) > r.FailureThreshold {
+		return true
+	}
+
+	if r.Succeeded+r.Failed < MinRolloutFailureSample {
+		return false
+	}
+	return r.FailureRate() > r.FailureThreshold
+}
+
+// count Updates the progress of a rollout from the status of its targets.
+func (r *Rollout) count(targets []RolloutTarget) {
+	r.Total, r.Succeeded, r.Failed, r.Skipped, r.Upgrading = len(targets), 0, 0, 0, 0
+	for _, t := range targets {
+		switch t.Status {
+		case RolloutTargetSucceeded:
+			r.Succeeded++
+		case RolloutTargetFailed:
+			r.Failed++
+		case RolloutTargetSkipped:
+			r.Skipped++
+		case RolloutTargetUpgrading:
+			r.Upgrading++
+		}
+	}
+}
+
+// PlayerCounter Returns the number of players online on a server.
+type PlayerCounter func(ctx context.Context, user *model.User, server *model.Server) (int, error)
+
+// RolloutService Creates rollouts and runs the orchestrator which moves them through the fleet.
+type RolloutService struct {
+	db          *gorm.DB
+	kubeService KubernetesService
+	s3Service   *S3Service
+	operations  *OperationService
+	Players     PlayerCounter
+}
+
+func MakeRolloutService(db *gorm.DB, kubeService KubernetesService, s3Service *S3Service, operations *OperationService) *RolloutService {
+	r := &RolloutService{
+		db:          db,
+		kubeService: kubeService,
+		s3Service:   s3Service,
+		operations:  operations,
+	}
+	r.Players = r.countPlayers
+	return r
+}
+
+// Create Starts a rollout of the image versions to every server. Rollouts cannot overlap since a server may only run one
+// upgrade at a time.
+func (r *RolloutService) Create(rollout *Rollout) error {
+	var running int64
+	if err := r.db.Model(&Rollout{}).Where("status = ?", RolloutRunning).Count(&running).Error; err != nil {
+		return fmt.Errorf("failed to check for running rollouts: %v", err)
+	}
+	if running > 0 {
+		return ErrRolloutRunning
+	}
+
+	var serverIds []uint
+	if err := r.db.Model(&model.Server{}).Order("id ASC").Pluck("id", &serverIds).Error; err != nil {
+		return fmt.Errorf("failed to list servers: %v", err)
+	}
+
+	rollout.Status = RolloutRunning
+	rollout.Targets = make([]RolloutTarget, 0, len(serverIds))
+	for _, id := range serverIds {
+		rollout.Targets = append(rollout.Targets, RolloutTarget{ServerID: id, Status: RolloutTargetPending})
+	}
+	rollout.count(rollout.Targets)
+
+	if err := r.db.Create(rollout).Error; err != nil {
+		return fmt.Errorf("failed to create rollout: %v", err)
+	}
+
+	log.Infof("rollout %d created by %s: valheim %s, backup manager %s across %d servers", rollout.ID, rollout.CreatedBy,
+		rollout.ValheimVersion, rollout.BackupManagerVersion, rollout.Total)
+	return nil
+}
+
+// List Returns every rollout without its targets, newest first.
+func (r *RolloutService) List() ([]Rollout, error) {
+	var rollouts []Rollout
+	if err := r.db.Order("id DESC").Find(&rollouts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list rollouts: %v", err)
+	}
+	return rollouts, nil
+}
+
+// Get Returns a rollout along with the progress of each of its servers.
+func (r *RolloutService) Get(id uint) (*Rollout, error) {
+	var rollout Rollout
+	err := r.db.Preload("Targets", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).First(&rollout, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// Cancel Stops a running rollout from upgrading any more servers. Upgrades which already started are left to finish.
+func (r *RolloutService) Cancel(rollout *Rollout, message string) error {
+	if rollout.Finished() {
+		return fmt.Errorf("rollout is already %s", rollout.Status)
+	}
+	return r.finish(rollout, RolloutCancelled, message)
+}
+
+// Run Syncs every running rollout on each interval until the context is cancelled. Rollouts are read from the database on
+// each pass so a rollout continues when the API restarts.
+func (r *RolloutService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var rollouts []Rollout
+			if err := r.db.Preload("Targets").Where("status = ?", RolloutRunning).Find(&rollouts).Error; err != nil {
+				log.Errorf("failed to list running rollouts: %v", err)
+				continue
+			}
+
+			for i := range rollouts {
+				if err := r.Sync(ctx, &rollouts[i]); err != nil {
+					log.Errorf("failed to sync rollout %d: %v", rollouts[i].ID, err)
+				}
+			}
+		}
+	}
+}
+
+// Sync Records the outcome of finished upgrades, halts the rollout when the failure rate exceeds its threshold, and otherwise
+// starts upgrading pending servers until the concurrency of the rollout is reached.
+func (r *RolloutService) Sync(ctx context.Context, rollout *Rollout) error {
+	for i := range rollout.Targets {
+		target := &rollout.Targets[i]
+		if target.Status != RolloutTargetUpgrading || target.OperationID == nil {
+			continue
+		}
+
+		op, err := r.operations.Get(*target.OperationID)
+		if err != nil {
+			log.Errorf("failed to get upgrade operation %d of rollout %d: %v", *target.OperationID, rollout.ID, err)
+			continue
+		}
+		if !op.Finished() {
+			continue
+		}
+
+		status := RolloutTargetSucceeded
+		if op.Status == OperationFailed {
+			status = RolloutTargetFailed
+		}
+		if err = r.finishTarget(target, status, op.Message); err != nil {
+			return err
+		}
+	}
+
+	rollout.count(rollout.Targets)
+	if rollout.ExceedsFailureThreshold() {
+		return r.finish(rollout, RolloutHalted, fmt.Sprintf("halted after %d of %d upgrades failed (%.0f%% exceeds the %.0f%% threshold)",
+			rollout.Failed, rollout.Succeeded+rollout.Failed, rollout.FailureRate()*100, rollout.FailureThreshold*100))
+	}
+
+	for i := range rollout.Targets {
+		if rollout.Upgrading >= rollout.Concurrency {
+			break
+		}
+
+		target := &rollout.Targets[i]
+		if target.Status != RolloutTargetPending {
+			continue
+		}
+
+		if err := r.startTarget(ctx, rollout, target); err != nil {
+			return err
+		}
+		rollout.count(rollout.Targets)
+	}
+
+	if rollout.Upgrading == 0 && rollout.Succeeded+rollout.Failed+rollout.Skipped == rollout.Total {
+		return r.finish(rollout, RolloutSucceeded, "")
+	}
+
+	// The rollout may have been cancelled while this pass ran so only its progress is written
+	return r.db.Model(&Rollout{}).Where("id = ? AND status = ?", rollout.ID, RolloutRunning).Updates(map[string]interface{}{
+		"total":     rollout.Total,
+		"succeeded": rollout.Succeeded,
+		"failed":    rollout.Failed,
+		"skipped":   rollout.Skipped,
+		"upgrading": rollout.Upgrading,
+	}).Error
+}
+
+// startTarget Starts the upgrade of a single server. Servers with players online, servers on another game branch, servers
+// already running the rollout's versions, and servers which are already being upgraded are skipped.
+func (r *RolloutService) startTarget(ctx context.Context, rollout *Rollout, target *RolloutTarget) error {
+	var server model.Server
+	if err := r.db.Preload("User").Preload("WorldDetails").First(&server, target.ServerID).Error; err != nil {
+		return r.finishTarget(target, RolloutTargetSkipped, "server no longer exists")
+	}
+	user := &server.User
+
+	if active, err := r.operations.FindActive(server.ID, OperationTypeUpgrade); err != nil {
+		return err
+	} else if active != nil {
+		return r.finishTarget(target, RolloutTargetSkipped, fmt.Sprintf("upgrade %d is already in progress", active.ID))
+	}
+
+	clientset := r.kubeService.GetClient()
+	deploymentName := ServerDeploymentName(&server, user.DiscordID)
+	current, err := CurrentServerImage(ctx, r.db, clientset, &server, deploymentName)
+	if err != nil {
+		return r.finishTarget(target, RolloutTargetFailed, err.Error())
+	}
+
+	if branch := ImageBranch(current.ValheimVersion); branch != ImageBranch(rollout.ValheimVersion) {
+		return r.finishTarget(target, RolloutTargetSkipped, fmt.Sprintf("server is on the %s branch", branch))
+	}
+
+	desired := &ServerImage{ValheimVersion: rollout.ValheimVersion, BackupManagerVersion: rollout.BackupManagerVersion}
+	if current.ValheimVersion == desired.ValheimVersion && current.BackupManagerVersion == desired.BackupManagerVersion {
+		return r.finishTarget(target, RolloutTargetSkipped, "already running the rollout versions")
+	}
+
+	players, err := r.Players(ctx, user, &server)
+	if err != nil {
+		return r.finishTarget(target, RolloutTargetSkipped, fmt.Sprintf("could not determine online players: %v", err))
+	}
+	if players > 0 {
+		return r.finishTarget(target, RolloutTargetSkipped, fmt.Sprintf("%d players online", players))
+	}
+
+	now := time.Now()
+	target.StartedAt = &now
+	op, backups, err := r.operations.StartServerUpgrade(ctx, r.s3Service, user, nil, &server, current, desired)
+	target.Backups = backups
+	if err != nil {
+		return r.finishTarget(target, RolloutTargetFailed, err.Error())
+	}
+
+	target.Status = RolloutTargetUpgrading
+	target.OperationID = &op.ID
+	return r.db.Save(target).Error
+}
+
+// countPlayers Queries the running pod of a server for its players. Stopped servers have no players.
+func (r *RolloutService) countPlayers(ctx context.Context, user *model.User, server *model.Server) (int, error) {
+	pods, err := r.kubeService.GetClient().CoreV1().Pods(Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app=valheim,tenant-discord-id=%s", user.DiscordID),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.Status.PodIP != "" {
+			return QueryPlayerCount(ctx, pod.Status.PodIP, server.ServerPort)
+		}
+	}
+	return 0, nil
+}
+
+func (r *RolloutService) finishTarget(target *RolloutTarget, status, reason string) error {
+	now := time.Now()
+	target.Status = status
+	target.Reason = reason
+	target.FinishedAt = &now
+	return r.db.Save(target).Error
+}
+
+func (r *RolloutService) finish(rollout *Rollout, status, message string) error {
+	now := time.Now()
+	rollout.Status = status
+	rollout.Message = message
+	rollout.FinishedAt = &now
+	if err := r.db.Omit("Targets").Save(rollout).Error; err != nil {
+		return err
+	}
+
+	log.Infof("rollout %d finished as %s: %d succeeded, %d failed, %d skipped of %d servers %s", rollout.ID, status,
+		rollout.Succeeded, rollout.Failed, rollout.Skipped, rollout.Total, message)
+	return nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRolloutFailureThreshold(t *testing.T) {
+	rollout := &Rollout{FailureThreshold: 0.25}
+	rollout.count([]RolloutTarget{
+		{Status: RolloutTargetSucceeded},
+		{Status: RolloutTargetSucceeded},
+		{Status: RolloutTargetSucceeded},
+		{Status: RolloutTargetFailed},
+		{Status: RolloutTargetSkipped},
+		{Status: RolloutTargetUpgrading},
+		{Status: RolloutTargetPending},
+	})
+
+	assert.Equal(t, 7, rollout.Total)
+	assert.Equal(t, 3, rollout.Succeeded)
+	assert.Equal(t, 1, rollout.Failed)
+	assert.Equal(t, 1, rollout.Skipped)
+	assert.Equal(t, 1, rollout.Upgrading)
+
+	// Skipped servers do not count towards the failure rate
+	assert.Equal(t, 0.25, rollout.FailureRate())
+	assert.False(t, rollout.ExceedsFailureThreshold())
+
+	rollout.Failed++
+	assert.True(t, rollout.ExceedsFailureThreshold())
+
+	// A threshold of 0 halts on the first failure
+	assert.True(t, (&Rollout{Failed: 1, Succeeded: 10}).ExceedsFailureThreshold())
+	assert.False(t, (&Rollout{Succeeded: 10}).ExceedsFailureThreshold())
+}
+
+func TestRolloutFailureThresholdMinimumSample(t *testing.T) {
+	// A single failure among the first upgrades of a large rollout does not halt it
+	assert.False(t, (&Rollout{FailureThreshold: 0.2, Total: 100, Failed: 1}).ExceedsFailureThreshold())
+	assert.False(t, (&Rollout{FailureThreshold: 0.2, Total: 100, Failed: 2, Succeeded: 2}).ExceedsFailureThreshold())
+
+	// Once enough upgrades finished the failure rate is compared with the threshold
+	assert.False(t, (&Rollout{FailureThreshold: 0.2, Total: 100, Failed: 1, Succeeded: 4}).ExceedsFailureThreshold())
+	assert.True(t, (&Rollout{FailureThreshold: 0.2, Total: 100, Failed: 2, Succeeded: 3}).ExceedsFailureThreshold())
+
+	// Small rollouts halt as soon as the failures exceed the threshold of every server
+	assert.False(t, (&Rollout{FailureThreshold: 0.5, Total: 3, Failed: 1}).ExceedsFailureThreshold())
+	assert.True(t, (&Rollout{FailureThreshold: 0.5, Total: 3, Failed: 2}).ExceedsFailureThreshold())
+	assert.True(t, (&Rollout{FailureThreshold: 0.2, Total: 4, Skipped: 1, Failed: 1}).ExceedsFailureThreshold())
+}
+
+func TestIsAdmin(t *testing.T) {
+	t.Setenv("ADMIN_DISCORD_IDS", "123, 456")
+	assert.True(t, IsAdmin(nil, "123"))
+	assert.True(t, IsAdmin(nil, "456"))
+	assert.False(t, IsAdmin(nil, "789"))
+	assert.False(t, IsAdmin(nil, ""))
+}
+
+func TestImpersonationAllowed(t *testing.T) {
+	assert.True(t, ImpersonationAllowed("GET", "/api/v1/server/"))
+	assert.True(t, ImpersonationAllowed("GET", "/api/v1/servers/:id/mods"))
+	assert.False(t, ImpersonationAllowed("POST", "/api/v1/server/"))
+	assert.False(t, ImpersonationAllowed("GET", "/api/v1/stripe/create-checkout-session"))
+	assert.False(t, ImpersonationAllowed("GET", "/api/v1/stripe/create-billing-session"))
+	assert.False(t, ImpersonationAllowed("GET", "/api/v1/keys"))
+	assert.False(t, ImpersonationAllowed("GET", "/api/v1/admin/users"))
+	assert.False(t, ImpersonationAllowed("GET", ""))
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -8,7 +9,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	log "github.com/sirupsen/logrus"
+	"io"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -18,8 +22,11 @@ type S3Service struct {
 }
 
 type SimpleS3Object struct {
-	Key  string `json:"key"`
-	Size int64  `json:"fileSize"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"fileSize"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+	Category     string    `json:"category,omitempty"`
 }
 
 // MakeS3Service creates a new instance of S3Service
@@ -73,15 +80,18 @@ func (s *S3Service) ListObjects(prefix string) ([]SimpleS3Object, error) {
 
 		page, err := p.NextPage(context.TODO())
 		if err != nil {
-			log.Fatalf("failed to get page %v, %v", i, err)
+			log.Errorf("failed to get page %v for prefix: %s, %v", i, prefix, err)
+			return nil, fmt.Errorf("failed to list objects page %d: %v", i, err)
 		}
 
 		for _, obj := range page.Contents {
 			// Ensures we don't get the root object which is the same as the given prefix.
 			if *obj.Key != prefix {
 				objects = append(objects, SimpleS3Object{
-					Key:  *obj.Key,
-					Size: *obj.Size,
+					Key:          *obj.Key,
+					Size:         aws.ToInt64(obj.Size),
+					ETag:         strings.Trim(aws.ToString(obj.ETag), "\""),
+					LastModified: aws.ToTime(obj.LastModified),
 				})
 			}
 		}
@@ -90,6 +100,135 @@ func (s *S3Service) ListObjects(prefix string) ([]SimpleS3Object, error) {
 	return objects, nil
 }
 
+// ListObjectsAfter lists objects under a prefix in key order starting after the given key and stops once limit objects
+// which satisfy keep have been found. S3 continuation tokens are used so only the pages needed are read.
+func (s *S3Service) ListObjectsAfter(ctx context.Context, prefix, startAfter string, limit int, keep func(SimpleS3Object) bool) ([]SimpleS3Object, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(int32(min(limit, 1000))),
+	}
+	if startAfter != "" {
+		input.StartAfter = aws.String(startAfter)
+	}
+
+	var objects []SimpleS3Object
+	p := s3.NewListObjectsV2Paginator(s.client, input)
+	for p.HasMorePages() && len(objects) < limit {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects for prefix %s: %v", prefix, err)
+		}
+
+		for _, obj := range page.Contents {
+			if *obj.Key == prefix {
+				continue
+			}
+
+			o := SimpleS3Object{
+				Key:          *obj.Key,
+				Size:         aws.ToInt64(obj.Size),
+				ETag:         strings.Trim(aws.ToString(obj.ETag), "\""),
+				LastModified: aws.ToTime(obj.LastModified),
+			}
+			if keep != nil && !keep(o) {
+				continue
+			}
+
+			objects = append(objects, o)
+			if len(objects) == limit {
+				break
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// HeadObject returns the size of an object in S3 without downloading its contents. This is used to verify that a presigned
+// upload actually completed before any further processing happens on the object.
+func (s *S3Service) HeadObject(ctx context.Context, key string) (int64, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to head object: %v", err)
+	}
+
+	return aws.ToInt64(out.ContentLength), nil
+}
+
+// StatObject returns the metadata of an object in S3 without downloading its contents.
+func (s *S3Service) StatObject(ctx context.Context, key string) (*SimpleS3Object, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to head object: %v", err)
+	}
+
+	return &SimpleS3Object{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ETag:         strings.Trim(aws.ToString(out.ETag), "\""),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// GetObject downloads an object from S3 reading at most maxBytes of its contents.
+func (s *S3Service) GetObject(ctx context.Context, key string, maxBytes int64) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %v", err)
+	}
+	defer out.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(out.Body, maxBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object body: %v", err)
+	}
+
+	return body, nil
+}
+
+// MoveObject copies an object to a new key in the same bucket and removes the original.
+func (s *S3Service) MoveObject(ctx context.Context, srcKey, destKey string) error {
+	if err := s.CopyObject(ctx, srcKey, destKey); err != nil {
+		return err
+	}
+
+	return s.DeleteObject(ctx, srcKey)
+}
+
+// CopyObject copies an object to a new key in the same bucket.
+func (s *S3Service) CopyObject(ctx context.Context, srcKey, destKey string) error {
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		CopySource: aws.String(copySource(s.bucket, srcKey)),
+		Key:        aws.String(destKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy object: %v", err)
+	}
+	return nil
+}
+
+// copySource Returns the CopySource of an object, which must be URL encoded so keys with spaces, "+", "%", or non-ASCII
+// characters can be copied. Each segment is escaped separately so the "/" separators are kept, and "+" is escaped too since
+// S3 would decode it as a space.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segments[i]), "+", "%2B")
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
 // UploadObject publishes an object to S3 under the given prefix
 func (s *S3Service) UploadObject(ctx context.Context, key string) (*s3.PutObjectOutput, error) {
 	input := &s3.PutObjectInput{
@@ -105,6 +244,22 @@ func (s *S3Service) UploadObject(ctx context.Context, key string) (*s3.PutObject
 	return result, nil
 }
 
+// PutObject uploads the given contents to S3 under the key
+func (s *S3Service) PutObject(ctx context.Context, key string, body []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object: %v", err)
+	}
+
+	return nil
+}
+
 // DeleteObject deletes an object from S3
 func (s *S3Service) DeleteObject(ctx context.Context, key string) error {
 	input := &s3.DeleteObjectInput{
@@ -0,0 +1,12 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCopySource(t *testing.T) {
+	assert.Equal(t, "bucket/mods/123/Foo.zip", copySource("bucket", "mods/123/Foo.zip"))
+	assert.Equal(t, "bucket/mods/123/My%20Mod%2B1%25.zip", copySource("bucket", "mods/123/My Mod+1%.zip"))
+	assert.Equal(t, "bucket/config/123/%C3%BCber.cfg", copySource("bucket", "config/123/über.cfg"))
+}
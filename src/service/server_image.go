@@ -0,0 +1,497 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ValheimContainerName       = "valheim"
+	BackupManagerContainerName = "backup-manager"
+
+	// UpgradeReadyTimeout is how long an upgraded server has to pass its readiness probe before the upgrade is rolled back.
+	// The readiness probe itself gives the server just over 4 minutes to start.
+	UpgradeReadyTimeout = 10 * time.Minute
+
+	// imageTagsTTL is how long the tags of an image repository are cached before they are listed again.
+	imageTagsTTL = 15 * time.Minute
+
+	// maxImageTagPages is the number of pages of tags read from the registry for each repository.
+	maxImageTagPages = 5
+
+	BranchStable     = "stable"
+	BranchPublicTest = "public-test"
+
+	// publicTestTagSuffix marks Valheim images built from the public-test branch of the game i.e. 0.0.11-public-test
+	publicTestTagSuffix = "-" + BranchPublicTest
+)
+
+// Branches are the Valheim game branches a server can run.
+var Branches = []string{BranchStable, BranchPublicTest}
+
+// releaseTagPattern matches the tags of released images on either branch. Tags such as latest or development builds are not
+// offered to users.
+var releaseTagPattern = regexp.MustCompile(`^v?\d+(\.\d+)*(-public-test)?$`)
+
+// ServerImage is the versions of the images a server is pinned to. New servers are pinned to the versions the API is
+// configured with and only change versions when they are upgraded.
+type ServerImage struct {
+	ID             uint   `gorm:"primaryKey" json:"-"`
+	ServerID       uint   `gorm:"column:server_id;uniqueIndex" json:"server_id"`
+	ValheimVersion string `gorm:"column:valheim_version" json:"valheim_version"`
+
+	// Branch is the game branch of the Valheim image, it is derived from the Valheim version when the image is saved
+	Branch                       string     `gorm:"column:branch" json:"branch"`
+	BackupManagerVersion         string     `gorm:"column:backup_manager_version" json:"backup_manager_version"`
+	PreviousValheimVersion       string     `gorm:"column:previous_valheim_version" json:"previous_valheim_version,omitempty"`
+	PreviousBackupManagerVersion string     `gorm:"column:previous_backup_manager_version" json:"previous_backup_manager_version,omitempty"`
+	UpgradedAt                   *time.Time `gorm:"column:upgraded_at" json:"upgraded_at,omitempty"`
+	CreatedAt                    time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt                    time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (ServerImage) TableName() string {
+	return "server_images"
+}
+
+// DefaultServerImage Returns the image versions new servers are created with.
+func DefaultServerImage(serverId uint) *ServerImage {
+	return &ServerImage{
+		ServerID:             serverId,
+		ValheimVersion:       os.Getenv("VALHEIM_IMAGE_VERSION"),
+		Branch:               ImageBranch(os.Getenv("VALHEIM_IMAGE_VERSION")),
+		BackupManagerVersion: os.Getenv("BACKUP_MANAGER_IMAGE_VERSION"),
+	}
+}
+
+// ImageBranch Returns the game branch a Valheim image tag was built from.
+func ImageBranch(tag string) string {
+	if strings.HasSuffix(tag, publicTestTagSuffix) {
+		return BranchPublicTest
+	}
+	return BranchStable
+}
+
+// ValidateBranch Checks that a branch is one of the game branches servers can run.
+func ValidateBranch(branch string) error {
+	for _, b := range Branches {
+		if b == branch {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid branch: \"%s\" valid branches are: \"%v\"", branch, Branches)
+}
+
+// ValheimImage Returns the Valheim server image for a version.
+func ValheimImage(version string) string {
+	return fmt.Sprintf("%s:%s", os.Getenv("VALHEIM_IMAGE_NAME"), version)
+}
+
+// BackupManagerImage Returns the backup manager sidecar image for a version.
+func BackupManagerImage(version string) string {
+	return fmt.Sprintf("%s:%s", os.Getenv("BACKUP_MANAGER_IMAGE_NAME"), version)
+}
+
+// Images Returns the image of each container in the server deployment keyed by container name.
+func (s *ServerImage) Images() map[string]string {
+	return map[string]string{
+		ValheimContainerName:       ValheimImage(s.ValheimVersion),
+		BackupManagerContainerName: BackupManagerImage(s.BackupManagerVersion),
+	}
+}
+
+// GetServerImage Returns the image versions a server is pinned to or nil when the server was created before versions were
+// recorded.
+func GetServerImage(db *gorm.DB, serverId uint) (*ServerImage, error) {
+	var images []ServerImage
+	if err := db.Where("server_id = ?", serverId).Limit(1).Find(&images).Error; err != nil || len(images) == 0 {
+		return nil, err
+	}
+	return &images[0], nil
+}
+
+// SaveServerImage Creates or replaces the image versions a server is pinned to.
+func SaveServerImage(db *gorm.DB, image *ServerImage) error {
+	image.Branch = ImageBranch(image.ValheimVersion)
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "server_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"valheim_version", "branch", "backup_manager_version", "previous_valheim_version", "previous_backup_manager_version", "upgraded_at", "updated_at"}),
+	}).Create(image).Error
+	if err != nil {
+		return fmt.Errorf("failed to save server image: %v", err)
+	}
+	return nil
+}
+
+// DeploymentServerImage Reads the image versions a deployment is running. This is used for servers which were created before
+// their versions were recorded.
+func DeploymentServerImage(deployment *appsv1.Deployment, serverId uint) *ServerImage {
+	image := DefaultServerImage(serverId)
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		_, version, found := strings.Cut(container.Image[strings.LastIndex(container.Image, "/")+1:], ":")
+		if !found {
+			continue
+		}
+		switch container.Name {
+		case ValheimContainerName:
+			image.ValheimVersion = version
+			image.Branch = ImageBranch(version)
+		case BackupManagerContainerName:
+			image.BackupManagerVersion = version
+		}
+	}
+	return image
+}
+
+// SetDeploymentImages Sets the image of containers in a deployment. Changing an image rolls out new pods with the
+// deployment's recreate strategy.
+func SetDeploymentImages(ctx context.Context, clientset kubernetes.Interface, name string, images map[string]string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := clientset.AppsV1().Deployments(Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		for i, container := range deployment.Spec.Template.Spec.Containers {
+			if image, ok := images[container.Name]; ok {
+				deployment.Spec.Template.Spec.Containers[i].Image = image
+			}
+		}
+
+		_, err = clientset.AppsV1().Deployments(Namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// ServerDeploymentName Returns the name of the deployment running a server.
+func ServerDeploymentName(server *model.Server, discordId string) string {
+	if server.DeploymentName != "" {
+		return server.DeploymentName
+	}
+	return fmt.Sprintf("valheim-%s", discordId)
+}
+
+// CurrentServerImage Returns the image versions a server is pinned to, reading them from its deployment when the server was
+// created before versions were recorded.
+func CurrentServerImage(ctx context.Context, db *gorm.DB, clientset kubernetes.Interface, server *model.Server, deploymentName string) (*ServerImage, error) {
+	current, err := GetServerImage(db, server.ID)
+	if err != nil || current != nil {
+		return current, err
+	}
+
+	deployment, err := clientset.AppsV1().Deployments(Namespace).Get(ctx, deploymentName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s: %v", deploymentName, err)
+	}
+	return DeploymentServerImage(deployment, server.ID), nil
+}
+
+// BackupWorld Copies the world files of a server to a new backup in S3 and returns the keys of the backup. Worlds which have
+// not been saved yet have nothing to back up.
+//
+// The copy is taken from the world files in S3 rather than the server's PVC, so it is the last save the backup manager
+// uploaded, which runs every BACKUP_FREQUENCY_MIN minutes. Progress made in game after that upload is not in the backup but
+// is kept on the PVC, which an upgrade does not modify.
+func BackupWorld(ctx context.Context, db *gorm.DB, s3Service *S3Service, user *model.User, world string) ([]string, error) {
+	backups := []string{}
+	timestamp := time.Now().Unix()
+
+	for _, ext := range []string{".fwl", ".db"} {
+		key := fmt.Sprintf("valheim-backups-auto/%s/%s%s", user.DiscordID, world, ext)
+		obj, err := s3Service.StatObject(ctx, key)
+		if err != nil {
+			continue
+		}
+
+		backup := fmt.Sprintf("valheim-backups-auto/%s/%s_backup_upgrade-%d%s", user.DiscordID, world, timestamp, ext)
+		if err = s3Service.CopyObject(ctx, key, backup); err != nil {
+			return nil, err
+		}
+
+		if err = AddStorageUsage(db, user.ID, backup, obj.Size); err != nil {
+			log.Errorf("failed to update storage usage for %s: %v", backup, err)
+		}
+		backups = append(backups, backup)
+	}
+
+	return backups, nil
+}
+
+// StartServerUpgrade Backs up the world of a server, patches its deployment to the target image versions, and creates the
+// upgrade operation which follows the rollout. The server is put back on its current versions when the operation cannot be
+// created since nothing would roll it back otherwise. The actor is the user who requested the upgrade and is nil for rollouts.
+func (o *OperationService) StartServerUpgrade(ctx context.Context, s3Service *S3Service, user, actor *model.User, server *model.Server, current, target *ServerImage) (*Operation, []string, error) {
+	clientset := o.kubeService.GetClient()
+	deploymentName := ServerDeploymentName(server, user.DiscordID)
+
+	backups, err := BackupWorld(ctx, o.db, s3Service, user, server.WorldDetails.World)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to back up world: %v", err)
+	}
+
+	if err = SetDeploymentImages(ctx, clientset, deploymentName, target.Images()); err != nil {
+		return nil, backups, fmt.Errorf("failed to update server images: %v", err)
+	}
+
+	now := time.Now()
+	target.ServerID = server.ID
+	target.PreviousValheimVersion = current.ValheimVersion
+	target.PreviousBackupManagerVersion = current.BackupManagerVersion
+	target.UpgradedAt = &now
+	if err = SaveServerImage(o.db, target); err != nil {
+		log.Errorf("failed to record image versions for server %d: %v", server.ID, err)
+	}
+
+	op := &Operation{
+		UserID:    user.ID,
+		DiscordID: user.DiscordID,
+		ServerID:  server.ID,
+		Type:      OperationTypeUpgrade,
+		Target:    fmt.Sprintf("valheim %s, backup manager %s", target.ValheimVersion, target.BackupManagerVersion),
+		Metadata: map[string]string{
+			"deployment":                      deploymentName,
+			"previous_valheim_version":        current.ValheimVersion,
+			"previous_backup_manager_version": current.BackupManagerVersion,
+		},
+	}
+	op.SetActor(actor)
+	if err = o.Create(op); err != nil {
+		if restoreErr := SetDeploymentImages(ctx, clientset, deploymentName, current.Images()); restoreErr != nil {
+			log.Errorf("failed to restore images of deployment %s: %v", deploymentName, restoreErr)
+		}
+		if restoreErr := SaveServerImage(o.db, current); restoreErr != nil {
+			log.Errorf("failed to restore image versions for server %d: %v", server.ID, restoreErr)
+		}
+		return nil, backups, err
+	}
+
+	log.Infof("upgrading server %d from valheim %s/backup manager %s to %s/%s", server.ID, current.ValheimVersion,
+		current.BackupManagerVersion, target.ValheimVersion, target.BackupManagerVersion)
+	return op, backups, nil
+}
+
+// DeploymentReady Returns true once every replica of a deployment has been updated to its latest spec and passed its
+// readiness probe.
+func DeploymentReady(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.ReadyReplicas == replicas &&
+		deployment.Status.Replicas == replicas
+}
+
+// syncUpgrade Finishes an upgrade once the upgraded server passes its readiness probe. When the server is not ready within
+// UpgradeReadyTimeout the deployment is rolled back to the images it ran before the upgrade.
+func (o *OperationService) syncUpgrade(ctx context.Context, op *Operation) error {
+	clientset := o.kubeService.GetClient()
+	name := op.Metadata["deployment"]
+
+	deployment, err := clientset.AppsV1().Deployments(Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return o.Finish(op, OperationFailed, fmt.Sprintf("deployment %s no longer exists", name), "")
+		}
+		return err
+	}
+
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0 {
+		return o.Finish(op, OperationSucceeded, "server is stopped, the new images are used when it next starts", "")
+	}
+
+	if DeploymentReady(deployment) {
+		return o.Finish(op, OperationSucceeded, "", "")
+	}
+
+	if time.Since(op.CreatedAt) < UpgradeReadyTimeout {
+		if op.Status == OperationPending {
+			now := time.Now()
+			op.Status = OperationRunning
+			op.StartedAt = &now
+			if err = o.db.Omit("Items").Save(op).Error; err != nil {
+				return err
+			}
+			o.publish(op)
+		}
+		return nil
+	}
+
+	previous := &ServerImage{
+		ServerID:             op.ServerID,
+		ValheimVersion:       op.Metadata["previous_valheim_version"],
+		BackupManagerVersion: op.Metadata["previous_backup_manager_version"],
+	}
+
+	if err = SetDeploymentImages(ctx, clientset, name, previous.Images()); err != nil {
+		return o.Finish(op, OperationFailed, fmt.Sprintf("server was not ready within %s and rolling back failed: %v", UpgradeReadyTimeout, err), "")
+	}
+
+	if err = SaveServerImage(o.db, previous); err != nil {
+		log.Errorf("failed to record rolled back images for server %d: %v", op.ServerID, err)
+	}
+
+	return o.Finish(op, OperationFailed, fmt.Sprintf("server was not ready within %s, rolled back to valheim %s and backup manager %s",
+		UpgradeReadyTimeout, previous.ValheimVersion, previous.BackupManagerVersion), "")
+}
+
+// ImageVersions are the released versions of the images the API deploys for a game branch, newest first, along with the
+// versions new servers on the branch are created with.
+type ImageVersions struct {
+	Branch               string   `json:"branch"`
+	Valheim              []string `json:"valheim"`
+	BackupManager        []string `json:"backup_manager"`
+	DefaultValheim       string   `json:"default_valheim"`
+	DefaultBackupManager string   `json:"default_backup_manager"`
+}
+
+type cachedTags struct {
+	tags      []string
+	fetchedAt time.Time
+}
+
+// ImageService Lists the released versions of the server images from Docker Hub.
+type ImageService struct {
+	baseUrl string
+	Client  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedTags
+}
+
+func MakeImageService() *ImageService {
+	return &ImageService{
+		baseUrl: "https://hub.docker.com/v2",
+		Client:  &http.Client{Timeout: 30 * time.Second},
+		cache:   map[string]cachedTags{},
+	}
+}
+
+// Versions Returns the released versions of the Valheim image for a game branch and of the backup manager image, which is
+// shared by every branch. The configured default versions are always available even when the registry cannot be reached.
+// New servers on a branch other than the configured default's branch are created with the newest image of the branch.
+func (s *ImageService) Versions(ctx context.Context, branch string) *ImageVersions {
+	defaults := DefaultServerImage(0)
+	versions := &ImageVersions{
+		Branch:               branch,
+		Valheim:              s.versions(ctx, os.Getenv("VALHEIM_IMAGE_NAME"), branch, defaults.ValheimVersion),
+		BackupManager:        s.versions(ctx, os.Getenv("BACKUP_MANAGER_IMAGE_NAME"), BranchStable, defaults.BackupManagerVersion),
+		DefaultValheim:       defaults.ValheimVersion,
+		DefaultBackupManager: defaults.BackupManagerVersion,
+	}
+
+	if ImageBranch(versions.DefaultValheim) != branch {
+		versions.DefaultValheim = ""
+		if len(versions.Valheim) > 0 {
+			versions.DefaultValheim = versions.Valheim[0]
+		}
+	}
+	return versions
+}
+
+// versions Returns the tags of a repository on a branch, including the default version when it is on the branch.
+func (s *ImageService) versions(ctx context.Context, repository, branch, defaultVersion string) []string {
+	tags, err := s.Tags(ctx, repository)
+	if err != nil {
+		log.Errorf("failed to list tags for image %s: %v", repository, err)
+	}
+
+	found := false
+	branchTags := []string{}
+	for _, tag := range tags {
+		if ImageBranch(tag) == branch {
+			branchTags = append(branchTags, tag)
+			found = found || tag == defaultVersion
+		}
+	}
+	if !found && defaultVersion != "" && ImageBranch(defaultVersion) == branch {
+		branchTags = append(branchTags, defaultVersion)
+		sortVersionsDesc(branchTags)
+	}
+	return branchTags
+}
+
+// Tags Returns the release tags of an image repository newest first. Tags are cached for imageTagsTTL.
+func (s *ImageService) Tags(ctx context.Context, repository string) ([]string, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[repository]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < imageTagsTTL {
+		return append([]string{}, cached.tags...), nil
+	}
+
+	var tags []string
+	url := fmt.Sprintf("%s/repositories/%s/tags?page_size=100", s.baseUrl, repository)
+	for page := 0; page < maxImageTagPages && url != ""; page++ {
+		var body struct {
+			Next    string `json:"next"`
+			Results []struct {
+				Name string `json:"name"`
+			} `json:"results"`
+		}
+		if err := s.get(ctx, url, &body); err != nil {
+			return nil, err
+		}
+
+		for _, result := range body.Results {
+			if releaseTagPattern.MatchString(result.Name) {
+				tags = append(tags, result.Name)
+			}
+		}
+		url = body.Next
+	}
+
+	sortVersionsDesc(tags)
+
+	s.mu.Lock()
+	s.cache[repository] = cachedTags{tags: tags, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return append([]string{}, tags...), nil
+}
+
+func (s *ImageService) get(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to list image tags: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("failed to list image tags: status %d: %s", res.StatusCode, string(body))
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// sortVersionsDesc Sorts image tags newest first. Tags are compared without their branch suffix.
+func sortVersionsDesc(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return CompareVersions(strings.TrimSuffix(versions[i], publicTestTagSuffix), strings.TrimSuffix(versions[j], publicTestTagSuffix)) > 0
+	})
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestImageServiceTags(t *testing.T) {
+	requests := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/repositories/cbartram/hearthhub/tags", r.URL.Path)
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"next": "", "results": [{"name": "0.0.9"}, {"name": "dev-branch"}]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"next": "%s/repositories/cbartram/hearthhub/tags?page=2", "results": [{"name": "latest"}, {"name": "0.0.10"}, {"name": "0.0.2"}]}`, srv.URL)
+	}))
+	defer srv.Close()
+
+	s := MakeImageService()
+	s.baseUrl = srv.URL
+
+	tags, err := s.Tags(context.Background(), "cbartram/hearthhub")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0.0.10", "0.0.9", "0.0.2"}, tags)
+
+	// Tags are served from the cache until they expire
+	_, err = s.Tags(context.Background(), "cbartram/hearthhub")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestServerImageDeployment(t *testing.T) {
+	t.Setenv("VALHEIM_IMAGE_NAME", "cbartram/hearthhub")
+	t.Setenv("BACKUP_MANAGER_IMAGE_NAME", "cbartram/hearthhub-sidecar")
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "valheim-123", Namespace: Namespace, Generation: 2},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: ValheimContainerName, Image: "cbartram/hearthhub:0.0.9"},
+				{Name: BackupManagerContainerName, Image: "cbartram/hearthhub-sidecar:0.0.40"},
+			}}},
+		},
+	}
+
+	current := DeploymentServerImage(deployment, 1)
+	assert.Equal(t, "0.0.9", current.ValheimVersion)
+	assert.Equal(t, "0.0.40", current.BackupManagerVersion)
+
+	clientset := fake.NewSimpleClientset(deployment)
+	target := &ServerImage{ValheimVersion: "0.0.10", BackupManagerVersion: "0.0.43"}
+	assert.NoError(t, SetDeploymentImages(context.Background(), clientset, "valheim-123", target.Images()))
+
+	updated, err := clientset.AppsV1().Deployments(Namespace).Get(context.Background(), "valheim-123", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "cbartram/hearthhub:0.0.10", updated.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, "cbartram/hearthhub-sidecar:0.0.43", updated.Spec.Template.Spec.Containers[1].Image)
+}
+
+func TestDeploymentReady(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+	deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1}
+	assert.False(t, DeploymentReady(deployment))
+
+	deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 0}
+	assert.False(t, DeploymentReady(deployment))
+
+	deployment.Status.ReadyReplicas = 1
+	assert.True(t, DeploymentReady(deployment))
+}
+
+func TestImageServiceVersionsBranch(t *testing.T) {
+	t.Setenv("VALHEIM_IMAGE_NAME", "cbartram/hearthhub")
+	t.Setenv("VALHEIM_IMAGE_VERSION", "0.0.9")
+	t.Setenv("BACKUP_MANAGER_IMAGE_NAME", "cbartram/hearthhub-sidecar")
+	t.Setenv("BACKUP_MANAGER_IMAGE_VERSION", "0.0.40")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repositories/cbartram/hearthhub/tags" {
+			fmt.Fprint(w, `{"results": [{"name": "0.0.9"}, {"name": "0.0.10-public-test"}, {"name": "0.0.8-public-test"}, {"name": "0.0.8"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"results": [{"name": "0.0.40"}]}`)
+	}))
+	defer srv.Close()
+
+	s := MakeImageService()
+	s.baseUrl = srv.URL
+
+	stable := s.Versions(context.Background(), BranchStable)
+	assert.Equal(t, []string{"0.0.9", "0.0.8"}, stable.Valheim)
+	assert.Equal(t, "0.0.9", stable.DefaultValheim)
+
+	// The default on another branch is the newest image of that branch and the backup manager stays on stable
+	publicTest := s.Versions(context.Background(), BranchPublicTest)
+	assert.Equal(t, []string{"0.0.10-public-test", "0.0.8-public-test"}, publicTest.Valheim)
+	assert.Equal(t, "0.0.10-public-test", publicTest.DefaultValheim)
+	assert.Equal(t, []string{"0.0.40"}, publicTest.BackupManager)
+}
+
+func TestImageBranch(t *testing.T) {
+	assert.Equal(t, BranchStable, ImageBranch("0.0.9"))
+	assert.Equal(t, BranchPublicTest, ImageBranch("0.0.9-public-test"))
+	assert.NoError(t, ValidateBranch(BranchPublicTest))
+	assert.Error(t, ValidateBranch("beta"))
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MinServerPasswordLength is the shortest password Valheim accepts for a dedicated server.
+	MinServerPasswordLength = 5
+
+	// RedactedPassword replaces server passwords in API responses and logs.
+	RedactedPassword = "********"
+)
+
+// serverPasswordPattern limits passwords to characters which are passed through the server's shell command as a single
+// argument without quoting.
+var serverPasswordPattern = regexp.MustCompile(`^[A-Za-z0-9@%^_+=.,:-]+$`)
+
+var serverArgsPasswordPattern = regexp.MustCompile(`-password \S+`)
+
+// ValidateServerPassword Checks a server password against Valheim's rules: it must be at least 5 characters and must not
+// contain the world name.
+func ValidateServerPassword(password, world string) error {
+	if len(password) < MinServerPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinServerPasswordLength)
+	}
+
+	if world != "" && strings.Contains(strings.ToLower(password), strings.ToLower(world)) {
+		return errors.New("password must not contain the world name")
+	}
+
+	if !serverPasswordPattern.MatchString(password) {
+		return errors.New("password may only contain letters, digits, and the characters @%^_+=.,:-")
+	}
+
+	return nil
+}
+
+// RedactWorld Returns a copy of world details with the password replaced so it can be returned to clients.
+func RedactWorld(world model.WorldDetails) model.WorldDetails {
+	if world.Password != "" {
+		world.Password = RedactedPassword
+	}
+	return world
+}
+
+// RedactServer Returns a copy of a server with its world password replaced.
+func RedactServer(server model.Server) model.Server {
+	server.WorldDetails = RedactWorld(server.WorldDetails)
+	return server
+}
+
+// RedactUser Returns a copy of a user with the world password of each of their servers replaced.
+func RedactUser(user *model.User) *model.User {
+	redacted := *user
+	redacted.Servers = make([]model.Server, 0, len(user.Servers))
+	for _, server := range user.Servers {
+		redacted.Servers = append(redacted.Servers, RedactServer(server))
+	}
+	return &redacted
+}
+
+// RedactServerArgs Replaces the password in a rendered server command so the command can be logged.
+func RedactServerArgs(args string) string {
+	return serverArgsPasswordPattern.ReplaceAllString(args, "-password "+RedactedPassword)
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateServerPassword(t *testing.T) {
+	assert.NoError(t, ValidateServerPassword("hunter2", "Midgard"))
+	assert.Error(t, ValidateServerPassword("abcd", "Midgard"))
+	assert.Error(t, ValidateServerPassword("xmidgard1", "Midgard"))
+	assert.Error(t, ValidateServerPassword("pass word", "Midgard"))
+	assert.Error(t, ValidateServerPassword("pass;rm", "Midgard"))
+}
+
+func TestRedactServer(t *testing.T) {
+	server := model.Server{WorldDetails: model.WorldDetails{Password: "hunter2"}}
+	redacted := RedactServer(server)
+	assert.Equal(t, RedactedPassword, redacted.WorldDetails.Password)
+	assert.Equal(t, "hunter2", server.WorldDetails.Password)
+
+	user := &model.User{Servers: []model.Server{server}}
+	assert.Equal(t, RedactedPassword, RedactUser(user).Servers[0].WorldDetails.Password)
+	assert.Equal(t, "hunter2", user.Servers[0].WorldDetails.Password)
+}
+
+func TestRedactServerArgs(t *testing.T) {
+	args := ServerArgs(&model.WorldDetails{Name: "Vikings", World: "Midgard", Port: "2456", Password: "hunter2"})
+	assert.NotContains(t, RedactServerArgs(args), "hunter2")
+	assert.Contains(t, RedactServerArgs(args), "-password "+RedactedPassword+" ")
+}
+
+func TestDiffWorldDetailsRedactsPassword(t *testing.T) {
+	changes := DiffWorldDetails(&model.WorldDetails{Password: "hunter2"}, &model.WorldDetails{Password: "hunter3"})
+	assert.Equal(t, []ConfigChange{{Field: "password", From: RedactedPassword, To: RedactedPassword}}, changes)
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+// DefaultStorageQuota is the storage quota (512MB) for users whose plan does not define a storage feature.
+const DefaultStorageQuota int64 = 512 << 20
+
+const (
+	// StorageRecalculationTTL is how long usage is trusted before it is rebuilt from S3. Counters drift when an existing key is
+	// overwritten since the size of the replaced object is not known when the upload completes.
+	StorageRecalculationTTL = 24 * time.Hour
+
+	// storageRecalculationBatch is the most users whose usage is rebuilt in a single pass.
+	storageRecalculationBatch = 100
+)
+
+const (
+	StorageCategoryMods    = "mods"
+	StorageCategoryConfigs = "configs"
+	StorageCategoryBackups = "backups"
+)
+
+// StorageUsage tracks the number of bytes a user has stored in S3 across mods, configs and backups.
+type StorageUsage struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	UserID      uint      `gorm:"column:user_id;uniqueIndex" json:"user_id"`
+	ModBytes    int64     `gorm:"column:mod_bytes;not null;default:0" json:"mod_bytes"`
+	ConfigBytes int64     `gorm:"column:config_bytes;not null;default:0" json:"config_bytes"`
+	BackupBytes int64     `gorm:"column:backup_bytes;not null;default:0" json:"backup_bytes"`
+	QuotaBytes  int64     `gorm:"-" json:"quota_bytes"`
+	UpdatedAt   time.Time `gorm:"column:updated_at" json:"updated_at"`
+	// RecalculatedAt is when usage was last rebuilt from S3
+	RecalculatedAt time.Time `gorm:"column:recalculated_at;index" json:"recalculated_at"`
+}
+
+func (StorageUsage) TableName() string {
+	return "storage_usage"
+}
+
+// TotalBytes Returns the total number of bytes stored by the user.
+func (s *StorageUsage) TotalBytes() int64 {
+	return s.ModBytes + s.ConfigBytes + s.BackupBytes
+}
+
+// Add Adds delta bytes to the category the key belongs to without writing to the database. It mirrors AddStorageUsage so
+// usage loaded once can be kept up to date while a request adds several files.
+func (s *StorageUsage) Add(key string, delta int64) {
+	var total *int64
+	switch StorageCategoryForKey(key) {
+	case StorageCategoryMods:
+		total = &s.ModBytes
+	case StorageCategoryConfigs:
+		total = &s.ConfigBytes
+	case StorageCategoryBackups:
+		total = &s.BackupBytes
+	default:
+		return
+	}
+
+	*total += delta
+	if *total < 0 {
+		*total = 0
+	}
+}
+
+// StorageCategoryForKey Returns the storage category an S3 key counts towards or an empty string if the key is not
+// counted towards a user's quota (i.e. shared mods under mods/general/).
+func StorageCategoryForKey(key string) string {
+	switch {
+	case strings.HasPrefix(key, "mods/general/"):
+		return ""
+	case strings.HasPrefix(key, "mods/"):
+		return StorageCategoryMods
+	case strings.HasPrefix(key, "config/"):
+		return StorageCategoryConfigs
+	case strings.HasPrefix(key, "valheim-backups-auto/"):
+		return StorageCategoryBackups
+	default:
+		return ""
+	}
+}
+
+// UserStoragePrefixes Returns the S3 prefixes which hold a user's own mods, configs and backups.
+func UserStoragePrefixes(discordId string) []string {
+	return []string{
+		fmt.Sprintf("mods/%s/", discordId),
+		fmt.Sprintf("config/%s/", discordId),
+		fmt.Sprintf("valheim-backups-auto/%s/", discordId),
+	}
+}
+
+// OwnsStorageKey Returns true when an S3 key is under one of the user's own prefixes. Keys containing a ".." path segment are
+// never owned so a key cannot escape the prefix once it is interpreted as a file path.
+func OwnsStorageKey(discordId, key string) bool {
+	if discordId == "" || strings.Contains(key, "..") {
+		return false
+	}
+
+	for _, prefix := range UserStoragePrefixes(discordId) {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanInstallKey Returns true when a user may install an S3 key on their server, which must either be a shared mod under
+// mods/general/ or one of the user's own files.
+func CanInstallKey(discordId, key string) bool {
+	if strings.HasPrefix(key, "mods/general/") && len(key) > len("mods/general/") && !strings.Contains(key, "..") {
+		return true
+	}
+	return OwnsStorageKey(discordId, key)
+}
+
+func storageColumn(category string) (string, error) {
+	switch category {
+	case StorageCategoryMods:
+		return "mod_bytes", nil
+	case StorageCategoryConfigs:
+		return "config_bytes", nil
+	case StorageCategoryBackups:
+		return "backup_bytes", nil
+	default:
+		return "", fmt.Errorf("unknown storage category: %s", category)
+	}
+}
+
+// AddStorageUsage Atomically adds delta bytes (which may be negative when files are deleted) to the category the key
+// belongs to. Keys which do not count towards the quota are ignored. Users without a usage record yet are skipped since
+// their usage is rebuilt from S3 the first time it is loaded.
+func AddStorageUsage(db *gorm.DB, userId uint, key string, delta int64) error {
+	category := StorageCategoryForKey(key)
+	if category == "" || delta == 0 {
+		return nil
+	}
+
+	column, err := storageColumn(category)
+	if err != nil {
+		return err
+	}
+
+	// GREATEST guards against the counter going negative if an object was deleted that was uploaded before usage was tracked.
+	tx := db.Model(&StorageUsage{}).
+		Where("user_id = ?", userId).
+		Update(column, gorm.Expr(fmt.Sprintf("GREATEST(%s + ?, 0)", column), delta))
+	if tx.Error != nil {
+		return fmt.Errorf("failed to update storage usage: %v", tx.Error)
+	}
+
+	return nil
+}
+
+// RecalculateStorageUsage Rebuilds a user's storage usage from the objects actually stored in S3. This is used to
+// initialize usage for users who uploaded files before usage was tracked and to correct drift in the counters.
+func RecalculateStorageUsage(db *gorm.DB, s3Service *S3Service, userId uint, discordId string) (*StorageUsage, error) {
+	usage := StorageUsage{UserID: userId, RecalculatedAt: time.Now()}
+	prefixes := map[string]*int64{
+		fmt.Sprintf("mods/%s/", discordId):                 &usage.ModBytes,
+		fmt.Sprintf("config/%s/", discordId):               &usage.ConfigBytes,
+		fmt.Sprintf("valheim-backups-auto/%s/", discordId): &usage.BackupBytes,
+	}
+
+	for prefix, total := range prefixes {
+		objects, err := s3Service.ListObjects(prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range objects {
+			*total += obj.Size
+		}
+	}
+
+	tx := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"mod_bytes", "config_bytes", "backup_bytes", "updated_at", "recalculated_at"}),
+	}).Create(&usage)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to save storage usage: %v", tx.Error)
+	}
+
+	return &usage, nil
+}
+
+// LoadStorageUsage Returns a user's storage usage along with their quota. Usage is rebuilt from S3 the first time it is
+// requested for a user so that files uploaded before usage was tracked are counted.
+func LoadStorageUsage(db *gorm.DB, s3Service *S3Service, stripeService *StripeService, user *model.User) (*StorageUsage, error) {
+	var usage *StorageUsage
+	var existing StorageUsage
+	tx := db.Where("user_id = ?", user.ID).First(&existing)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		recalculated, err := RecalculateStorageUsage(db, s3Service, user.ID, user.DiscordID)
+		if err != nil {
+			return nil, err
+		}
+		usage = recalculated
+	} else if tx.Error != nil {
+		return nil, fmt.Errorf("failed to get storage usage: %v", tx.Error)
+	} else {
+		usage = &existing
+	}
+
+	quota, err := UserStorageQuota(db, stripeService, user)
+	if err != nil {
+		return nil, err
+	}
+	usage.QuotaBytes = quota
+
+	return usage, nil
+}
+
+// RecalculateStaleStorageUsage Rebuilds the usage of up to a batch of users whose usage was last rebuilt before a time, oldest
+// first, and returns the number of users rebuilt.
+func RecalculateStaleStorageUsage(db *gorm.DB, s3Service *S3Service, before time.Time) (int, error) {
+	var stale []StorageUsage
+	tx := db.Where("recalculated_at < ?", before).Order("recalculated_at").Limit(storageRecalculationBatch).Find(&stale)
+	if tx.Error != nil {
+		return 0, fmt.Errorf("failed to list stale storage usage: %v", tx.Error)
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	userIds := make([]uint, 0, len(stale))
+	for _, usage := range stale {
+		userIds = append(userIds, usage.UserID)
+	}
+
+	var users []model.User
+	if err := db.Where("id IN ?", userIds).Find(&users).Error; err != nil {
+		return 0, fmt.Errorf("failed to get users for storage usage: %v", err)
+	}
+
+	recalculated := 0
+	for _, user := range users {
+		if _, err := RecalculateStorageUsage(db, s3Service, user.ID, user.DiscordID); err != nil {
+			log.Errorf("failed to recalculate storage usage for user: %s: %v", user.DiscordID, err)
+			continue
+		}
+		recalculated++
+	}
+	return recalculated, nil
+}
+
+// RunStorageRecalculation Rebuilds usage older than the StorageRecalculationTTL from S3 every interval until the context is
+// cancelled.
+func RunStorageRecalculation(ctx context.Context, db *gorm.DB, s3Service *S3Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		recalculated, err := RecalculateStaleStorageUsage(db, s3Service, time.Now().Add(-StorageRecalculationTTL))
+		if err != nil {
+			log.Errorf("failed to recalculate storage usage: %v", err)
+		} else if recalculated > 0 {
+			log.Infof("recalculated storage usage for %d users", recalculated)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
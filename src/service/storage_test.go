@@ -0,0 +1,55 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStorageCategoryForKey(t *testing.T) {
+	assert.Equal(t, StorageCategoryMods, StorageCategoryForKey("mods/123/Foo.zip"))
+	assert.Equal(t, "", StorageCategoryForKey("mods/general/ValheimPlus.zip"))
+	assert.Equal(t, StorageCategoryConfigs, StorageCategoryForKey("config/123/foo.cfg"))
+	assert.Equal(t, StorageCategoryBackups, StorageCategoryForKey("valheim-backups-auto/123/world.db"))
+	assert.Equal(t, "", StorageCategoryForKey("quarantine/mods/123/Foo.zip"))
+}
+
+func TestStorageUsage_TotalBytes(t *testing.T) {
+	usage := StorageUsage{ModBytes: 1, ConfigBytes: 2, BackupBytes: 3}
+	assert.Equal(t, int64(6), usage.TotalBytes())
+}
+
+func TestOwnsStorageKey(t *testing.T) {
+	assert.True(t, OwnsStorageKey("123", "mods/123/Foo.zip"))
+	assert.True(t, OwnsStorageKey("123", "config/123/foo.cfg"))
+	assert.True(t, OwnsStorageKey("123", "valheim-backups-auto/123/world.db"))
+	assert.False(t, OwnsStorageKey("123", "mods/general/123/Foo.zip"))
+	assert.False(t, OwnsStorageKey("123", "quarantine/mods/123/Foo.zip"))
+	assert.False(t, OwnsStorageKey("123", "mods/456/Foo.zip"))
+	assert.False(t, OwnsStorageKey("123", "mods/1234/Foo.zip"))
+	assert.False(t, OwnsStorageKey("123", "mods/123/../456/Foo.zip"))
+	assert.False(t, OwnsStorageKey("123", "mods/123/"))
+	assert.False(t, OwnsStorageKey("", "mods//Foo.zip"))
+}
+
+func TestCanInstallKey(t *testing.T) {
+	assert.True(t, CanInstallKey("123", "mods/general/ValheimPlus.zip"))
+	assert.True(t, CanInstallKey("123", "mods/123/Foo.zip"))
+	assert.True(t, CanInstallKey("123", "config/123/foo.cfg"))
+	assert.False(t, CanInstallKey("123", "mods/456/Foo.zip"))
+	assert.False(t, CanInstallKey("123", "config/456/foo.cfg"))
+	assert.False(t, CanInstallKey("123", "mods/general/"))
+	assert.False(t, CanInstallKey("123", "mods/general/../456/Foo.zip"))
+	assert.False(t, CanInstallKey("123", "quarantine/mods/123/Foo.zip"))
+}
+
+func TestStorageUsage_Add(t *testing.T) {
+	usage := StorageUsage{ModBytes: 10}
+	usage.Add("mods/123/Foo.zip", 5)
+	usage.Add("config/123/foo.cfg", 3)
+	usage.Add("valheim-backups-auto/123/world.db", 2)
+	usage.Add("mods/general/ValheimPlus.zip", 100)
+	assert.Equal(t, StorageUsage{ModBytes: 15, ConfigBytes: 3, BackupBytes: 2}, usage)
+
+	usage.Add("config/123/foo.cfg", -10)
+	assert.Equal(t, int64(0), usage.ConfigBytes)
+}
@@ -10,9 +10,31 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-type StripeService struct{}
+const (
+	// subscriptionStatusTTL is how long subscription statuses listed for operators are cached.
+	subscriptionStatusTTL = 5 * time.Minute
+
+	// maxConcurrentStripeRequests limits the subscriptions fetched at once when listing statuses for many users.
+	maxConcurrentStripeRequests = 8
+)
+
+type StripeService struct {
+	mu       sync.Mutex
+	statuses map[string]cachedSubscriptionStatus
+
+	// getSubscription fetches a subscription from Stripe and is replaced in tests
+	getSubscription func(id string) (*stripe.Subscription, error)
+}
+
+// cachedSubscriptionStatus is a subscription status along with when it was fetched from Stripe.
+type cachedSubscriptionStatus struct {
+	status    string
+	fetchedAt time.Time
+}
 
 func MakeStripeService() *StripeService {
 	apiKey := os.Getenv("STRIPE_SECRET_KEY")
@@ -24,18 +46,89 @@ func MakeStripeService() *StripeService {
 	return &StripeService{}
 }
 
+// SubscriptionStatuses Returns the subscription status of each user by user id for operator views listing many users. Statuses
+// are cached for a few minutes and uncached statuses are fetched from Stripe concurrently. A status which cannot be read from
+// Stripe is reported as unknown.
+func (s *StripeService) SubscriptionStatuses(users []model.User) map[uint]string {
+	statuses := make(map[uint]string, len(users))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentStripeRequests)
+
+	for _, user := range users {
+		if status, ok := s.cachedStatus(user.CustomerId, user.SubscriptionId); ok {
+			statuses[user.ID] = status
+			continue
+		}
+
+		wg.Add(1)
+		go func(user model.User) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			status, err := s.GetActiveSubscription(user.CustomerId, user.SubscriptionId)
+			if err != nil {
+				log.Errorf("failed to get subscription status for user %s: %v", user.DiscordID, err)
+				status = "unknown"
+			} else {
+				s.cacheStatus(user.CustomerId, user.SubscriptionId, status)
+			}
+
+			mu.Lock()
+			statuses[user.ID] = status
+			mu.Unlock()
+		}(user)
+	}
+
+	wg.Wait()
+	return statuses
+}
+
+func (s *StripeService) cachedStatus(customerId, subscriptionId string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, ok := s.statuses[customerId+"/"+subscriptionId]
+	if !ok || time.Since(cached.fetchedAt) > subscriptionStatusTTL {
+		return "", false
+	}
+	return cached.status, true
+}
+
+func (s *StripeService) cacheStatus(customerId, subscriptionId, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.statuses == nil {
+		s.statuses = map[string]cachedSubscriptionStatus{}
+	}
+
+	// Expired statuses are dropped whenever the cache is written to so it only holds recently listed users
+	now := time.Now()
+	for k, v := range s.statuses {
+		if now.Sub(v.fetchedAt) > subscriptionStatusTTL {
+			delete(s.statuses, k)
+		}
+	}
+	s.statuses[customerId+"/"+subscriptionId] = cachedSubscriptionStatus{status: status, fetchedAt: now}
+}
+
 // GetActiveSubscription checks if a subscription is active for a given customer
 func (s *StripeService) GetActiveSubscription(customerId string, subscriptionId string) (string, error) {
 	if len(subscriptionId) == 0 {
 		return string(stripe.SubscriptionStatusUnpaid), nil
 	}
 
-	sub, err := subscription.Get(subscriptionId, nil)
+	get := s.getSubscription
+	if get == nil {
+		get = func(id string) (*stripe.Subscription, error) { return subscription.Get(id, nil) }
+	}
+
+	sub, err := get(subscriptionId)
 	if err != nil {
 		return "", fmt.Errorf("error retrieving subscription: %v", err)
 	}
 
-	if sub.Customer.ID != customerId {
+	if sub.Customer == nil || sub.Customer.ID != customerId {
 		return "", fmt.Errorf("subscription does not belong to customer %s", customerId)
 	}
 
@@ -47,26 +140,16 @@ func (s *StripeService) GetSubscriptionLimits(subscriptionId string) (*model.Sub
 		return &model.SubscriptionLimits{}, nil
 	}
 
-	sub, err := subscription.Get(subscriptionId, nil)
+	names, err := listFeatureNames(subscriptionId)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving subscription: %v", err)
-	}
-
-	if len(sub.Items.Data) == 0 || len(sub.Items.Data) > 1 {
-		return nil, fmt.Errorf("unexpected number of subscription items: %d", len(sub.Items.Data))
+		return nil, err
 	}
 
 	limits := model.SubscriptionLimits{
 		ExistingWorldUpload: false,
 	}
-	productId := sub.Items.Data[0].Price.Product.ID
-
-	features := productfeature.List(&stripe.ProductFeatureListParams{
-		Product: stripe.String(productId),
-	})
 
-	for features.Next() {
-		name := features.ProductFeature().EntitlementFeature.Name
+	for _, name := range names {
 		if strings.Contains(name, "GB RAM") {
 			limit, _ := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(name, " GB RAM")))
 			limits.MemoryLimit = limit
@@ -86,3 +169,57 @@ func (s *StripeService) GetSubscriptionLimits(subscriptionId string) (*model.Sub
 
 	return &limits, nil
 }
+
+// GetStorageQuota Returns the number of bytes a user may store across mods, configs and backups. The quota is parsed from
+// a "<n> GB Storage" product feature the same way other subscription limits are. Users without a subscription or whose
+// plan has no storage feature receive the default quota.
+func (s *StripeService) GetStorageQuota(subscriptionId string) (int64, error) {
+	if len(subscriptionId) == 0 {
+		return DefaultStorageQuota, nil
+	}
+
+	names, err := listFeatureNames(subscriptionId)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, name := range names {
+		if strings.Contains(name, "GB Storage") {
+			limit, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(name, " GB Storage")), 64)
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse storage feature: %s: %v", name, err)
+			}
+			return int64(limit * (1 << 30)), nil
+		}
+	}
+
+	return DefaultStorageQuota, nil
+}
+
+// listFeatureNames Returns the names of all entitlement features for the product a subscription is for.
+func listFeatureNames(subscriptionId string) ([]string, error) {
+	sub, err := subscription.Get(subscriptionId, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving subscription: %v", err)
+	}
+
+	if len(sub.Items.Data) == 0 || len(sub.Items.Data) > 1 {
+		return nil, fmt.Errorf("unexpected number of subscription items: %d", len(sub.Items.Data))
+	}
+
+	productId := sub.Items.Data[0].Price.Product.ID
+	features := productfeature.List(&stripe.ProductFeatureListParams{
+		Product: stripe.String(productId),
+	})
+
+	var names []string
+	for features.Next() {
+		names = append(names, features.ProductFeature().EntitlementFeature.Name)
+	}
+
+	if err := features.Err(); err != nil {
+		return nil, fmt.Errorf("error listing product features: %v", err)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"errors"
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/stripe-go/v81"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSubscriptionStatuses(t *testing.T) {
+	var calls int32
+	s := &StripeService{getSubscription: func(id string) (*stripe.Subscription, error) {
+		atomic.AddInt32(&calls, 1)
+		if id == "sub_broken" {
+			return nil, errors.New("stripe is unavailable")
+		}
+		return &stripe.Subscription{Status: stripe.SubscriptionStatusActive, Customer: &stripe.Customer{ID: "cus_" + id}}, nil
+	}}
+
+	users := []model.User{
+		{ID: 1, CustomerId: "cus_sub_1", SubscriptionId: "sub_1"},
+		{ID: 2, CustomerId: "cus_sub_2", SubscriptionId: "sub_2"},
+		{ID: 3},
+		{ID: 4, CustomerId: "cus_sub_broken", SubscriptionId: "sub_broken"},
+		{ID: 5, CustomerId: "cus_other", SubscriptionId: "sub_5"},
+	}
+
+	statuses := s.SubscriptionStatuses(users)
+	assert.Equal(t, map[uint]string{1: "active", 2: "active", 3: "unpaid", 4: "unknown", 5: "unknown"}, statuses)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	// Statuses which were read are cached, failed lookups are retried
+	assert.Equal(t, statuses, s.SubscriptionStatuses(users))
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+}
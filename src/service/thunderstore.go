@@ -0,0 +1,83 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ThunderstoreService Reads the Valheim package index from Thunderstore. Thunderstore is the mod repository r2modman and
+// most BepInEx mod managers install from.
+type ThunderstoreService struct {
+	baseUrl string
+	Client  *http.Client
+}
+
+// ThunderstorePackage is a single mod on Thunderstore along with every version that has been published.
+type ThunderstorePackage struct {
+	Name         string                `json:"name"`
+	FullName     string                `json:"full_name"`
+	Owner        string                `json:"owner"`
+	PackageUrl   string                `json:"package_url"`
+	DateCreated  time.Time             `json:"date_created"`
+	DateUpdated  time.Time             `json:"date_updated"`
+	UUID         string                `json:"uuid4"`
+	RatingScore  int                   `json:"rating_score"`
+	IsDeprecated bool                  `json:"is_deprecated"`
+	Categories   []string              `json:"categories"`
+	Versions     []ThunderstoreVersion `json:"versions"`
+}
+
+// ThunderstoreVersion is a published version of a package. Dependencies are Thunderstore full names
+// with a version i.e. denikson-BepInExPack_Valheim-5.4.2202.
+type ThunderstoreVersion struct {
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description"`
+	Icon          string    `json:"icon"`
+	VersionNumber string    `json:"version_number"`
+	Dependencies  []string  `json:"dependencies"`
+	DownloadUrl   string    `json:"download_url"`
+	Downloads     int64     `json:"downloads"`
+	DateCreated   time.Time `json:"date_created"`
+	WebsiteUrl    string    `json:"website_url"`
+	FileSize      int64     `json:"file_size"`
+}
+
+func MakeThunderstoreService() *ThunderstoreService {
+	return &ThunderstoreService{
+		baseUrl: "https://thunderstore.io/c/valheim/api/v1",
+		Client:  &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// ListPackages Returns every Valheim package published to Thunderstore.
+func (t *ThunderstoreService) ListPackages() ([]ThunderstorePackage, error) {
+	req, err := http.NewRequest("GET", t.baseUrl+"/package/", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create thunderstore request: %v", err)
+	}
+	req.Header.Add("Accept", "application/json")
+
+	res, err := t.Client.Do(req)
+	if err != nil {
+		log.Errorf("error while making request to thunderstore: %v", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("thunderstore returned status %d: %s", res.StatusCode, string(body))
+	}
+
+	var packages []ThunderstorePackage
+	if err = json.NewDecoder(res.Body).Decode(&packages); err != nil {
+		return nil, fmt.Errorf("failed to decode thunderstore packages: %v", err)
+	}
+
+	return packages, nil
+}
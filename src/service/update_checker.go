@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// CheckUpdates Compares the version of every plugin installed on a server with the latest version of the mod in the catalog
+// and flags the plugins which can be upgraded. Plugins are matched to the catalog by their Thunderstore full name, or by
+// their package name when exactly one catalog mod has that name. The number of plugins with an update available is returned.
+func (c *CatalogService) CheckUpdates() (int, error) {
+	var files []InstalledFile
+	err := c.db.Where("status = ? AND destination LIKE ?", InstallStatusInstalled, PluginsDestination+"%").Find(&files).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to list installed plugins: %v", err)
+	}
+
+	if len(files) == 0 {
+		return 0, nil
+	}
+
+	fullNames, names := []string{}, []string{}
+	for _, f := range files {
+		if fullName := fullNameFromPrefix(f.Prefix); fullName != "" {
+			fullNames = append(fullNames, fullName)
+		}
+		names = append(names, f.Name)
+	}
+
+	var mods []CatalogMod
+	err = c.db.Where("full_name IN ? OR name IN ?", fullNames, names).Order("downloads DESC").Find(&mods).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to list catalog mods: %v", err)
+	}
+
+	byFullName := map[string]*CatalogMod{}
+	byName := map[string][]*CatalogMod{}
+	for i := range mods {
+		if _, ok := byFullName[mods[i].FullName]; !ok && mods[i].FullName != "" {
+			byFullName[mods[i].FullName] = &mods[i]
+		}
+		byName[mods[i].Name] = append(byName[mods[i].Name], &mods[i])
+	}
+
+	available := 0
+	for _, f := range files {
+		mod := byFullName[fullNameFromPrefix(f.Prefix)]
+		if mod == nil && len(byName[f.Name]) == 1 {
+			mod = byName[f.Name][0]
+		}
+		if mod == nil {
+			continue
+		}
+
+		update := UpdateAvailable(&f, mod)
+		if update {
+			available++
+		}
+
+		if f.CatalogModID != nil && *f.CatalogModID == mod.ID && f.LatestVersion == mod.LatestVersion && f.UpdateAvailable == update {
+			continue
+		}
+
+		err = c.db.Model(&InstalledFile{}).Where("id = ?", f.ID).Updates(map[string]interface{}{
+			"catalog_mod_id":   mod.ID,
+			"latest_version":   mod.LatestVersion,
+			"update_available": update,
+		}).Error
+		if err != nil {
+			log.Errorf("failed to flag update for installed file %d: %v", f.ID, err)
+		}
+	}
+
+	return available, nil
+}
+
+// UpdateAvailable Returns true when the catalog has a newer version of an installed plugin. Plugins without a known version
+// cannot be compared and are never flagged.
+func UpdateAvailable(f *InstalledFile, mod *CatalogMod) bool {
+	if f.Version == "" || mod.LatestVersion == "" || mod.Deprecated {
+		return false
+	}
+	return CompareVersions(mod.LatestVersion, f.Version) > 0
+}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUpdateAvailable(t *testing.T) {
+	mod := &CatalogMod{LatestVersion: "2.20.1"}
+	assert.True(t, UpdateAvailable(&InstalledFile{Version: "2.20.0"}, mod))
+	assert.True(t, UpdateAvailable(&InstalledFile{Version: "2.9.9"}, mod))
+	assert.False(t, UpdateAvailable(&InstalledFile{Version: "2.20.1"}, mod))
+	assert.False(t, UpdateAvailable(&InstalledFile{}, mod))
+	assert.False(t, UpdateAvailable(&InstalledFile{Version: "2.20.0"}, &CatalogMod{LatestVersion: "2.20.1", Deprecated: true}))
+}
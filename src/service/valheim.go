@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WorldMetadata is the contents of a Valheim .fwl file which describes a world: its name, seed and generation version.
+type WorldMetadata struct {
+	Version         int32    `json:"version"`
+	Name            string   `json:"name"`
+	SeedName        string   `json:"seed_name"`
+	Seed            int32    `json:"seed"`
+	UID             int64    `json:"uid"`
+	WorldGenVersion int32    `json:"world_gen_version"`
+	NeedsDB         bool     `json:"needs_db"`
+	GlobalKeys      []string `json:"global_keys"`
+}
+
+// ReadWorldMetadata Parses a Valheim .fwl file. The file is a length prefixed ZPackage written by the game with the
+// world version, name, seed name, seed and uid. Older world versions omit some trailing fields which are left as zero values.
+func ReadWorldMetadata(data []byte) (*WorldMetadata, error) {
+	r := bytes.NewReader(data)
+
+	var length int32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, errors.New("world metadata is too small")
+	}
+
+	if length <= 0 || int(length) != len(data)-4 {
+		return nil, fmt.Errorf("world metadata length mismatch: header=%d actual=%d", length, len(data)-4)
+	}
+
+	meta := &WorldMetadata{}
+	if err := binary.Read(r, binary.LittleEndian, &meta.Version); err != nil {
+		return nil, fmt.Errorf("failed to read world version: %v", err)
+	}
+
+	if meta.Version <= 0 || meta.Version > maxWorldVersion {
+		return nil, fmt.Errorf("world metadata has an invalid version: %d", meta.Version)
+	}
+
+	var err error
+	if meta.Name, err = readZString(r); err != nil {
+		return nil, fmt.Errorf("failed to read world name: %v", err)
+	}
+
+	if meta.Name == "" {
+		return nil, errors.New("world metadata has an empty world name")
+	}
+
+	if meta.SeedName, err = readZString(r); err != nil {
+		return nil, fmt.Errorf("failed to read world seed name: %v", err)
+	}
+
+	if err = binary.Read(r, binary.LittleEndian, &meta.Seed); err != nil {
+		return nil, fmt.Errorf("failed to read world seed: %v", err)
+	}
+
+	if err = binary.Read(r, binary.LittleEndian, &meta.UID); err != nil {
+		return nil, fmt.Errorf("failed to read world uid: %v", err)
+	}
+
+	// Fields below were added in later world versions
+	if r.Len() == 0 {
+		return meta, nil
+	}
+
+	if err = binary.Read(r, binary.LittleEndian, &meta.WorldGenVersion); err != nil {
+		return nil, fmt.Errorf("failed to read world generation version: %v", err)
+	}
+
+	if r.Len() == 0 {
+		return meta, nil
+	}
+
+	if err = binary.Read(r, binary.LittleEndian, &meta.NeedsDB); err != nil {
+		return nil, fmt.Errorf("failed to read world needs db flag: %v", err)
+	}
+
+	if r.Len() == 0 {
+		return meta, nil
+	}
+
+	var keyCount int32
+	if err = binary.Read(r, binary.LittleEndian, &keyCount); err != nil {
+		return nil, fmt.Errorf("failed to read world global key count: %v", err)
+	}
+
+	for i := int32(0); i < keyCount; i++ {
+		key, err := readZString(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read world global key: %v", err)
+		}
+		meta.GlobalKeys = append(meta.GlobalKeys, key)
+	}
+
+	return meta, nil
+}
+
+// readZString Reads a string written by C#'s BinaryWriter which prefixes UTF-8 bytes with a 7-bit encoded length.
+func readZString(r *bytes.Reader) (string, error) {
+	length := 0
+	shift := 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+
+		shift += 7
+		if shift > 28 {
+			return "", errors.New("string length is malformed")
+		}
+	}
+
+	if length > r.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"fmt"
+	"github.com/cbartram/hearthhub-common/model"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ModifierKeyPreset is the modifier key a world preset is stored under and rendered as -preset.
+	ModifierKeyPreset = "preset"
+
+	// ModifierKeySetKey is the modifier key each world key is stored under and rendered as -setkey.
+	ModifierKeySetKey = "setkey"
+)
+
+// WorldModifiers are the values each Valheim world modifier accepts. The default value of a modifier is selected by leaving
+// it out.
+var WorldModifiers = map[string][]string{
+	"combat":       {model.VERY_EASY, model.EASY, model.HARD, model.VERY_HARD},
+	"deathpenalty": {model.CASUAL, model.VERY_EASY, model.EASY, model.HARD, model.HARDCORE},
+	"resources":    {model.MUCH_LESS, model.LESS, model.MORE, model.MUCHMORE, model.MOST},
+	"raids":        {model.NONE, model.MUCH_LESS, model.LESS, model.MORE, model.MUCHMORE},
+	"portals":      {model.CASUAL, model.HARD, model.VERY_HARD},
+}
+
+// WorldSetKeys are the world keys which can be enabled with -setkey.
+var WorldSetKeys = []string{
+	"nobuildcost",
+	"playerevents",
+	"passivemobs",
+	"nomap",
+	"nocraftcost",
+	"noworkbench",
+	"noportals",
+	"nobossportals",
+	"teleportall",
+	"dungeonbuild",
+	"deathkeepequip",
+	"deathdeleteitems",
+	"deathdeleteunequipped",
+	"deathskillsreset",
+	"allpiecesunlocked",
+	"allrecipesunlocked",
+}
+
+// WorldPreset is the set of modifiers and world keys a Valheim world preset implies.
+type WorldPreset struct {
+	Modifiers map[string]string `json:"modifiers"`
+	SetKeys   []string          `json:"setkeys"`
+}
+
+// WorldPresets are the presets Valheim offers when creating a world.
+var WorldPresets = map[string]WorldPreset{
+	"casual": {
+		Modifiers: map[string]string{"combat": model.VERY_EASY, "deathpenalty": model.CASUAL, "resources": model.MORE, "raids": model.NONE, "portals": model.CASUAL},
+	},
+	"easy": {
+		Modifiers: map[string]string{"combat": model.EASY, "deathpenalty": model.EASY, "raids": model.LESS},
+	},
+	"normal": {
+		Modifiers: map[string]string{},
+	},
+	"hard": {
+		Modifiers: map[string]string{"combat": model.HARD, "deathpenalty": model.HARD, "raids": model.MORE},
+	},
+	"hardcore": {
+		Modifiers: map[string]string{"combat": model.VERY_HARD, "deathpenalty": model.HARDCORE, "resources": model.LESS, "raids": model.MUCHMORE, "portals": model.HARD},
+		SetKeys:   []string{"nomap"},
+	},
+	"immersive": {
+		Modifiers: map[string]string{"portals": model.VERY_HARD},
+		SetKeys:   []string{"nomap"},
+	},
+	"hammer": {
+		Modifiers: map[string]string{"raids": model.NONE},
+		SetKeys:   []string{"nobuildcost", "passivemobs"},
+	},
+}
+
+// ValidateWorldModifiers Checks a preset, modifiers, and world keys against the values Valheim accepts. Every modifier is
+// checked and each modifier may only be given once.
+func ValidateWorldModifiers(preset string, modifiers []model.Modifier, setKeys []string) error {
+	if preset != "" {
+		if _, ok := WorldPresets[preset]; !ok {
+			return fmt.Errorf("invalid preset: \"%s\" valid presets are: \"%v\"", preset, sortedKeys(WorldPresets))
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, modifier := range modifiers {
+		validValues, exists := WorldModifiers[modifier.Key]
+		if !exists {
+			return fmt.Errorf("invalid modifier key: \"%s\"", modifier.Key)
+		}
+
+		if seen[modifier.Key] {
+			return fmt.Errorf("modifier \"%s\" given more than once", modifier.Key)
+		}
+		seen[modifier.Key] = true
+
+		if !contains(validValues, modifier.Value) {
+			return fmt.Errorf("invalid value for modifier \"%s\": \"%s\" valid values are: \"%v\"", modifier.Key, modifier.Value, validValues)
+		}
+	}
+
+	for _, key := range setKeys {
+		if !contains(WorldSetKeys, key) {
+			return fmt.Errorf("invalid setkey: \"%s\" valid keys are: \"%v\"", key, WorldSetKeys)
+		}
+	}
+
+	return nil
+}
+
+// ExpandWorldModifiers Expands a preset into the modifiers and world keys it implies. Modifiers given explicitly override the
+// preset and world keys are added to the preset's keys. The preset itself is kept so it is shown in game.
+func ExpandWorldModifiers(preset string, modifiers []model.Modifier, setKeys []string) []model.Modifier {
+	values := map[string]string{}
+	keys := map[string]bool{}
+
+	if p, ok := WorldPresets[preset]; ok {
+		for k, v := range p.Modifiers {
+			values[k] = v
+		}
+		for _, k := range p.SetKeys {
+			keys[k] = true
+		}
+	}
+
+	for _, m := range modifiers {
+		values[m.Key] = m.Value
+	}
+	for _, k := range setKeys {
+		keys[k] = true
+	}
+
+	expanded := []model.Modifier{}
+	if preset != "" {
+		expanded = append(expanded, model.Modifier{Key: ModifierKeyPreset, Value: preset})
+	}
+	for _, k := range sortedKeys(values) {
+		expanded = append(expanded, model.Modifier{Key: k, Value: values[k]})
+	}
+	for _, k := range sortedKeys(keys) {
+		expanded = append(expanded, model.Modifier{Key: ModifierKeySetKey, Value: k})
+	}
+	return expanded
+}
+
+// SplitWorldModifiers Splits stored modifiers into the preset, the world modifiers, and the world keys.
+func SplitWorldModifiers(stored []model.Modifier) (string, []model.Modifier, []string) {
+	var preset string
+	modifiers := []model.Modifier{}
+	setKeys := []string{}
+
+	for _, m := range stored {
+		switch m.Key {
+		case ModifierKeyPreset:
+			preset = m.Value
+		case ModifierKeySetKey:
+			setKeys = append(setKeys, m.Value)
+		default:
+			modifiers = append(modifiers, model.Modifier{Key: m.Key, Value: m.Value})
+		}
+	}
+	return preset, modifiers, setKeys
+}
+
+// ServerArgs Renders the Valheim server command for a world. This matches WorldDetails.ToStringArgs except presets and world
+// keys stored as modifiers are rendered as -preset and -setkey rather than -modifier.
+func ServerArgs(world *model.WorldDetails) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("/valheim/valheim_server.x86_64 -name %s -port %s -world %s -password %s -instanceid %s -backups %s -backupshort %s -backuplong %s ",
+		world.Name, world.Port, world.World, world.Password, world.InstanceID, strconv.Itoa(world.BackupCount), strconv.Itoa(world.InitialBackupSeconds), strconv.Itoa(world.BackupIntervalSeconds)))
+
+	if world.EnableCrossplay {
+		sb.WriteString("-crossplay ")
+	}
+
+	if world.Public {
+		sb.WriteString("-public 1 ")
+	} else {
+		sb.WriteString("-public 0 ")
+	}
+
+	for _, modifier := range world.Modifiers {
+		switch modifier.Key {
+		case ModifierKeyPreset:
+			sb.WriteString(fmt.Sprintf("-preset %s ", modifier.Value))
+		case ModifierKeySetKey:
+			sb.WriteString(fmt.Sprintf("-setkey %s ", modifier.Value))
+		default:
+			sb.WriteString(fmt.Sprintf("-modifier %s %s ", modifier.Key, modifier.Value))
+		}
+	}
+
+	// Write the logs to a shared mount on the pvc so that the sidecar can tail these looking
+	// for the join code.
+	sb.WriteString("-logFile /valheim/BepInEx/config/server-logs.txt")
+	return sb.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
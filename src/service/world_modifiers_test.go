@@ -0,0 +1,55 @@
+package service
+
+import (
+	"github.com/cbartram/hearthhub-common/model"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateWorldModifiers(t *testing.T) {
+	assert.NoError(t, ValidateWorldModifiers("hardcore", []model.Modifier{{Key: "combat", Value: "hard"}, {Key: "raids", Value: "none"}}, []string{"nobuildcost"}))
+	assert.Error(t, ValidateWorldModifiers("nightmare", nil, nil))
+	assert.Error(t, ValidateWorldModifiers("", nil, []string{"godmode"}))
+	assert.Error(t, ValidateWorldModifiers("", []model.Modifier{{Key: "combat", Value: "hard"}, {Key: "combat", Value: "easy"}}, nil))
+
+	// Every modifier is validated, not just the first
+	assert.Error(t, ValidateWorldModifiers("", []model.Modifier{{Key: "combat", Value: "hard"}, {Key: "portals", Value: "easy"}}, nil))
+}
+
+func TestExpandWorldModifiers(t *testing.T) {
+	expanded := ExpandWorldModifiers("hammer", []model.Modifier{{Key: "raids", Value: "less"}, {Key: "combat", Value: "easy"}}, []string{"nomap"})
+	assert.Equal(t, []model.Modifier{
+		{Key: ModifierKeyPreset, Value: "hammer"},
+		{Key: "combat", Value: "easy"},
+		{Key: "raids", Value: "less"},
+		{Key: ModifierKeySetKey, Value: "nobuildcost"},
+		{Key: ModifierKeySetKey, Value: "nomap"},
+		{Key: ModifierKeySetKey, Value: "passivemobs"},
+	}, expanded)
+
+	preset, modifiers, setKeys := SplitWorldModifiers(expanded)
+	assert.Equal(t, "hammer", preset)
+	assert.Len(t, modifiers, 2)
+	assert.Equal(t, []string{"nobuildcost", "nomap", "passivemobs"}, setKeys)
+
+	assert.Empty(t, ExpandWorldModifiers("", nil, nil))
+}
+
+func TestServerArgs(t *testing.T) {
+	world := &model.WorldDetails{
+		Name:       "Vikings",
+		Port:       "2456",
+		World:      "Midgard",
+		Password:   "secret",
+		InstanceID: "abc",
+		Modifiers:  []model.Modifier{{Key: "combat", Value: "hard"}},
+	}
+
+	// Worlds without presets or world keys render the same args as the shared model
+	assert.Equal(t, world.ToStringArgs(), ServerArgs(world))
+
+	world.Modifiers = ExpandWorldModifiers("immersive", nil, nil)
+	args := ServerArgs(world)
+	assert.Contains(t, args, "-preset immersive -modifier portals veryhard -setkey nomap ")
+	assert.NotContains(t, args, "-modifier preset")
+}
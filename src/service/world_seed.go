@@ -0,0 +1,143 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"math"
+	"math/big"
+	"regexp"
+	"time"
+)
+
+const (
+	WorldsDestination = "/root/.config/unity3d/IronGate/Valheim/worlds_local"
+
+	// worldVersion and worldGenVersion are the versions written to generated .fwl files. Valheim upgrades worlds from older
+	// versions when they are loaded.
+	worldVersion    = 34
+	worldGenVersion = 2
+
+	seedLength  = 10
+	seedCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+var seedPattern = regexp.MustCompile(`^[A-Za-z0-9]{1,10}$`)
+
+// WorldSeed is the seed a server's world was generated from.
+type WorldSeed struct {
+	ID       uint   `gorm:"primaryKey" json:"-"`
+	ServerID uint   `gorm:"column:server_id;uniqueIndex" json:"server_id"`
+	World    string `gorm:"column:world" json:"world"`
+	Seed     string `gorm:"column:seed" json:"seed"`
+	SeedHash int32  `gorm:"column:seed_hash" json:"seed_hash"`
+
+	// Generated is true when the seed was chosen by hearthhub rather than the user
+	Generated bool `gorm:"column:generated" json:"generated"`
+
+	// Prefix is the S3 key of the .fwl file the world was provisioned from
+	Prefix      string    `gorm:"column:prefix" json:"prefix"`
+	OperationID *uint     `gorm:"column:operation_id" json:"operation_id,omitempty"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (WorldSeed) TableName() string {
+	return "world_seeds"
+}
+
+// GetWorldSeed Returns the seed of a server's world or nil when it is not known.
+func GetWorldSeed(db *gorm.DB, serverId uint) (*WorldSeed, error) {
+	var seeds []WorldSeed
+	if err := db.Where("server_id = ?", serverId).Limit(1).Find(&seeds).Error; err != nil || len(seeds) == 0 {
+		return nil, err
+	}
+	return &seeds[0], nil
+}
+
+// ValidateSeed Checks that a seed can be entered in Valheim's world creation menu: 1 to 10 letters or digits.
+func ValidateSeed(seed string) error {
+	if !seedPattern.MatchString(seed) {
+		return errors.New("seed must be 1 to 10 letters or digits")
+	}
+	return nil
+}
+
+// GenerateSeed Returns a random seed in the same form Valheim generates for new worlds.
+func GenerateSeed() (string, error) {
+	b := make([]byte, seedLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(seedCharset))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate seed: %v", err)
+		}
+		b[i] = seedCharset[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// SeedHash Returns the numeric seed Valheim derives from a seed string using its stable string hash.
+func SeedHash(seed string) int32 {
+	num, num2 := int32(5381), int32(5381)
+	for i := 0; i < len(seed); i += 2 {
+		num = ((num << 5) + num) ^ int32(seed[i])
+		if i == len(seed)-1 {
+			break
+		}
+		num2 = ((num2 << 5) + num2) ^ int32(seed[i+1])
+	}
+	return num + num2*1566083941
+}
+
+// NewWorldMetadata Returns the metadata of a new world generated from a seed. The world has no database yet so Valheim
+// generates it from the seed the first time the server starts.
+func NewWorldMetadata(name, seed string, globalKeys []string) *WorldMetadata {
+	var uid int64
+	_ = binary.Read(rand.Reader, binary.LittleEndian, &uid)
+	uid &= math.MaxInt64
+
+	return &WorldMetadata{
+		Version:         worldVersion,
+		Name:            name,
+		SeedName:        seed,
+		Seed:            SeedHash(seed),
+		UID:             uid,
+		WorldGenVersion: worldGenVersion,
+		NeedsDB:         false,
+		GlobalKeys:      globalKeys,
+	}
+}
+
+// WriteWorldMetadata Encodes world metadata as a Valheim .fwl file which ReadWorldMetadata can read back.
+func WriteWorldMetadata(meta *WorldMetadata) []byte {
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, meta.Version)
+	writeZString(body, meta.Name)
+	writeZString(body, meta.SeedName)
+	_ = binary.Write(body, binary.LittleEndian, meta.Seed)
+	_ = binary.Write(body, binary.LittleEndian, meta.UID)
+	_ = binary.Write(body, binary.LittleEndian, meta.WorldGenVersion)
+	_ = binary.Write(body, binary.LittleEndian, meta.NeedsDB)
+	_ = binary.Write(body, binary.LittleEndian, int32(len(meta.GlobalKeys)))
+	for _, key := range meta.GlobalKeys {
+		writeZString(body, key)
+	}
+
+	data := new(bytes.Buffer)
+	_ = binary.Write(data, binary.LittleEndian, int32(body.Len()))
+	data.Write(body.Bytes())
+	return data.Bytes()
+}
+
+// writeZString Writes a string the way C#'s BinaryWriter does, prefixed with its 7-bit encoded length.
+func writeZString(buf *bytes.Buffer, s string) {
+	length := uint32(len(s))
+	for length >= 0x80 {
+		buf.WriteByte(byte(length) | 0x80)
+		length >>= 7
+	}
+	buf.WriteByte(byte(length))
+	buf.WriteString(s)
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateSeed(t *testing.T) {
+	assert.NoError(t, ValidateSeed("a"))
+	assert.NoError(t, ValidateSeed("Kq8zLm0Ab3"))
+	assert.Error(t, ValidateSeed(""))
+	assert.Error(t, ValidateSeed("ABCDEFGHIJK"))
+	assert.Error(t, ValidateSeed("bad seed"))
+	assert.Error(t, ValidateSeed("seed-1"))
+}
+
+func TestGenerateSeed(t *testing.T) {
+	seed, err := GenerateSeed()
+	assert.NoError(t, err)
+	assert.Len(t, seed, seedLength)
+	assert.NoError(t, ValidateSeed(seed))
+
+	other, err := GenerateSeed()
+	assert.NoError(t, err)
+	assert.NotEqual(t, seed, other)
+}
+
+func TestSeedHash(t *testing.T) {
+	assert.Equal(t, SeedHash("Kq8zLm0Ab3"), SeedHash("Kq8zLm0Ab3"))
+	assert.NotEqual(t, SeedHash("Kq8zLm0Ab3"), SeedHash("Kq8zLm0Ab4"))
+	assert.NotEqual(t, SeedHash("abc"), SeedHash("ab"))
+}
+
+func TestWriteWorldMetadata(t *testing.T) {
+	meta := NewWorldMetadata("Midgard", "Kq8zLm0Ab3", []string{"nomap", "nobuildcost"})
+
+	read, err := ReadWorldMetadata(WriteWorldMetadata(meta))
+	assert.NoError(t, err)
+	assert.Equal(t, meta, read)
+	assert.Equal(t, SeedHash("Kq8zLm0Ab3"), read.Seed)
+	assert.GreaterOrEqual(t, read.UID, int64(0))
+}
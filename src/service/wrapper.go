@@ -6,12 +6,17 @@ import (
 )
 
 type Wrapper struct {
-	DiscordService  *DiscordService
-	S3Service       *S3Service
-	StripeService   *StripeService
-	CognitoService  service.CognitoService
-	KubeService     KubernetesService
-	RabbitMQService *RabbitMqService
-	HearthhubDb     *gorm.DB
-	ModNexusService *ModNexusService
+	DiscordService   *DiscordService
+	S3Service        *S3Service
+	StripeService    *StripeService
+	CognitoService   service.CognitoService
+	KubeService      KubernetesService
+	RabbitMQService  *RabbitMqService
+	HearthhubDb      *gorm.DB
+	ModNexusService  *ModNexusService
+	CatalogService   *CatalogService
+	OperationService *OperationService
+	ImageService     *ImageService
+	RolloutService   *RolloutService
+	RateLimitBackend RateLimitBackend
 }
@@ -89,13 +89,13 @@ func (w *WebSocketManager) Run() {
 			log.Infof("client connected with discord ID: %s", client.discordId)
 
 		case client := <-w.unregister:
+			w.mutex.Lock()
 			if _, ok := w.clients[client]; ok {
-				w.mutex.Lock()
 				delete(w.clients, client)
 				client.conn.Close()
-				w.mutex.Unlock()
 				log.Infof("client disconnected with discord ID: %s", client.discordId)
 			}
+			w.mutex.Unlock()
 		}
 	}
 }
@@ -123,8 +123,19 @@ func (w *WebSocketManager) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	// Each connection consumes on its own channel so a slow client cannot hold up deliveries to other clients. Closing the channel
+	// when the client disconnects cancels its consumer which deletes its auto-delete queue. Since every connection has its own queue
+	// bound by discord id, events reach the client whichever replica it is connected to.
+	ch, err := w.Connection.Channel()
+	if err != nil {
+		log.Errorf("error opening channel: %v", err)
+		conn.Close()
+		return
+	}
+	defer ch.Close()
+
 	// Declare a unique queue for this connection
-	q, err := w.Channel.QueueDeclare(
+	q, err := ch.QueueDeclare(
 		"",
 		false,
 		true,
@@ -139,7 +150,7 @@ func (w *WebSocketManager) HandleWebSocket(c *gin.Context) {
 	}
 
 	// Bind the queue to the exchange with server-specific routing key
-	err = w.Channel.QueueBind(
+	err = ch.QueueBind(
 		q.Name,
 		discordId,
 		"valheim-server-status",
@@ -152,7 +163,7 @@ func (w *WebSocketManager) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	msgs, err := w.Channel.Consume(
+	msgs, err := ch.Consume(
 		q.Name,
 		"",
 		true,